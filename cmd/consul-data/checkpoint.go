@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	checkpointFlushInterval = 5 * time.Second
+
+	checkpointTypeKV      = "kv"
+	checkpointTypeNode    = "node"
+	checkpointTypeService = "service"
+	checkpointTypeCheck   = "check"
+
+	checkpointTypeCoordinate = "coordinate"
+
+	checkpointTypeACLPolicy = "acl-policy"
+	checkpointTypeACLRole   = "acl-role"
+	checkpointTypeACLToken  = "acl-token"
+
+	checkpointTypeConfigEntry = "config-entry"
+
+	checkpointTypePreparedQuery = "prepared-query"
+
+	checkpointTypeSession = "session"
+
+	checkpointTypeEvent = "event"
+)
+
+// checkpointEntry identifies a single resource which was successfully pushed.
+type checkpointEntry struct {
+	Type string
+	Key  string `json:",omitempty"`
+	Node string `json:",omitempty"`
+	ID   string `json:",omitempty"`
+}
+
+func kvCheckpoint(key string) checkpointEntry {
+	return checkpointEntry{Type: checkpointTypeKV, Key: key}
+}
+
+func nodeCheckpoint(node string) checkpointEntry {
+	return checkpointEntry{Type: checkpointTypeNode, Node: node}
+}
+
+func serviceCheckpoint(node string, id string) checkpointEntry {
+	return checkpointEntry{Type: checkpointTypeService, Node: node, ID: id}
+}
+
+func checkCheckpoint(node string, id string) checkpointEntry {
+	return checkpointEntry{Type: checkpointTypeCheck, Node: node, ID: id}
+}
+
+func coordinateCheckpoint(node string) checkpointEntry {
+	return checkpointEntry{Type: checkpointTypeCoordinate, Node: node}
+}
+
+func aclPolicyCheckpoint(name string) checkpointEntry {
+	return checkpointEntry{Type: checkpointTypeACLPolicy, Key: name}
+}
+
+func aclRoleCheckpoint(name string) checkpointEntry {
+	return checkpointEntry{Type: checkpointTypeACLRole, Key: name}
+}
+
+func aclTokenCheckpoint(accessorID string) checkpointEntry {
+	return checkpointEntry{Type: checkpointTypeACLToken, ID: accessorID}
+}
+
+// configEntryCheckpoint identifies config entries by their kind, partition, namespace and name
+func configEntryCheckpoint(entry api.ConfigEntry) checkpointEntry {
+	return checkpointEntry{
+		Type: checkpointTypeConfigEntry,
+		Key:  fmt.Sprintf("%s/%s/%s/%s", entry.GetKind(), entry.GetPartition(), entry.GetNamespace(), entry.GetName()),
+	}
+}
+
+// preparedQueryCheckpoint identifies prepared queries by their datacenter and name as
+// their IDs are assigned by Consul
+func preparedQueryCheckpoint(datacenter string, name string) checkpointEntry {
+	return checkpointEntry{Type: checkpointTypePreparedQuery, Key: datacenter + "/" + name}
+}
+
+// sessionCheckpoint identifies sessions by their datacenter and name as their IDs are
+// assigned by Consul
+func sessionCheckpoint(datacenter string, name string) checkpointEntry {
+	return checkpointEntry{Type: checkpointTypeSession, Key: datacenter + "/" + name}
+}
+
+// eventCheckpoint identifies events by their position within the data as nothing
+// else about them is unique
+func eventCheckpoint(index int) checkpointEntry {
+	return checkpointEntry{Type: checkpointTypeEvent, Key: strconv.Itoa(index)}
+}
+
+// txnOpCheckpoint returns the entry for the resource written by the Txn operation.
+func txnOpCheckpoint(op *api.TxnOp) (checkpointEntry, bool) {
+	switch {
+	case op.KV != nil:
+		return kvCheckpoint(op.KV.Key), true
+	case op.Node != nil:
+		return nodeCheckpoint(op.Node.Node.Node), true
+	case op.Service != nil:
+		return serviceCheckpoint(op.Service.Node, op.Service.Service.ID), true
+	case op.Check != nil:
+		return checkCheckpoint(op.Check.Check.Node, op.Check.Check.CheckID), true
+	default:
+		return checkpointEntry{}, false
+	}
+}
+
+// checkpoint tracks which resources have been pushed to Consul. Completed resources
+// are appended to the checkpoint file as JSON lines which get flushed periodically,
+// so that a subsequent push can skip everything that was already completed.
+type checkpoint struct {
+	lock   sync.Mutex
+	done   map[checkpointEntry]struct{}
+	file   *os.File
+	buf    *bufio.Writer
+	enc    *json.Encoder
+	closed bool
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// openCheckpoint loads all entries from an existing checkpoint file at the given
+// path and opens it for recording further entries.
+func openCheckpoint(path string) (*checkpoint, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open checkpoint file %s: %w", path, err)
+	}
+
+	done := make(map[checkpointEntry]struct{})
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A crash may have left a partially written entry at the end of the file
+			// in which case that resource will just get pushed again.
+			break
+		}
+
+		var entry checkpointEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			break
+		}
+		done[entry] = struct{}{}
+		offset += int64(len(line))
+	}
+
+	// Truncate anything after the last complete entry so that new entries are not
+	// appended onto a partially written one.
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Failed to truncate checkpoint file %s: %w", path, err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Failed to seek within checkpoint file %s: %w", path, err)
+	}
+
+	buf := bufio.NewWriter(file)
+	c := &checkpoint{
+		done:    done,
+		file:    file,
+		buf:     buf,
+		enc:     json.NewEncoder(buf),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go c.flushPeriodically()
+	return c, nil
+}
+
+// completed returns whether the resource was previously pushed.
+func (c *checkpoint) completed(entry checkpointEntry) bool {
+	if c == nil {
+		return false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, found := c.done[entry]
+	return found
+}
+
+// size returns the number of resources which have been pushed.
+func (c *checkpoint) size() int {
+	if c == nil {
+		return 0
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.done)
+}
+
+// record marks the resource as having been pushed. Any errors writing the entry
+// to the checkpoint file are reported when closing the checkpoint.
+func (c *checkpoint) record(entry checkpointEntry) {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	if _, found := c.done[entry]; found {
+		return
+	}
+	c.done[entry] = struct{}{}
+
+	// the bufio.Writer retains any write error which will then be returned by Flush
+	c.enc.Encode(entry)
+}
+
+func (c *checkpoint) flushPeriodically() {
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(checkpointFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.lock.Lock()
+			if !c.closed {
+				c.flushLocked()
+			}
+			c.lock.Unlock()
+		}
+	}
+}
+
+func (c *checkpoint) flushLocked() error {
+	if err := c.buf.Flush(); err != nil {
+		return fmt.Errorf("Failed to flush checkpoint file: %w", err)
+	}
+	return c.file.Sync()
+}
+
+// close flushes all recorded entries to disk and closes the checkpoint file.
+func (c *checkpoint) close() error {
+	if c == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil
+	}
+	c.closed = true
+	err := c.flushLocked()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	c.lock.Unlock()
+
+	close(c.stop)
+	<-c.stopped
+	return err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	entries := []checkpointEntry{
+		kvCheckpoint("foo/bar"),
+		nodeCheckpoint("node1"),
+		serviceCheckpoint("node1", "web"),
+		checkCheckpoint("node1", "web-check"),
+		preparedQueryCheckpoint("dc1", "query"),
+		eventCheckpoint(3),
+	}
+
+	cases := map[string]struct {
+		// existing is the content of the checkpoint file before it is opened
+		existing string
+		// loaded is the number of entries loaded from the existing content
+		loaded int
+	}{
+		"new":     {},
+		"empty":   {existing: ""},
+		"entries": {existing: `{"Type":"kv","Key":"existing"}` + "\n" + `{"Type":"node","Node":"existing"}` + "\n", loaded: 2},
+		"partial": {existing: `{"Type":"kv","Key":"existing"}` + "\n" + `{"Type":"node","No`, loaded: 1},
+		"corrupt": {existing: `{"Type":"kv","Key":"existing"}` + "\n" + "not json\n" + `{"Type":"kv","Key":"after"}` + "\n", loaded: 1},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "checkpoint")
+			if err != nil {
+				t.Fatalf("Failed to create temporary directory: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "checkpoint")
+			if name != "new" {
+				if err := ioutil.WriteFile(path, []byte(tc.existing), 0644); err != nil {
+					t.Fatalf("Failed to write checkpoint file: %v", err)
+				}
+			}
+
+			c, err := openCheckpoint(path)
+			if err != nil {
+				t.Fatalf("Failed to open checkpoint: %v", err)
+			}
+			if c.size() != tc.loaded {
+				t.Fatalf("expected %d loaded entries but got %d", tc.loaded, c.size())
+			}
+
+			for _, entry := range entries {
+				if c.completed(entry) {
+					t.Fatalf("entry %v is completed before being recorded", entry)
+				}
+				c.record(entry)
+				// recording an entry again doesn't duplicate it
+				c.record(entry)
+			}
+			if err := c.close(); err != nil {
+				t.Fatalf("Failed to close checkpoint: %v", err)
+			}
+
+			// recording after closing is ignored
+			c.record(kvCheckpoint("closed"))
+
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read checkpoint file: %v", err)
+			}
+			if lines := strings.Count(string(content), "\n"); lines != tc.loaded+len(entries) {
+				t.Fatalf("expected %d lines in the checkpoint file but got %d:\n%s", tc.loaded+len(entries), lines, content)
+			}
+
+			c, err = openCheckpoint(path)
+			if err != nil {
+				t.Fatalf("Failed to reopen checkpoint: %v", err)
+			}
+			defer c.close()
+
+			if c.size() != tc.loaded+len(entries) {
+				t.Fatalf("expected %d entries after reopening but got %d", tc.loaded+len(entries), c.size())
+			}
+			for _, entry := range entries {
+				if !c.completed(entry) {
+					t.Fatalf("entry %v is not completed after reopening", entry)
+				}
+			}
+			if c.completed(kvCheckpoint("closed")) {
+				t.Fatalf("entry recorded after closing is completed")
+			}
+		})
+	}
+}
+
+func TestCheckpoint_Nil(t *testing.T) {
+	var c *checkpoint
+
+	c.record(kvCheckpoint("foo"))
+	if c.completed(kvCheckpoint("foo")) {
+		t.Fatalf("nil checkpoint has completed entries")
+	}
+	if c.size() != 0 {
+		t.Fatalf("nil checkpoint has a size of %d", c.size())
+	}
+	if err := c.close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/mitchellh/cli"
+	"github.com/mkeeler/consul-data/generate"
+	"github.com/mkeeler/consul-data/generate/catalog"
+	"github.com/mkeeler/consul-data/generate/configentries"
+	"github.com/mkeeler/consul-data/generate/kv"
+	"github.com/mkeeler/consul-data/generate/sessions"
+)
+
+type cleanupCommand struct {
+	ui           cli.Ui
+	dataPath     string
+	manifestPath string
+	quiet        bool
+
+	flags    *flag.FlagSet
+	http     *HTTPFlags
+	requests *requestFlags
+	help     string
+}
+
+func newCleanupCommand(ui cli.Ui) cli.Command {
+	c := &cleanupCommand{
+		// resources are deleted from multiple goroutines
+		ui: &cli.ConcurrentUi{Ui: ui},
+	}
+
+	flags := flag.NewFlagSet("", flag.ContinueOnError)
+
+	flags.BoolVar(&c.quiet, "quiet", false, "Whether to suppress output of handling of individual resources")
+	flags.StringVar(&c.dataPath, "data", "", "Path to data generated by consul-data generate describing the resources to delete")
+	flags.StringVar(&c.manifestPath, "manifest", "", "Path to the manifest written by consul-data push listing the IDs of the prepared queries and sessions to delete")
+
+	c.http = &HTTPFlags{}
+	c.http.MergeAll(flags)
+
+	c.requests = &requestFlags{}
+	c.requests.MergeAll(flags)
+
+	c.flags = flags
+	c.help = genUsage(`Usage: consul-data cleanup [OPTIONS]
+
+	Delete previously pushed data from Consul
+
+	Every KV entry, lock, service instance, node, config entry and ACL resource described by the file given
+	with the -data flag will be deleted from Consul. The file should be in
+	the format outputted by the consul-data generate command. Prepared queries
+	and sessions are only deleted when the manifest written by consul-data push
+	is given with the -manifest flag as their IDs are assigned by Consul`, c.flags)
+
+	return c
+}
+
+func (c *cleanupCommand) deleteData(data *generate.Data, manifest []manifestEntry) error {
+	client, err := newAPIClient(c.http)
+	if err != nil {
+		return fmt.Errorf("Failed to create Consul API client: %w", err)
+	}
+
+	c.requests.init()
+	defer func() {
+		c.ui.Info(fmt.Sprintf("Requests Retried: %d", c.requests.retriedRequests()))
+	}()
+
+	var resources int64
+
+	// sessions are destroyed first so that their locks are no longer held when deleted
+	var sessionEntries []manifestEntry
+	for _, entry := range manifest {
+		if entry.Type == manifestTypeSession {
+			sessionEntries = append(sessionEntries, entry)
+		}
+	}
+	if len(sessionEntries) > 0 {
+		c.ui.Info("Destroying sessions in Consul")
+		if err := c.destroySessions(client.Session(), sessionEntries, &resources); err != nil {
+			return err
+		}
+		c.ui.Info("Finished destroying sessions in Consul")
+	} else if len(data.Sessions) > 0 {
+		c.ui.Warn("Skipping destruction of sessions as their IDs are only known from the manifest given by the -manifest flag. They will be invalidated when their nodes are deleted")
+	}
+
+	if len(data.Sessions) > 0 {
+		c.ui.Info("Deleting locks from Consul")
+		if err := c.deleteLocks(client.KV(), data.Sessions, &resources); err != nil {
+			return err
+		}
+		c.ui.Info("Finished deleting locks from Consul")
+	}
+
+	if len(data.KV) > 0 {
+		c.ui.Info("Deleting KV data from Consul")
+		if err := c.deleteKV(client, data.KV, &resources); err != nil {
+			return err
+		}
+		c.ui.Info("Finished deleting KV data from Consul")
+	}
+
+	if len(data.Catalog) > 0 {
+		c.ui.Info("Deleting Catalog data from Consul")
+		if err := c.deleteCatalog(client, data.Catalog, &resources); err != nil {
+			return err
+		}
+		c.ui.Info("Finished deleting Catalog data from Consul")
+	}
+
+	if len(data.Intentions) > 0 {
+		c.ui.Info("Deleting intentions from Consul")
+		entries := make([]api.ConfigEntry, 0, len(data.Intentions))
+		for _, entry := range data.Intentions {
+			entries = append(entries, serviceIntentionsEntry(entry))
+		}
+		if err := c.deleteConfigEntries(client.ConfigEntries(), entries, &resources); err != nil {
+			return err
+		}
+		c.ui.Info("Finished deleting intentions from Consul")
+	}
+
+	if len(data.ConfigEntries) > 0 {
+		c.ui.Info("Deleting config entries from Consul")
+		// each kind is deleted in turn starting with those which refer to the others
+		for i := len(configentries.Kinds) - 1; i >= 0; i-- {
+			var entries []api.ConfigEntry
+			for _, entry := range data.ConfigEntries {
+				if entry.Kind != configentries.Kinds[i] {
+					continue
+				}
+				apiEntry, err := apiConfigEntry(entry)
+				if err != nil {
+					return err
+				}
+				entries = append(entries, apiEntry)
+			}
+			if err := c.deleteConfigEntries(client.ConfigEntries(), entries, &resources); err != nil {
+				return err
+			}
+		}
+		c.ui.Info("Finished deleting config entries from Consul")
+	}
+
+	var queries []manifestEntry
+	for _, entry := range manifest {
+		if entry.Type == manifestTypePreparedQuery {
+			queries = append(queries, entry)
+		}
+	}
+	if len(queries) > 0 {
+		c.ui.Info("Deleting prepared queries from Consul")
+		if err := c.deletePreparedQueries(client.PreparedQuery(), queries, &resources); err != nil {
+			return err
+		}
+		c.ui.Info("Finished deleting prepared queries from Consul")
+	} else if len(data.PreparedQueries) > 0 {
+		c.ui.Warn("Skipping deletion of prepared queries as their IDs are only known from the manifest given by the -manifest flag")
+	}
+
+	if len(data.ACLPolicies)+len(data.ACLRoles)+len(data.ACLTokens) > 0 {
+		c.ui.Info("Deleting ACL data from Consul")
+		if err := c.deleteACL(client.ACL(), data, &resources); err != nil {
+			return err
+		}
+		c.ui.Info("Finished deleting ACL data from Consul")
+	}
+
+	c.ui.Info(fmt.Sprintf("Total Resources Deleted: %d", resources))
+	return nil
+}
+
+func (c *cleanupCommand) newTxnManagers(client txnWriter, pool *workerPool, resources *int64) *txnManagers {
+	return c.requests.newTxnManagers(client, pool, func(ops api.TxnOps) {
+		atomic.AddInt64(resources, int64(len(ops)))
+	})
+}
+
+// deleteToken returns the token to delete a resource written with the given token. Tokens
+// which were expected to be denied lack the permissions to delete the resource so the
+// token of the cleanup is used instead.
+func deleteToken(token string, expectDenied bool) string {
+	if expectDenied {
+		return ""
+	}
+	return token
+}
+
+func (c *cleanupCommand) deleteKV(client *api.Client, data kv.KV, resources *int64) error {
+	pool := c.requests.newPool()
+
+	var txn *txnManagers
+	if c.requests.useTxn {
+		txn = c.newTxnManagers(client.Txn(), pool, resources)
+	}
+
+	kvClient := client.KV()
+	for key, value := range data {
+		if !c.quiet {
+			c.ui.Output(fmt.Sprintf("   Key: %s", key))
+		}
+
+		// a transaction is made with a single token so entries with their own are deleted individually
+		token := deleteToken(value.Token, value.ExpectDenied)
+		if txn != nil && token == "" {
+			txn.get(value.Datacenter).addOp(&api.TxnOp{
+				KV: &api.KVTxnOp{
+					Verb:      api.KVDelete,
+					Key:       key,
+					Namespace: value.Namespace,
+					Partition: value.Partition,
+				},
+			})
+			continue
+		}
+
+		key := key
+		opts := api.WriteOptions{
+			Datacenter: value.Datacenter,
+			Namespace:  value.Namespace,
+			Partition:  value.Partition,
+			Token:      token,
+		}
+
+		pool.submit(func() error {
+			err := c.requests.do(func() error {
+				_, err := kvClient.Delete(key, &opts)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to delete key %s: %w", key, err)
+			}
+			atomic.AddInt64(resources, 1)
+			return nil
+		})
+	}
+
+	if txn != nil {
+		txn.flush()
+	}
+
+	return pool.wait()
+}
+
+func (c *cleanupCommand) deleteCatalog(client *api.Client, data catalog.Catalog, resources *int64) error {
+	pool := c.requests.newPool()
+
+	var txn *txnManagers
+	if c.requests.useTxn {
+		txn = c.newTxnManagers(client.Txn(), pool, resources)
+	}
+
+	catalogClient := client.Catalog()
+	for _, node := range data {
+		if !c.quiet {
+			c.ui.Output(fmt.Sprintf("   Node: %s", node.Name))
+		}
+
+		// a transaction is made with a single token so nodes with their own are deleted individually
+		token := deleteToken(node.Token, node.ExpectDenied)
+		if txn != nil && token == "" {
+			txn.get(node.Datacenter).addOps(deleteNodeOps(node))
+			continue
+		}
+
+		node := node
+		opts := api.WriteOptions{Datacenter: node.Datacenter, Token: token}
+		deleteNode := func() error {
+			nodeDeregistration := api.CatalogDeregistration{
+				Node:       node.Name,
+				Datacenter: node.Datacenter,
+				Partition:  node.Partition,
+			}
+
+			err := c.requests.do(func() error {
+				_, err := catalogClient.Deregister(&nodeDeregistration, &opts)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to delete Node %s: %w", node.Name, err)
+			}
+			atomic.AddInt64(resources, 1)
+			return nil
+		}
+
+		instances := 0
+		for _, service := range node.Services {
+			instances += len(service.Instances)
+		}
+
+		if instances == 0 {
+			pool.submit(deleteNode)
+			continue
+		}
+
+		// The node is deleted once all of its service instances have been. As that
+		// happens from within a worker it must be submitted asynchronously.
+		remaining := int64(instances)
+		for _, service := range node.Services {
+			for _, instance := range service.Instances {
+				serviceDeregistration := api.CatalogDeregistration{
+					Node:       node.Name,
+					Datacenter: node.Datacenter,
+					ServiceID:  instance.ID,
+					Namespace:  instance.Namespace,
+					Partition:  node.Partition,
+				}
+
+				serviceName := service.Name
+				pool.submit(func() error {
+					defer func() {
+						if atomic.AddInt64(&remaining, -1) == 0 {
+							pool.submitAsync(deleteNode)
+						}
+					}()
+
+					err := c.requests.do(func() error {
+						_, err := catalogClient.Deregister(&serviceDeregistration, &opts)
+						return err
+					})
+					if err != nil {
+						return fmt.Errorf("Failed to delete Service %s for node %s: %w", serviceName, node.Name, err)
+					}
+					atomic.AddInt64(resources, 1)
+					return nil
+				})
+			}
+		}
+	}
+
+	if txn != nil {
+		txn.flush()
+	}
+
+	return pool.wait()
+}
+
+// deleteNodeOps returns the Txn operations deleting the node along with its services
+func deleteNodeOps(node *catalog.Node) api.TxnOps {
+	// services are deleted before the node they are registered to
+	var ops api.TxnOps
+	for _, service := range node.Services {
+		for _, instance := range service.Instances {
+			ops = append(ops, &api.TxnOp{
+				Service: &api.ServiceTxnOp{
+					Verb: api.ServiceDelete,
+					Node: node.Name,
+					Service: api.AgentService{
+						ID:        instance.ID,
+						Namespace: instance.Namespace,
+						Partition: node.Partition,
+					},
+				},
+			})
+		}
+	}
+
+	return append(ops, &api.TxnOp{
+		Node: &api.NodeTxnOp{
+			Verb: api.NodeDelete,
+			Node: api.Node{
+				Node:       node.Name,
+				Datacenter: node.Datacenter,
+				Partition:  node.Partition,
+			},
+		},
+	})
+}
+
+func (c *cleanupCommand) deleteConfigEntries(client *api.ConfigEntries, entries []api.ConfigEntry, resources *int64) error {
+	pool := c.requests.newPool()
+	for _, entry := range entries {
+		if !c.quiet {
+			c.ui.Output(fmt.Sprintf("   %s: %s", entry.GetKind(), entry.GetName()))
+		}
+
+		entry := entry
+		opts := api.WriteOptions{
+			Partition: entry.GetPartition(),
+			Namespace: entry.GetNamespace(),
+		}
+		pool.submit(func() error {
+			err := c.requests.do(func() error {
+				_, err := client.Delete(entry.GetKind(), entry.GetName(), &opts)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to delete %s %s: %w", entry.GetKind(), entry.GetName(), err)
+			}
+			atomic.AddInt64(resources, 1)
+			return nil
+		})
+	}
+	return pool.wait()
+}
+
+// deletePreparedQueries deletes the prepared queries with the IDs from the manifest.
+// Those which no longer exist are skipped.
+func (c *cleanupCommand) deletePreparedQueries(client *api.PreparedQuery, queries []manifestEntry, resources *int64) error {
+	pool := c.requests.newPool()
+	for _, query := range queries {
+		if !c.quiet {
+			c.ui.Output(fmt.Sprintf("   Prepared Query: %s (%s)", query.Name, query.ID))
+		}
+
+		query := query
+		pool.submit(func() error {
+			deleted := false
+			err := c.requests.do(func() error {
+				_, _, err := client.Get(query.ID, &api.QueryOptions{Datacenter: query.Datacenter})
+				if isNotFound(err) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				_, err = client.Delete(query.ID, &api.WriteOptions{Datacenter: query.Datacenter})
+				deleted = err == nil
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to delete prepared query %s: %w", query.ID, err)
+			}
+			if deleted {
+				atomic.AddInt64(resources, 1)
+			}
+			return nil
+		})
+	}
+	return pool.wait()
+}
+
+// destroySessions destroys the sessions with the IDs from the manifest
+func (c *cleanupCommand) destroySessions(client *api.Session, entries []manifestEntry, resources *int64) error {
+	pool := c.requests.newPool()
+	for _, session := range entries {
+		if !c.quiet {
+			c.ui.Output(fmt.Sprintf("   Session: %s (%s)", session.Name, session.ID))
+		}
+
+		session := session
+		opts := api.WriteOptions{Datacenter: session.Datacenter, Partition: session.Partition}
+		pool.submit(func() error {
+			err := c.requests.do(func() error {
+				_, err := client.Destroy(session.ID, &opts)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to destroy session %s: %w", session.ID, err)
+			}
+			atomic.AddInt64(resources, 1)
+			return nil
+		})
+	}
+	return pool.wait()
+}
+
+// deleteLocks deletes the KV entries of the locks acquired by the sessions. Those of
+// sessions which released them on being destroyed are otherwise left behind.
+func (c *cleanupCommand) deleteLocks(client *api.KV, data []*sessions.Session, resources *int64) error {
+	pool := c.requests.newPool()
+	for _, session := range data {
+		opts := api.WriteOptions{Datacenter: session.Datacenter, Partition: session.Partition}
+		for _, lock := range session.Locks {
+			if !c.quiet {
+				c.ui.Output(fmt.Sprintf("   Lock: %s", lock.Key))
+			}
+
+			key := lock.Key
+			pool.submit(func() error {
+				err := c.requests.do(func() error {
+					_, err := client.Delete(key, &opts)
+					return err
+				})
+				if err != nil {
+					return fmt.Errorf("Failed to delete lock %s: %w", key, err)
+				}
+				atomic.AddInt64(resources, 1)
+				return nil
+			})
+		}
+	}
+	return pool.wait()
+}
+
+// deleteACL deletes tokens, then roles and then policies so that nothing is deleted
+// while still linked to. Roles and policies are looked up by name as their IDs are
+// assigned by Consul. Those which no longer exist are skipped.
+func (c *cleanupCommand) deleteACL(client *api.ACL, data *generate.Data, resources *int64) error {
+	pool := c.requests.newPool()
+	for _, token := range data.ACLTokens {
+		if !c.quiet {
+			c.ui.Output(fmt.Sprintf("   Token: %s", token.AccessorID))
+		}
+
+		accessorID := token.AccessorID
+		pool.submit(func() error {
+			err := c.requests.do(func() error {
+				_, err := client.TokenDelete(accessorID, nil)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to delete Token %s: %w", accessorID, err)
+			}
+			atomic.AddInt64(resources, 1)
+			return nil
+		})
+	}
+	if err := pool.wait(); err != nil {
+		return err
+	}
+
+	pool = c.requests.newPool()
+	for _, role := range data.ACLRoles {
+		if !c.quiet {
+			c.ui.Output(fmt.Sprintf("   Role: %s", role.Name))
+		}
+
+		name := role.Name
+		pool.submit(func() error {
+			deleted := false
+			err := c.requests.do(func() error {
+				existing, _, err := client.RoleReadByName(name, nil)
+				if err != nil || existing == nil {
+					return err
+				}
+				_, err = client.RoleDelete(existing.ID, nil)
+				deleted = err == nil
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to delete Role %s: %w", name, err)
+			}
+			if deleted {
+				atomic.AddInt64(resources, 1)
+			}
+			return nil
+		})
+	}
+	if err := pool.wait(); err != nil {
+		return err
+	}
+
+	pool = c.requests.newPool()
+	for _, policy := range data.ACLPolicies {
+		if !c.quiet {
+			c.ui.Output(fmt.Sprintf("   Policy: %s", policy.Name))
+		}
+
+		name := policy.Name
+		pool.submit(func() error {
+			deleted := false
+			err := c.requests.do(func() error {
+				existing, _, err := client.PolicyReadByName(name, nil)
+				if err != nil || existing == nil {
+					return err
+				}
+				_, err = client.PolicyDelete(existing.ID, nil)
+				deleted = err == nil
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to delete Policy %s: %w", name, err)
+			}
+			if deleted {
+				atomic.AddInt64(resources, 1)
+			}
+			return nil
+		})
+	}
+	return pool.wait()
+}
+
+func (c *cleanupCommand) Run(args []string) int {
+	if err := c.flags.Parse(args); err != nil {
+		c.ui.Error(fmt.Sprintf("Failed to parse command line arguments: %v", err))
+		return 1
+	}
+
+	if c.dataPath == "" {
+		c.ui.Error("Must specify the path to the data to delete with the -data flag")
+		return 1
+	}
+
+	data, err := loadData(c.dataPath)
+	if err != nil {
+		c.ui.Error(err.Error())
+		return 1
+	}
+
+	var manifest []manifestEntry
+	if c.manifestPath != "" {
+		manifest, err = readManifest(c.manifestPath)
+		if err != nil {
+			c.ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	if err := c.deleteData(data, manifest); err != nil {
+		c.ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func (c *cleanupCommand) Synopsis() string {
+	return "Delete previously pushed data from Consul"
+}
+
+func (c *cleanupCommand) Help() string {
+	return c.help
+}
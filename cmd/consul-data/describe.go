@@ -1,10 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/mitchellh/cli"
+	"github.com/mkeeler/consul-data/generate"
+	"github.com/mkeeler/consul-data/generate/acl"
+	"github.com/mkeeler/consul-data/generate/catalog"
+	"github.com/mkeeler/consul-data/generate/configentries"
+	"github.com/mkeeler/consul-data/generate/events"
+	"github.com/mkeeler/consul-data/generate/intentions"
+	"github.com/mkeeler/consul-data/generate/kv"
+	"github.com/mkeeler/consul-data/generate/preparedqueries"
+	"github.com/mkeeler/consul-data/generate/sessions"
 )
 
 type describeCommand struct {
@@ -43,24 +56,203 @@ func (c *describeCommand) Run(args []string) int {
 		return 1
 	}
 
-	data, err := loadData(args[0])
+	total := &describeCounts{}
+	datacenters := make(map[string]*describeCounts)
+	forDatacenter := func(dc string) *describeCounts {
+		counts, ok := datacenters[dc]
+		if !ok {
+			counts = &describeCounts{}
+			datacenters[dc] = counts
+		}
+		return counts
+	}
+
+	graphServices, graphUpstreams := 0, 0
+	policies, roles, tokens := 0, 0, 0
+	destinations, allows, denies, l7 := 0, 0, 0, 0
+	configEntries := make(map[string]int)
+	queries, templates := 0, 0
+	numSessions, locks, ttls := 0, 0, 0
+	numEvents, filtered := 0, 0
+	eventNames := make(map[string]struct{})
+	coordinates := 0
+	zones := make(map[describeZone]struct{})
+	err := streamData(args[0], generate.Handler{
+		KV: func(_ string, value kv.Value) error {
+			total.keys += 1
+			forDatacenter(value.Datacenter).keys += 1
+			return nil
+		},
+		GraphService: func(svc *catalog.GraphService) error {
+			graphServices += 1
+			graphUpstreams += len(svc.Upstreams)
+			return nil
+		},
+		Node: func(node *catalog.Node) error {
+			total.addNode(node)
+			forDatacenter(node.Datacenter).addNode(node)
+			if node.Coordinate != nil {
+				coordinates += 1
+				zones[describeZone{datacenter: node.Datacenter, zone: node.Coordinate.Zone}] = struct{}{}
+			}
+			return nil
+		},
+		ACLPolicy: func(*acl.Policy) error {
+			policies += 1
+			return nil
+		},
+		ACLRole: func(*acl.Role) error {
+			roles += 1
+			return nil
+		},
+		ACLToken: func(*acl.Token) error {
+			tokens += 1
+			return nil
+		},
+		ConfigEntry: func(entry *configentries.Entry) error {
+			configEntries[entry.Kind] += 1
+			return nil
+		},
+		PreparedQuery: func(query *preparedqueries.Query) error {
+			if query.Template != nil {
+				templates += 1
+			} else {
+				queries += 1
+			}
+			return nil
+		},
+		Session: func(session *sessions.Session) error {
+			numSessions += 1
+			locks += len(session.Locks)
+			if session.TTL != "" {
+				ttls += 1
+			}
+			return nil
+		},
+		Event: func(event *events.Event) error {
+			numEvents += 1
+			eventNames[event.Name] = struct{}{}
+			if event.NodeFilter != "" || event.ServiceFilter != "" {
+				filtered += 1
+			}
+			return nil
+		},
+		Intentions: func(entry *intentions.Intentions) error {
+			destinations += 1
+			for _, source := range entry.Sources {
+				switch {
+				case len(source.Permissions) > 0:
+					l7 += 1
+				case source.Action == intentions.ActionDeny:
+					denies += 1
+				default:
+					allows += 1
+				}
+			}
+			return nil
+		},
+	})
 	if err != nil {
 		c.ui.Error(err.Error())
 		return 1
 	}
 
-	svcCount := 0
-	for _, node := range data.Catalog {
-		svcCount += len(node.Services)
+	c.ui.Info(fmt.Sprintf("Keys:     %d", total.keys))
+	c.ui.Info(fmt.Sprintf("Nodes:    %d", total.nodes))
+	c.ui.Info(fmt.Sprintf("Services: %d", total.services))
+	c.ui.Info(fmt.Sprintf("Checks:   %d", total.checks))
+	c.ui.Info(fmt.Sprintf("Proxies:  %d", total.proxies))
+	c.ui.Info(fmt.Sprintf("Gateways: %d", total.gateways))
+	if coordinates > 0 {
+		c.ui.Info(fmt.Sprintf("Coordinates: %d nodes in %d zones", coordinates, len(zones)))
+	}
+	if graphServices > 0 {
+		c.ui.Info(fmt.Sprintf("Graph:    %d services, %d upstreams", graphServices, graphUpstreams))
+	}
+	if policies+roles+tokens > 0 {
+		c.ui.Info(fmt.Sprintf("ACL:      %d policies, %d roles, %d tokens", policies, roles, tokens))
+	}
+	if len(configEntries) > 0 {
+		var counts []string
+		for _, kind := range configentries.Kinds {
+			if configEntries[kind] > 0 {
+				counts = append(counts, fmt.Sprintf("%d %s", configEntries[kind], kind))
+			}
+		}
+		c.ui.Info(fmt.Sprintf("Config Entries: %s", strings.Join(counts, ", ")))
 	}
+	if destinations > 0 {
+		c.ui.Info(fmt.Sprintf("Intentions: %d destinations, %d allow, %d deny, %d L7", destinations, allows, denies, l7))
+	}
+	if queries+templates > 0 {
+		c.ui.Info(fmt.Sprintf("Prepared Queries: %d queries, %d templates", queries, templates))
+	}
+	if numSessions > 0 {
+		c.ui.Info(fmt.Sprintf("Sessions: %d sessions, %d locks, %d with TTLs", numSessions, locks, ttls))
+	}
+	if numEvents > 0 {
+		c.ui.Info(fmt.Sprintf("Events:   %d events, %d names, %d filtered", numEvents, len(eventNames), filtered))
+	}
+
+	// the breakdown is only useful when the data is not all destined for the agent's datacenter
+	if _, ok := datacenters[""]; len(datacenters) > 1 || (len(datacenters) == 1 && !ok) {
+		names := make([]string, 0, len(datacenters))
+		for name := range datacenters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
 
-	c.ui.Info(fmt.Sprintf("Keys:     %d", len(data.KV)))
-	c.ui.Info(fmt.Sprintf("Nodes:    %d", len(data.Catalog)))
-	c.ui.Info(fmt.Sprintf("Services: %d", svcCount))
+		var out bytes.Buffer
+		tw := tabwriter.NewWriter(&out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "Datacenter\tKeys\tNodes\tServices\tChecks\tProxies\tGateways")
+		for _, name := range names {
+			counts := datacenters[name]
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\n", orDefault(name), counts.keys, counts.nodes, counts.services, counts.checks, counts.proxies, counts.gateways)
+		}
+		tw.Flush()
+
+		c.ui.Output("")
+		c.ui.Output(strings.TrimRight(out.String(), "\n"))
+	}
 
 	return 0
 }
 
+// describeZone identifies a zone which nodes are placed in as each datacenter has its own
+type describeZone struct {
+	datacenter string
+	zone       int
+}
+
+// describeCounts tallies the resources within some subset of the data
+type describeCounts struct {
+	keys     int
+	nodes    int
+	services int
+	checks   int
+	proxies  int
+	gateways int
+}
+
+func (d *describeCounts) addNode(node *catalog.Node) {
+	d.nodes += 1
+	d.services += len(node.Services)
+	d.checks += len(node.Checks)
+	for _, service := range node.Services {
+		for _, instance := range service.Instances {
+			d.checks += len(instance.Checks)
+
+			switch instance.Kind {
+			case "":
+			case catalog.ServiceKindConnectProxy:
+				d.proxies += 1
+			default:
+				d.gateways += 1
+			}
+		}
+	}
+}
+
 func (c *describeCommand) Synopsis() string {
 	return "Describe generated Consul data for Consul"
 }
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/mitchellh/cli"
+)
+
+const (
+	dryRunTypeKV      = "kv"
+	dryRunTypeNode    = "node"
+	dryRunTypeService = "service"
+	dryRunTypeCheck   = "check"
+	dryRunTypeTxn     = "txn"
+
+	dryRunTypeCoordinate = "coordinate"
+	// dryRunTypePartition and dryRunTypeNamespace are only recorded when the
+	// partitions and namespaces are to be created
+	dryRunTypePartition = "partition"
+	dryRunTypeNamespace = "namespace"
+
+	dryRunTypeACLPolicy = "acl-policy"
+	dryRunTypeACLRole   = "acl-role"
+	dryRunTypeACLToken  = "acl-token"
+
+	dryRunTypePreparedQuery = "prepared-query"
+	dryRunTypeSession       = "session"
+	dryRunTypeLock          = "lock"
+	dryRunTypeEvent         = "event"
+)
+
+// dryRunKey is what resources are grouped by in the dry run summary
+type dryRunKey struct {
+	Type       string
+	Datacenter string
+	Partition  string
+	Namespace  string
+}
+
+// dryRunRequest is the JSON representation of a single request that would have been made
+type dryRunRequest struct {
+	Type         string
+	KV           *api.KVPair                  `json:",omitempty"`
+	Options      *api.WriteOptions            `json:",omitempty"`
+	Registration *api.CatalogRegistration     `json:",omitempty"`
+	Txn          api.TxnOps                   `json:",omitempty"`
+	Coordinate   *api.CoordinateEntry         `json:",omitempty"`
+	Partition    *api.Partition               `json:",omitempty"`
+	Namespace    *api.Namespace               `json:",omitempty"`
+	ACLPolicy    *api.ACLPolicy               `json:",omitempty"`
+	ACLRole      *api.ACLRole                 `json:",omitempty"`
+	ACLToken     *api.ACLToken                `json:",omitempty"`
+	ConfigEntry  api.ConfigEntry              `json:",omitempty"`
+	Query        *api.PreparedQueryDefinition `json:",omitempty"`
+	Session      *api.SessionEntry            `json:",omitempty"`
+	Event        *api.UserEvent               `json:",omitempty"`
+}
+
+// dryRun satisfies all of the interfaces used to write data to Consul but instead of
+// making any requests it records what would have been written. Each request can optionally be written out as a line of JSON.
+type dryRun struct {
+	lock     sync.Mutex
+	file     *os.File
+	buf      *bufio.Writer
+	enc      *json.Encoder
+	counts   map[dryRunKey]int
+	requests int
+	txns     int
+}
+
+// newDryRun creates a new dryRun which will write each request as JSON to
+// the file at the given path when it is not empty.
+func newDryRun(path string) (*dryRun, error) {
+	d := &dryRun{
+		counts: make(map[dryRunKey]int),
+	}
+
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create dry run output file %s: %w", path, err)
+		}
+
+		d.file = file
+		d.buf = bufio.NewWriter(file)
+		d.enc = json.NewEncoder(d.buf)
+	}
+
+	return d, nil
+}
+
+func (d *dryRun) record(req *dryRunRequest, keys ...dryRunKey) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.requests += 1
+	if req.Type == dryRunTypeTxn {
+		d.txns += 1
+	}
+	for _, key := range keys {
+		d.counts[key] += 1
+	}
+
+	if d.enc != nil {
+		if err := d.enc.Encode(req); err != nil {
+			return fmt.Errorf("Failed to write dry run request: %w", err)
+		}
+	}
+	return nil
+}
+
+// Put implements the kvWriter interface
+func (d *dryRun) Put(p *api.KVPair, q *api.WriteOptions) (*api.WriteMeta, error) {
+	key := dryRunKey{Type: dryRunTypeKV, Datacenter: q.Datacenter, Partition: p.Partition, Namespace: p.Namespace}
+	return &api.WriteMeta{}, d.record(&dryRunRequest{Type: dryRunTypeKV, KV: p, Options: q}, key)
+}
+
+// Register implements the catalogWriter interface
+func (d *dryRun) Register(reg *api.CatalogRegistration, q *api.WriteOptions) (*api.WriteMeta, error) {
+	var keys []dryRunKey
+	reqType := dryRunTypeCheck
+	switch {
+	case reg.Service != nil:
+		reqType = dryRunTypeService
+		keys = append(keys, dryRunKey{Type: dryRunTypeService, Datacenter: reg.Datacenter, Partition: reg.Partition, Namespace: reg.Service.Namespace})
+	case !reg.SkipNodeUpdate:
+		reqType = dryRunTypeNode
+		keys = append(keys, dryRunKey{Type: dryRunTypeNode, Datacenter: reg.Datacenter, Partition: reg.Partition})
+	}
+
+	for _, check := range reg.Checks {
+		keys = append(keys, dryRunKey{Type: dryRunTypeCheck, Datacenter: reg.Datacenter, Partition: reg.Partition, Namespace: check.Namespace})
+	}
+	return &api.WriteMeta{}, d.record(&dryRunRequest{Type: reqType, Registration: reg, Options: q}, keys...)
+}
+
+// Txn implements the txnWriter interface
+func (d *dryRun) Txn(txn api.TxnOps, q *api.QueryOptions) (bool, *api.TxnResponse, *api.QueryMeta, error) {
+	datacenter := ""
+	if q != nil {
+		datacenter = q.Datacenter
+	}
+
+	keys := make([]dryRunKey, 0, len(txn))
+	for _, op := range txn {
+		switch {
+		case op.KV != nil:
+			keys = append(keys, dryRunKey{Type: dryRunTypeKV, Datacenter: datacenter, Partition: op.KV.Partition, Namespace: op.KV.Namespace})
+		case op.Node != nil:
+			keys = append(keys, dryRunKey{Type: dryRunTypeNode, Datacenter: datacenter, Partition: op.Node.Node.Partition})
+		case op.Service != nil:
+			keys = append(keys, dryRunKey{Type: dryRunTypeService, Datacenter: datacenter, Partition: op.Service.Service.Partition, Namespace: op.Service.Service.Namespace})
+		case op.Check != nil:
+			keys = append(keys, dryRunKey{Type: dryRunTypeCheck, Datacenter: datacenter, Partition: op.Check.Check.Partition, Namespace: op.Check.Check.Namespace})
+		}
+	}
+
+	if err := d.record(&dryRunRequest{Type: dryRunTypeTxn, Txn: txn}, keys...); err != nil {
+		return false, nil, nil, err
+	}
+	return true, &api.TxnResponse{}, &api.QueryMeta{}, nil
+}
+
+// Update implements the coordinateWriter interface
+func (d *dryRun) Update(coord *api.CoordinateEntry, q *api.WriteOptions) (*api.WriteMeta, error) {
+	key := dryRunKey{Type: dryRunTypeCoordinate, Datacenter: q.Datacenter, Partition: coord.Partition}
+	return &api.WriteMeta{}, d.record(&dryRunRequest{Type: dryRunTypeCoordinate, Coordinate: coord, Options: q}, key)
+}
+
+// CreatePartition implements the tenancyWriter interface
+func (d *dryRun) CreatePartition(datacenter string, name string) (bool, error) {
+	key := dryRunKey{Type: dryRunTypePartition, Datacenter: datacenter, Partition: name}
+	req := &dryRunRequest{
+		Type:      dryRunTypePartition,
+		Partition: &api.Partition{Name: name},
+		Options:   &api.WriteOptions{Datacenter: datacenter},
+	}
+	return true, d.record(req, key)
+}
+
+// CreateNamespace implements the tenancyWriter interface
+func (d *dryRun) CreateNamespace(datacenter string, partition string, name string) (bool, error) {
+	key := dryRunKey{Type: dryRunTypeNamespace, Datacenter: datacenter, Partition: partition, Namespace: name}
+	req := &dryRunRequest{
+		Type:      dryRunTypeNamespace,
+		Namespace: &api.Namespace{Name: name, Partition: partition},
+		Options:   &api.WriteOptions{Datacenter: datacenter, Partition: partition},
+	}
+	return true, d.record(req, key)
+}
+
+// PolicyCreate implements the aclWriter interface
+func (d *dryRun) PolicyCreate(policy *api.ACLPolicy, q *api.WriteOptions) (*api.ACLPolicy, *api.WriteMeta, error) {
+	req := &dryRunRequest{Type: dryRunTypeACLPolicy, ACLPolicy: policy, Options: q}
+	return policy, &api.WriteMeta{}, d.record(req, dryRunKey{Type: dryRunTypeACLPolicy})
+}
+
+// RoleCreate implements the aclWriter interface
+func (d *dryRun) RoleCreate(role *api.ACLRole, q *api.WriteOptions) (*api.ACLRole, *api.WriteMeta, error) {
+	req := &dryRunRequest{Type: dryRunTypeACLRole, ACLRole: role, Options: q}
+	return role, &api.WriteMeta{}, d.record(req, dryRunKey{Type: dryRunTypeACLRole})
+}
+
+// TokenCreate implements the aclWriter interface
+func (d *dryRun) TokenCreate(token *api.ACLToken, q *api.WriteOptions) (*api.ACLToken, *api.WriteMeta, error) {
+	req := &dryRunRequest{Type: dryRunTypeACLToken, ACLToken: token, Options: q}
+	return token, &api.WriteMeta{}, d.record(req, dryRunKey{Type: dryRunTypeACLToken})
+}
+
+// PolicyReadByName implements the aclWriter interface. Nothing is read during a dry run
+// as no requests fail.
+func (d *dryRun) PolicyReadByName(policyName string, q *api.QueryOptions) (*api.ACLPolicy, *api.QueryMeta, error) {
+	return nil, &api.QueryMeta{}, nil
+}
+
+// RoleReadByName implements the aclWriter interface. Nothing is read during a dry run
+// as no requests fail.
+func (d *dryRun) RoleReadByName(roleName string, q *api.QueryOptions) (*api.ACLRole, *api.QueryMeta, error) {
+	return nil, &api.QueryMeta{}, nil
+}
+
+// TokenRead implements the aclWriter interface. Nothing is read during a dry run as no
+// requests fail.
+func (d *dryRun) TokenRead(accessorID string, q *api.QueryOptions) (*api.ACLToken, *api.QueryMeta, error) {
+	return nil, &api.QueryMeta{}, nil
+}
+
+// Set implements the configEntryWriter interface. Config entries are summarized by kind.
+func (d *dryRun) Set(entry api.ConfigEntry, q *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	req := &dryRunRequest{Type: entry.GetKind(), ConfigEntry: entry, Options: q}
+	key := dryRunKey{Type: entry.GetKind(), Partition: entry.GetPartition(), Namespace: entry.GetNamespace()}
+	return true, &api.WriteMeta{}, d.record(req, key)
+}
+
+// Create implements the preparedQueryWriter interface. No ID is returned as none is
+// assigned.
+func (d *dryRun) Create(query *api.PreparedQueryDefinition, q *api.WriteOptions) (string, *api.WriteMeta, error) {
+	req := &dryRunRequest{Type: dryRunTypePreparedQuery, Query: query, Options: q}
+	return "", &api.WriteMeta{}, d.record(req, dryRunKey{Type: dryRunTypePreparedQuery, Datacenter: q.Datacenter})
+}
+
+// List implements the preparedQueryWriter interface. Nothing is listed during a dry run
+// as no requests fail.
+func (d *dryRun) List(q *api.QueryOptions) ([]*api.PreparedQueryDefinition, *api.QueryMeta, error) {
+	return nil, &api.QueryMeta{}, nil
+}
+
+// CreateSession implements the sessionWriter interface. No ID is returned as none is
+// assigned.
+func (d *dryRun) CreateSession(session *api.SessionEntry, q *api.WriteOptions) (string, error) {
+	req := &dryRunRequest{Type: dryRunTypeSession, Session: session, Options: q}
+	return "", d.record(req, dryRunKey{Type: dryRunTypeSession, Datacenter: q.Datacenter, Partition: q.Partition})
+}
+
+// AcquireLock implements the sessionWriter interface. Locks are always acquired.
+func (d *dryRun) AcquireLock(pair *api.KVPair, q *api.WriteOptions) (bool, error) {
+	req := &dryRunRequest{Type: dryRunTypeLock, KV: pair, Options: q}
+	return true, d.record(req, dryRunKey{Type: dryRunTypeLock, Datacenter: q.Datacenter, Partition: q.Partition})
+}
+
+// RenewSession implements the sessionWriter interface. Sessions are never renewed
+// during a dry run.
+func (d *dryRun) RenewSession(id string, q *api.WriteOptions) (bool, error) {
+	return true, nil
+}
+
+// Fire implements the eventWriter interface. No ID is returned as none is assigned.
+func (d *dryRun) Fire(event *api.UserEvent, q *api.WriteOptions) (string, *api.WriteMeta, error) {
+	req := &dryRunRequest{Type: dryRunTypeEvent, Event: event, Options: q}
+	return "", &api.WriteMeta{}, d.record(req, dryRunKey{Type: dryRunTypeEvent, Datacenter: q.Datacenter})
+}
+
+// close flushes any buffered JSON output and closes the output file.
+func (d *dryRun) close() error {
+	if d.file == nil {
+		return nil
+	}
+
+	err := d.buf.Flush()
+	if closeErr := d.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to write dry run output: %w", err)
+	}
+	return nil
+}
+
+func orDefault(value string) string {
+	if value == "" {
+		return "(default)"
+	}
+	return value
+}
+
+// summarize outputs a table of the resources that would have been written
+// along with the number of requests and transactions it would have taken.
+func (d *dryRun) summarize(ui cli.Ui) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	keys := make([]dryRunKey, 0, len(d.counts))
+	for key := range d.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Type != keys[j].Type {
+			return keys[i].Type < keys[j].Type
+		}
+		if keys[i].Datacenter != keys[j].Datacenter {
+			return keys[i].Datacenter < keys[j].Datacenter
+		}
+		if keys[i].Partition != keys[j].Partition {
+			return keys[i].Partition < keys[j].Partition
+		}
+		return keys[i].Namespace < keys[j].Namespace
+	})
+
+	var out bytes.Buffer
+	tw := tabwriter.NewWriter(&out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Type\tDatacenter\tPartition\tNamespace\tCount")
+	for _, key := range keys {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", key.Type, orDefault(key.Datacenter), orDefault(key.Partition), orDefault(key.Namespace), d.counts[key])
+	}
+	tw.Flush()
+
+	ui.Output(strings.TrimRight(out.String(), "\n"))
+	ui.Info(fmt.Sprintf("Requests:    %d", d.requests))
+	ui.Info(fmt.Sprintf("Txn Batches: %d", d.txns))
+}
@@ -1,11 +1,8 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"math/rand"
 	"time"
 
 	"github.com/mitchellh/cli"
@@ -16,6 +13,8 @@ type generateCommand struct {
 	ui         cli.Ui
 	configPath string
 	randSeed   int64
+	format     string
+	compress   string
 
 	flags *flag.FlagSet
 	help  string
@@ -30,6 +29,8 @@ func newGenerateCommand(ui cli.Ui) cli.Command {
 
 	flags.Int64Var(&c.randSeed, "seed", 0, "Value to use to seed the pseudo-random number generator with instead of the current time")
 	flags.StringVar(&c.configPath, "config", "", "Path to the configuration to use for generating data")
+	flags.StringVar(&c.compress, "compress", "", fmt.Sprintf("Compression to use for the output. Must be one of %q, %q or %q. By default this is determined by whether the output path ends in .gz or .zst", generate.CompressionNone, generate.CompressionGzip, generate.CompressionZstd))
+	flags.StringVar(&c.format, "format", generate.FormatJSON, fmt.Sprintf("Format to output the data in. Must be either %q for a single JSON object or %q for one JSON record per line", generate.FormatJSON, generate.FormatNDJSON))
 
 	c.flags = flags
 	c.help = genUsage(`Usage: consul-data generate [OPTIONS] [output path]
@@ -54,7 +55,6 @@ func (c *generateCommand) Run(args []string) int {
 	if c.randSeed == 0 {
 		c.randSeed = time.Now().UnixNano()
 	}
-	rand.Seed(c.randSeed)
 
 	conf := generate.DefaultConfig()
 
@@ -67,26 +67,31 @@ func (c *generateCommand) Run(args []string) int {
 		}
 	}
 
-	data, err := generate.GenerateAll(conf)
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	out, err := createOutput(path, c.format, c.compress)
 	if err != nil {
+		c.ui.Error(err.Error())
+		return 1
+	}
+
+	// the data is written as it is generated so that it never has to be held in memory
+	if err := generate.StreamAll(conf, c.randSeed, out.Handler()); err != nil {
+		out.Close()
 		c.ui.Error(fmt.Sprintf("Failed to generate Consul data: %v", err))
 		return 1
 	}
 
-	serialized, err := json.MarshalIndent(data, "", "   ")
-	if err != nil {
-		c.ui.Error(fmt.Sprintf("Failed to serialize Consul data: %v", err))
+	if err := out.Close(); err != nil {
+		c.ui.Error(fmt.Sprintf("Failed to write serialized Consul data: %v", err))
 		return 1
 	}
 
-	if len(args) > 0 {
-		if err := ioutil.WriteFile(args[0], serialized, 0644); err != nil {
-			c.ui.Error(fmt.Sprintf("Failed to write serialized Consul data to %q: %v", args[0], err))
-			return 1
-		}
-		c.ui.Info(fmt.Sprintf("Consul data written to %s", args[0]))
-	} else {
-		c.ui.Info(string(serialized))
+	if path != "" {
+		c.ui.Info(fmt.Sprintf("Consul data written to %s", path))
 	}
 
 	return 0
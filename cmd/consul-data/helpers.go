@@ -1,23 +1,150 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"os"
 
 	"github.com/mkeeler/consul-data/generate"
+	"github.com/mkeeler/consul-data/generate/acl"
+	"github.com/mkeeler/consul-data/generate/catalog"
+	"github.com/mkeeler/consul-data/generate/configentries"
+	"github.com/mkeeler/consul-data/generate/events"
+	"github.com/mkeeler/consul-data/generate/intentions"
+	"github.com/mkeeler/consul-data/generate/kv"
+	"github.com/mkeeler/consul-data/generate/preparedqueries"
+	"github.com/mkeeler/consul-data/generate/sessions"
 )
 
+// loadData reads the entire data file at the given path into memory.
 func loadData(path string) (*generate.Data, error) {
-	raw, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to read data from %s: %w", path, err)
+	data := generate.Data{
+		KV: make(kv.KV),
 	}
 
-	var data generate.Data
-	if err := json.Unmarshal(raw, &data); err != nil {
-		return nil, fmt.Errorf("Failed to parse JSON data from %s: %w", path, err)
+	err := streamData(path, generate.Handler{
+		KV: func(key string, value kv.Value) error {
+			data.KV[key] = value
+			return nil
+		},
+		GraphService: func(svc *catalog.GraphService) error {
+			data.ServiceGraph = append(data.ServiceGraph, svc)
+			return nil
+		},
+		Node: func(node *catalog.Node) error {
+			data.Catalog = append(data.Catalog, node)
+			return nil
+		},
+		ACLPolicy: func(policy *acl.Policy) error {
+			data.ACLPolicies = append(data.ACLPolicies, policy)
+			return nil
+		},
+		ACLRole: func(role *acl.Role) error {
+			data.ACLRoles = append(data.ACLRoles, role)
+			return nil
+		},
+		ACLToken: func(token *acl.Token) error {
+			data.ACLTokens = append(data.ACLTokens, token)
+			return nil
+		},
+		ConfigEntry: func(entry *configentries.Entry) error {
+			data.ConfigEntries = append(data.ConfigEntries, entry)
+			return nil
+		},
+		Intentions: func(entry *intentions.Intentions) error {
+			data.Intentions = append(data.Intentions, entry)
+			return nil
+		},
+		PreparedQuery: func(query *preparedqueries.Query) error {
+			data.PreparedQueries = append(data.PreparedQueries, query)
+			return nil
+		},
+		Session: func(session *sessions.Session) error {
+			data.Sessions = append(data.Sessions, session)
+			return nil
+		},
+		Event: func(event *events.Event) error {
+			data.Events = append(data.Events, event)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &data, nil
 }
+
+// streamData reads the data file at the given path handing each KV entry and node
+// to the handler without loading the entire file into memory. The file may be in
+// any of the formats supported by consul-data generate.
+func streamData(path string, h generate.Handler) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read data from %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := generate.Decode(file, h); err != nil {
+		return fmt.Errorf("Failed to parse data from %s: %w", path, err)
+	}
+	return nil
+}
+
+// dataOutput is a data file being written by consul-data.
+type dataOutput struct {
+	generate.Encoder
+	compressor io.WriteCloser
+	file       *os.File
+}
+
+// createOutput creates the data file at the given path, or writes to stdout when the
+// path is empty. When compression is empty it is determined by the path's extension.
+func createOutput(path string, format string, compression string) (*dataOutput, error) {
+	if compression == "" {
+		compression = generate.CompressionForPath(path)
+	}
+	if err := generate.ValidateCompression(compression); err != nil {
+		return nil, err
+	}
+	if err := generate.ValidateFormat(format); err != nil {
+		return nil, err
+	}
+
+	out := &dataOutput{file: os.Stdout}
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create output file %q: %w", path, err)
+		}
+		out.file = file
+	}
+
+	var err error
+	out.compressor, err = generate.NewCompressor(out.file, compression)
+	if err == nil {
+		out.Encoder, err = generate.NewEncoder(out.compressor, format)
+	}
+	if err != nil {
+		if path != "" {
+			out.file.Close()
+		}
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// Close finishes writing all of the data and closes the data file.
+func (o *dataOutput) Close() error {
+	err := o.Encoder.Close()
+	if compressErr := o.compressor.Close(); err == nil && compressErr != nil {
+		err = fmt.Errorf("Failed to compress data: %w", compressErr)
+	}
+	if o.file != os.Stdout {
+		if closeErr := o.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -35,6 +35,8 @@ func main() {
 		"generate": func() (cli.Command, error) { return newGenerateCommand(ui), nil },
 		"push":     func() (cli.Command, error) { return newPushCommand(ui), nil },
 		"describe": func() (cli.Command, error) { return newDescribeCommand(ui), nil },
+		"cleanup":  func() (cli.Command, error) { return newCleanupCommand(ui), nil },
+		"verify":   func() (cli.Command, error) { return newVerifyCommand(ui), nil },
 	}
 
 	exitStatus, err := c.Run()
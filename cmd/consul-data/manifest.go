@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// manifestEntry records a resource created by a push whose ID was assigned by Consul
+// and so can't be derived from the data when cleaning up.
+type manifestEntry struct {
+	Type       string
+	ID         string
+	Name       string `json:",omitempty"`
+	Datacenter string `json:",omitempty"`
+	Partition  string `json:",omitempty"`
+}
+
+const (
+	manifestTypePreparedQuery = "prepared-query"
+	manifestTypeSession       = "session"
+)
+
+// manifest is the output of a push listing the resources created which have IDs assigned
+// by Consul. Entries are appended as JSON lines so that the manifest written by an
+// interrupted push which gets resumed from a checkpoint still lists every resource.
+type manifest struct {
+	lock sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+	err  error
+}
+
+// openManifest opens the manifest at the given path for appending entries
+func openManifest(path string) (*manifest, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open manifest file %s: %w", path, err)
+	}
+
+	return &manifest{
+		file: file,
+		enc:  json.NewEncoder(file),
+	}, nil
+}
+
+// record writes the entry to the manifest. Entries are written immediately as losing
+// one would leave its resource behind after a cleanup. Any errors are reported when
+// closing the manifest.
+func (m *manifest) record(entry manifestEntry) {
+	if m == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.enc.Encode(entry); err != nil && m.err == nil {
+		m.err = fmt.Errorf("Failed to write to manifest file: %w", err)
+	}
+}
+
+func (m *manifest) close() error {
+	if m == nil {
+		return nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.file.Close(); err != nil && m.err == nil {
+		m.err = fmt.Errorf("Failed to close manifest file: %w", err)
+	}
+	return m.err
+}
+
+// readManifest reads all the entries from the manifest at the given path
+func readManifest(path string) ([]manifestEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open manifest file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var entries []manifestEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry manifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("Failed to parse manifest file %s: %w", path, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read manifest file %s: %w", path, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+
+	merr "github.com/hashicorp/go-multierror"
+)
+
+// workerPool executes submitted operations using a bounded number of goroutines
+// and aggregates any errors returned by those operations.
+type workerPool struct {
+	work    chan func() error
+	pending sync.WaitGroup
+	workers sync.WaitGroup
+
+	errLock sync.Mutex
+	err     error
+}
+
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+
+	p := &workerPool{
+		work: make(chan func() error),
+	}
+
+	for i := 0; i < size; i++ {
+		p.workers.Add(1)
+		go p.run()
+	}
+
+	return p
+}
+
+func (p *workerPool) run() {
+	defer p.workers.Done()
+
+	for op := range p.work {
+		if err := op(); err != nil {
+			p.errLock.Lock()
+			p.err = merr.Append(p.err, err)
+			p.errLock.Unlock()
+		}
+		p.pending.Done()
+	}
+}
+
+// submit queues the operation for execution, blocking until a worker picks it up.
+func (p *workerPool) submit(op func() error) {
+	p.pending.Add(1)
+	p.work <- op
+}
+
+// submitAsync queues the operation for execution without blocking the caller. This
+// must be used when submitting work from within another operation as blocking there
+// could deadlock the pool when all workers are busy.
+func (p *workerPool) submitAsync(op func() error) {
+	p.pending.Add(1)
+	go func() {
+		p.work <- op
+	}()
+}
+
+// wait blocks until all submitted operations, including any they submitted themselves,
+// have completed and then shuts down the workers. The pool must not be used afterwards.
+func (p *workerPool) wait() error {
+	p.pending.Wait()
+	close(p.work)
+	p.workers.Wait()
+
+	p.errLock.Lock()
+	defer p.errLock.Unlock()
+	return p.err
+}
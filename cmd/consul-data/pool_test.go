@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWorkerPool(t *testing.T) {
+	cases := map[string]struct {
+		size   int
+		ops    int
+		failAt map[int]bool
+	}{
+		"no errors":       {size: 4, ops: 100},
+		"single worker":   {size: 1, ops: 10},
+		"invalid size":    {size: 0, ops: 10},
+		"one error":       {size: 4, ops: 100, failAt: map[int]bool{42: true}},
+		"multiple errors": {size: 4, ops: 100, failAt: map[int]bool{1: true, 50: true, 99: true}},
+		"all errors":      {size: 2, ops: 3, failAt: map[int]bool{0: true, 1: true, 2: true}},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			pool := newWorkerPool(tc.size)
+
+			var ran int64
+			for i := 0; i < tc.ops; i++ {
+				i := i
+				pool.submit(func() error {
+					atomic.AddInt64(&ran, 1)
+					if tc.failAt[i] {
+						return errors.New("op failed")
+					}
+					return nil
+				})
+			}
+
+			err := pool.wait()
+			if ran != int64(tc.ops) {
+				t.Fatalf("expected %d ops to run but %d did", tc.ops, ran)
+			}
+
+			if len(tc.failAt) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if count := strings.Count(err.Error(), "op failed"); count != len(tc.failAt) {
+				t.Fatalf("expected %d errors but got %d: %v", len(tc.failAt), count, err)
+			}
+		})
+	}
+}
+
+func TestWorkerPool_SubmitAsync(t *testing.T) {
+	// every worker submits more work from within an op which must not deadlock
+	pool := newWorkerPool(2)
+
+	var ran int64
+	for i := 0; i < 10; i++ {
+		pool.submit(func() error {
+			atomic.AddInt64(&ran, 1)
+			for j := 0; j < 3; j++ {
+				pool.submitAsync(func() error {
+					atomic.AddInt64(&ran, 1)
+					return nil
+				})
+			}
+			return nil
+		})
+	}
+
+	if err := pool.wait(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ran != 40 {
+		t.Fatalf("expected 40 ops to run but %d did", ran)
+	}
+}
@@ -1,58 +1,85 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"math/rand"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/hashicorp/consul/api"
-	merr "github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/serf/coordinate"
 	"github.com/mitchellh/cli"
 	"github.com/mkeeler/consul-data/generate"
-)
-
-const (
-	txnMaxOps = 64
+	"github.com/mkeeler/consul-data/generate/acl"
+	"github.com/mkeeler/consul-data/generate/catalog"
+	"github.com/mkeeler/consul-data/generate/configentries"
+	"github.com/mkeeler/consul-data/generate/events"
+	"github.com/mkeeler/consul-data/generate/intentions"
+	"github.com/mkeeler/consul-data/generate/kv"
+	"github.com/mkeeler/consul-data/generate/preparedqueries"
+	"github.com/mkeeler/consul-data/generate/sessions"
 )
 
 type pushCommand struct {
-	ui         cli.Ui
-	configPath string
-	dataPath   string
-	outputPath string
-	randSeed   int64
-	parallel   int
-	quiet      bool
-	useTxn     bool
-	txnOps     int
+	ui             cli.Ui
+	configPath     string
+	dataPath       string
+	outputPath     string
+	outputFormat   string
+	outputCompress string
+	checkpointPath string
+	manifestPath   string
+	dryRun         bool
+	dryRunOutput   string
+	createTenancy  bool
+	renewSessions  time.Duration
+	eventRate      float64
+	randSeed       int64
+	quiet          bool
+
+	checkpoint *checkpoint
+	manifest   *manifest
+	renewer    *sessionRenewer
+	output     *dataOutput
 
-	flags *flag.FlagSet
-	http  *HTTPFlags
-	help  string
+	flags    *flag.FlagSet
+	http     *HTTPFlags
+	requests *requestFlags
+	help     string
 }
 
 func newPushCommand(ui cli.Ui) cli.Command {
 	c := &pushCommand{
-		ui: ui,
+		// resources are pushed from multiple goroutines
+		ui: &cli.ConcurrentUi{Ui: ui},
 	}
 
 	flags := flag.NewFlagSet("", flag.ContinueOnError)
 
-	flags.BoolVar(&c.useTxn, "txn", false, "Whether to use the transaction API for pushing data")
-	flags.IntVar(&c.txnOps, "txn-ops", txnMaxOps, "Number of operations to perform in each Txn")
 	flags.BoolVar(&c.quiet, "quiet", false, "Whether to suppress output of handling of individual resources")
-	flags.IntVar(&c.parallel, "parallel", 1, "Number of concurrent requests that can be made")
 	flags.Int64Var(&c.randSeed, "seed", 0, "Value to use to seed the pseudo-random number generator with instead of the current time")
 	flags.StringVar(&c.configPath, "config", "", "Path to the configuration to use for generating data")
 	flags.StringVar(&c.dataPath, "data", "", "Path to data generated by consul-data generate to use as the data source instead of generating new data")
 	flags.StringVar(&c.outputPath, "output", "", "Path to output the data file to if we generated it instead of loading it in")
+	flags.StringVar(&c.outputFormat, "output-format", generate.FormatJSON, fmt.Sprintf("Format to output the data file in. Must be either %q or %q", generate.FormatJSON, generate.FormatNDJSON))
+	flags.StringVar(&c.outputCompress, "output-compress", "", fmt.Sprintf("Compression to use for the data file. Must be one of %q, %q or %q. By default this is determined by whether the output path ends in .gz or .zst", generate.CompressionNone, generate.CompressionGzip, generate.CompressionZstd))
+	flags.BoolVar(&c.dryRun, "dry-run", false, "Whether to only output a summary of the requests that would be made to Consul instead of pushing any data")
+	flags.StringVar(&c.dryRunOutput, "dry-run-output", "", "Path to write every request that would be made during a dry run to as lines of JSON")
+	flags.BoolVar(&c.createTenancy, "create-tenancy", false, "Whether to create the admin partitions and namespaces used by the data before pushing any data into them. This requires Consul Enterprise")
+	flags.StringVar(&c.checkpointPath, "checkpoint", "", "Path to a file used to record which resources have been pushed. When the file already exists, resources it records as pushed are skipped which allows resuming an interrupted push of the same data")
+	flags.StringVar(&c.manifestPath, "manifest", "", "Path to a file which the IDs Consul assigns to created prepared queries and sessions are appended to. Prepared queries and sessions can only be deleted by consul-data cleanup when given this manifest")
+	flags.DurationVar(&c.renewSessions, "renew-sessions", 0, "How long to keep renewing the TTLs of pushed sessions for, starting once the first session is pushed, so that their locks remain held. The push only completes once this has passed")
+	flags.Float64Var(&c.eventRate, "event-rate", 0, "Maximum number of user events to fire per second. This applies in addition to the -rate limit. A value of 0 fires events as fast as the other limits allow")
 
 	c.http = &HTTPFlags{}
 	c.http.MergeAll(flags)
 
+	c.requests = &requestFlags{}
+	c.requests.MergeAll(flags)
+
 	c.flags = flags
 	c.help = genUsage(`Usage: consul-data push [OPTIONS]
 	
@@ -66,232 +93,1342 @@ func newPushCommand(ui cli.Ui) cli.Command {
 	return c
 }
 
-func (c *pushCommand) generateData() (*generate.Data, error) {
+func (c *pushCommand) generateConfig() (generate.Config, error) {
 	if c.randSeed == 0 {
 		c.randSeed = time.Now().UnixNano()
 	}
-	rand.Seed(c.randSeed)
-
-	conf := generate.DefaultConfig()
 
 	if c.configPath != "" {
-		var err error
-		conf, err = generate.ParseConfig(c.configPath)
+		return generate.ParseConfig(c.configPath)
+	}
+	return generate.DefaultConfig(), nil
+}
+
+// streamData hands each KV entry and node to the handler as it is either read from
+// the data file or generated.
+func (c *pushCommand) streamData(h generate.Handler) error {
+	if c.dataPath != "" {
+		return streamData(c.dataPath, h)
+	}
+
+	conf, err := c.generateConfig()
+	if err != nil {
+		return err
+	}
+	return generate.StreamAll(conf, c.randSeed, h)
+}
+
+func (c *pushCommand) newTxnManagers(client txnWriter, pool *workerPool, resources *int64) *txnManagers {
+	return c.requests.newTxnManagers(client, pool, func(ops api.TxnOps) {
+		atomic.AddInt64(resources, int64(len(ops)))
+		for _, op := range ops {
+			if entry, ok := txnOpCheckpoint(op); ok {
+				c.checkpoint.record(entry)
+			}
+		}
+	})
+}
+
+func (c *pushCommand) pushData() error {
+	if c.dryRun {
+		return c.dryRunData()
+	}
+
+	client, err := newAPIClient(c.http)
+	if err != nil {
+		return fmt.Errorf("Failed to create Consul API client: %w", err)
+	}
+
+	c.requests.init()
+	defer func() {
+		c.ui.Info(fmt.Sprintf("Requests Retried: %d", c.requests.retriedRequests()))
+	}()
+
+	if c.checkpointPath != "" {
+		c.checkpoint, err = openCheckpoint(c.checkpointPath)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		defer c.closeCheckpoint()
+
+		if completed := c.checkpoint.size(); completed > 0 {
+			c.ui.Info(fmt.Sprintf("Skipping %d resources already pushed according to the checkpoint", completed))
+		}
+
+		// Ensure progress gets saved when interrupted.
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(signals)
+		go func() {
+			if _, ok := <-signals; ok {
+				c.closeCheckpoint()
+				os.Exit(1)
+			}
+		}()
+	}
+
+	if c.manifestPath != "" {
+		c.manifest, err = openManifest(c.manifestPath)
+		if err != nil {
+			return err
 		}
+		defer func() {
+			if err := c.manifest.close(); err != nil {
+				c.ui.Error(err.Error())
+			}
+		}()
+	}
+
+	resources, err := c.pushAll(client.KV(), client.Catalog(), client.Txn(), &apiTenancyWriter{client: client}, client.ACL(), client.ConfigEntries(), client.PreparedQuery(), &apiSessionWriter{client: client}, client.Coordinate(), client.Event())
+	if err != nil {
+		return err
+	}
+
+	if c.renewer != nil {
+		c.renewer.wait()
 	}
 
-	return generate.GenerateAll(conf)
+	c.ui.Info(fmt.Sprintf("Total Resources Created: %d", resources))
+	return nil
 }
 
-func (c *pushCommand) getData() (*generate.Data, error) {
-	if c.dataPath != "" {
-		return loadData(c.dataPath)
+// dryRunData goes through all the steps of pushing the data but without making
+// any requests to Consul and then summarizes the requests that would have been made.
+func (c *pushCommand) dryRunData() error {
+	dryRun, err := newDryRun(c.dryRunOutput)
+	if err != nil {
+		return err
+	}
+
+	resources, err := c.pushAll(dryRun, dryRun, dryRun, dryRun, dryRun, dryRun, dryRun, dryRun, dryRun, dryRun)
+	if closeErr := dryRun.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	dryRun.summarize(c.ui)
+	c.ui.Info(fmt.Sprintf("Total Resources That Would Be Created: %d", resources))
+	return nil
+}
+
+// pushAll streams all the data to a pusher, additionally writing it to the output
+// file when one was requested.
+func (c *pushCommand) pushAll(kvClient kvWriter, catalogClient catalogWriter, txnClient txnWriter, tenancyClient tenancyWriter, aclClient aclWriter, configEntryClient configEntryWriter, preparedQueryClient preparedQueryWriter, sessionClient sessionWriter, coordinateClient coordinateWriter, eventClient eventWriter) (int64, error) {
+	p := &pusher{
+		c:                   c,
+		kvClient:            kvClient,
+		catalogClient:       catalogClient,
+		txnClient:           txnClient,
+		tenancyClient:       tenancyClient,
+		aclClient:           aclClient,
+		configEntryClient:   configEntryClient,
+		preparedQueryClient: preparedQueryClient,
+		sessionClient:       sessionClient,
+		coordinateClient:    coordinateClient,
+		eventClient:         eventClient,
+		tenancy:             make(map[tenancyKey]struct{}),
+	}
+
+	h := p.handler()
+	if c.output != nil {
+		// data is written out before being pushed so that the output describes
+		// everything which may have been created even if the push fails
+		h = generate.Tee(c.output.Handler(), h)
+	}
+
+	err := c.streamData(h)
+	if finishErr := p.finishPhase(); err == nil {
+		err = finishErr
 	}
-	return c.generateData()
+	p.reportDeniedWrites()
+	return p.resources, err
+}
+
+func (c *pushCommand) closeCheckpoint() {
+	if err := c.checkpoint.close(); err != nil {
+		c.ui.Error(err.Error())
+	}
+}
+
+// kvWriter is the part of the Consul KV API used to push data.
+type kvWriter interface {
+	Put(p *api.KVPair, q *api.WriteOptions) (*api.WriteMeta, error)
+}
+
+// catalogWriter is the part of the Consul Catalog API used to push data.
+type catalogWriter interface {
+	Register(reg *api.CatalogRegistration, q *api.WriteOptions) (*api.WriteMeta, error)
+}
+
+// aclWriter is the part of the Consul ACL API used to push data. Resources are read
+// to check whether a create which appeared to fail had succeeded before retrying it.
+type aclWriter interface {
+	PolicyCreate(policy *api.ACLPolicy, q *api.WriteOptions) (*api.ACLPolicy, *api.WriteMeta, error)
+	RoleCreate(role *api.ACLRole, q *api.WriteOptions) (*api.ACLRole, *api.WriteMeta, error)
+	TokenCreate(token *api.ACLToken, q *api.WriteOptions) (*api.ACLToken, *api.WriteMeta, error)
+	PolicyReadByName(policyName string, q *api.QueryOptions) (*api.ACLPolicy, *api.QueryMeta, error)
+	RoleReadByName(roleName string, q *api.QueryOptions) (*api.ACLRole, *api.QueryMeta, error)
+	TokenRead(accessorID string, q *api.QueryOptions) (*api.ACLToken, *api.QueryMeta, error)
+}
+
+// configEntryWriter is the part of the Consul config entries API used to push data.
+type configEntryWriter interface {
+	Set(entry api.ConfigEntry, q *api.WriteOptions) (bool, *api.WriteMeta, error)
+}
+
+// coordinateWriter is the part of the Consul coordinate API used to push data.
+type coordinateWriter interface {
+	Update(coord *api.CoordinateEntry, q *api.WriteOptions) (*api.WriteMeta, error)
+}
+
+// eventWriter is the part of the Consul event API used to fire user events.
+type eventWriter interface {
+	Fire(event *api.UserEvent, q *api.WriteOptions) (string, *api.WriteMeta, error)
+}
+
+// preparedQueryWriter is the part of the Consul prepared query API used to push data.
+// Queries are listed to check whether a create which appeared to fail had succeeded
+// before retrying it.
+type preparedQueryWriter interface {
+	Create(query *api.PreparedQueryDefinition, q *api.WriteOptions) (string, *api.WriteMeta, error)
+	List(q *api.QueryOptions) ([]*api.PreparedQueryDefinition, *api.QueryMeta, error)
+}
+
+const (
+	pushPhaseNone = iota
+	pushPhaseKV
+	pushPhaseCatalog
+	pushPhaseCoordinates
+	pushPhaseACLPolicies
+	pushPhaseACLRoles
+	pushPhaseACLTokens
+	pushPhaseProxyDefaults
+	pushPhaseServiceDefaults
+	pushPhaseServiceResolvers
+	pushPhaseServiceSplitters
+	pushPhaseServiceRouters
+	pushPhaseIntentions
+	pushPhasePreparedQueries
+	pushPhaseSessions
+	pushPhaseEvents
+)
+
+// configEntryPhases are the phases which each kind of generated config entry is pushed
+// in. Each kind has its own phase so that entries are only written once everything
+// they refer to has been.
+var configEntryPhases = map[string]int{
+	configentries.KindProxyDefaults:   pushPhaseProxyDefaults,
+	configentries.KindServiceDefaults: pushPhaseServiceDefaults,
+	configentries.KindServiceResolver: pushPhaseServiceResolvers,
+	configentries.KindServiceSplitter: pushPhaseServiceSplitters,
+	configentries.KindServiceRouter:   pushPhaseServiceRouters,
+}
+
+// configEntryPhaseKinds maps the phases of config entries back to their kind
+var configEntryPhaseKinds = map[int]string{
+	pushPhaseProxyDefaults:    configentries.KindProxyDefaults,
+	pushPhaseServiceDefaults:  configentries.KindServiceDefaults,
+	pushPhaseServiceResolvers: configentries.KindServiceResolver,
+	pushPhaseServiceSplitters: configentries.KindServiceSplitter,
+	pushPhaseServiceRouters:   configentries.KindServiceRouter,
+}
+
+// pusher pushes data to Consul as it is streamed to it so that the data never has
+// to be held in memory. Each type of data is pushed in a separate phase, each with
+// its own worker pool, and all requests of one phase complete before the next begins.
+// This ensures that ACL roles and tokens are only created after what they link to and
+// that config entries are only written after those they refer to.
+type pusher struct {
+	c                   *pushCommand
+	kvClient            kvWriter
+	catalogClient       catalogWriter
+	txnClient           txnWriter
+	tenancyClient       tenancyWriter
+	aclClient           aclWriter
+	configEntryClient   configEntryWriter
+	preparedQueryClient preparedQueryWriter
+	sessionClient       sessionWriter
+	coordinateClient    coordinateWriter
+	eventClient         eventWriter
+
+	// writes which were denied due to the permissions of their token, how many of
+	// them were expected to be and how many writes were expected to be denied overall
+	deniedWrites         int64
+	deniedExpectedWrites int64
+	expectedDeniedWrites int64
+
+	// locks which sessions failed to acquire as they were held by another session
+	failedLocks int64
+
+	// events is how many events have been streamed so far, which identifies each in
+	// the checkpoint, and firedEvents how many of them were fired. eventLimiter
+	// limits the rate at which they are fired.
+	events       int
+	firedEvents  int64
+	eventLimiter *rateLimiter
+
+	// the partitions and namespaces created or found to exist so far
+	tenancy map[tenancyKey]struct{}
+
+	// the coordinates of the nodes pushed in the catalog phase which are updated
+	// once all the nodes have been registered or maxPendingCoordinates are pending
+	coordinates []*coordinateUpdate
+
+	resources int64
+	phase     int
+	pool      *workerPool
+	txn       *txnManagers
 }
 
-type txnManager struct {
-	client *api.Txn
-	ops    api.TxnOps
-	maxOps int
+func (p *pusher) handler() generate.Handler {
+	return generate.Handler{
+		KV:            p.pushKV,
+		Node:          p.pushNode,
+		ACLPolicy:     p.pushACLPolicy,
+		ACLRole:       p.pushACLRole,
+		ACLToken:      p.pushACLToken,
+		ConfigEntry:   p.pushGeneratedConfigEntry,
+		Intentions:    p.pushIntentions,
+		PreparedQuery: p.pushPreparedQuery,
+		Session:       p.pushSession,
+		Event:         p.pushEvent,
+	}
 }
 
-func (m *txnManager) addOp(op *api.TxnOp) error {
-	m.ops = append(m.ops, op)
-	if len(m.ops) < m.maxOps {
+func (p *pusher) startPhase(phase int) error {
+	if p.phase == phase {
 		return nil
 	}
 
-	err := m.finish()
-	m.ops = nil
-	return err
+	if err := p.finishPhase(); err != nil {
+		return err
+	}
+
+	p.phase = phase
+	p.pool = p.c.requests.newPool()
+	p.txn = nil
+	// only KV and catalog data can be written within transactions
+	if p.c.requests.useTxn && (phase == pushPhaseKV || phase == pushPhaseCatalog) {
+		p.txn = p.c.newTxnManagers(p.txnClient, p.pool, &p.resources)
+	}
+
+	switch phase {
+	case pushPhaseKV:
+		p.c.ui.Info("Pushing KV data to Consul")
+	case pushPhaseCatalog:
+		p.c.ui.Info("Pushing Catalog data to Consul")
+	case pushPhaseCoordinates:
+		p.c.ui.Info("Pushing node coordinates to Consul")
+	case pushPhaseACLPolicies:
+		p.c.ui.Info("Pushing ACL policies to Consul")
+	case pushPhaseACLRoles:
+		p.c.ui.Info("Pushing ACL roles to Consul")
+	case pushPhaseACLTokens:
+		p.c.ui.Info("Pushing ACL tokens to Consul")
+	case pushPhaseIntentions:
+		p.c.ui.Info("Pushing intentions to Consul")
+	case pushPhasePreparedQueries:
+		p.c.ui.Info("Pushing prepared queries to Consul")
+		if p.c.manifest == nil && !p.c.dryRun {
+			p.c.ui.Warn("Prepared queries are being pushed without -manifest so consul-data cleanup won't be able to delete them")
+		}
+	case pushPhaseSessions:
+		p.c.ui.Info("Pushing sessions to Consul")
+		if p.c.manifest == nil && !p.c.dryRun {
+			p.c.ui.Warn("Sessions are being pushed without -manifest so consul-data cleanup won't be able to destroy them")
+		}
+		if p.c.renewSessions > 0 && !p.c.dryRun {
+			p.c.renewer = startSessionRenewer(p.sessionClient, p.c.requests, p.c.ui, p.c.renewSessions)
+		}
+	case pushPhaseEvents:
+		p.c.ui.Info("Firing user events")
+		if !p.c.dryRun {
+			p.eventLimiter = newRateLimiter(p.c.eventRate, 1, 0)
+		}
+	default:
+		if kind, ok := configEntryPhaseKinds[phase]; ok {
+			p.c.ui.Info(fmt.Sprintf("Pushing %s config entries to Consul", kind))
+		}
+	}
+	return nil
 }
 
-func (m *txnManager) finish() error {
-	if len(m.ops) > 0 {
-		_, resp, _, err := m.client.Txn(m.ops, nil)
-		if err != nil {
-			return err
+// finishPhase waits for all requests of the current phase to complete.
+func (p *pusher) finishPhase() error {
+	phase := p.phase
+	if phase == pushPhaseNone {
+		return nil
+	}
+	p.phase = pushPhaseNone
+
+	if p.txn != nil {
+		p.txn.flush()
+	}
+
+	if err := p.pool.wait(); err != nil {
+		return err
+	}
+
+	switch phase {
+	case pushPhaseKV:
+		p.c.ui.Info("Finished pushing KV data to Consul")
+	case pushPhaseCatalog:
+		p.c.ui.Info("Finished pushing Catalog data to Consul")
+		return p.pushCoordinates()
+	case pushPhaseCoordinates:
+		p.c.ui.Info("Finished pushing node coordinates to Consul")
+	case pushPhaseACLPolicies:
+		p.c.ui.Info("Finished pushing ACL policies to Consul")
+	case pushPhaseACLRoles:
+		p.c.ui.Info("Finished pushing ACL roles to Consul")
+	case pushPhaseACLTokens:
+		p.c.ui.Info("Finished pushing ACL tokens to Consul")
+	case pushPhaseIntentions:
+		p.c.ui.Info("Finished pushing intentions to Consul")
+	case pushPhasePreparedQueries:
+		p.c.ui.Info("Finished pushing prepared queries to Consul")
+	case pushPhaseSessions:
+		p.c.ui.Info("Finished pushing sessions to Consul")
+		if p.failedLocks > 0 {
+			p.c.ui.Warn(fmt.Sprintf("%d locks could not be acquired by their sessions", p.failedLocks))
 		}
+	case pushPhaseEvents:
+		p.c.ui.Info(fmt.Sprintf("Finished firing %d user events", p.firedEvents))
+	default:
+		if kind, ok := configEntryPhaseKinds[phase]; ok {
+			p.c.ui.Info(fmt.Sprintf("Finished pushing %s config entries to Consul", kind))
+		}
+	}
+	return nil
+}
+
+// expectWrite records whether a write is expected to be denied
+func (p *pusher) expectWrite(expectDenied bool) {
+	if expectDenied {
+		atomic.AddInt64(&p.expectedDeniedWrites, 1)
+	}
+}
+
+// writeDenied records a write which was denied due to the permissions of its token
+func (p *pusher) writeDenied(expectDenied bool) {
+	atomic.AddInt64(&p.deniedWrites, 1)
+	if expectDenied {
+		atomic.AddInt64(&p.deniedExpectedWrites, 1)
+	}
+}
 
-		for _, txnErr := range resp.Errors {
-			err = merr.Append(err, fmt.Errorf("Failed to apply operation %d: %s", txnErr.OpIndex, txnErr.What))
+func (p *pusher) reportDeniedWrites() {
+	c := p.c
+	if c.dryRun {
+		if p.expectedDeniedWrites > 0 {
+			c.ui.Info(fmt.Sprintf("Writes Expected To Be Denied: %d", p.expectedDeniedWrites))
 		}
+		return
+	}
+
+	if p.deniedWrites == 0 && p.expectedDeniedWrites == 0 {
+		return
+	}
+
+	c.ui.Info(fmt.Sprintf("Writes Denied: %d (Expected: %d)", p.deniedWrites, p.expectedDeniedWrites))
+	if unexpected := p.deniedWrites - p.deniedExpectedWrites; unexpected > 0 {
+		c.ui.Warn(fmt.Sprintf("%d writes were denied which were expected to be allowed", unexpected))
+	}
+	if allowed := p.expectedDeniedWrites - p.deniedExpectedWrites; allowed > 0 {
+		c.ui.Warn(fmt.Sprintf("%d writes were allowed which were expected to be denied", allowed))
+	}
+}
+
+func (p *pusher) pushKV(key string, value kv.Value) error {
+	c := p.c
+	if c.checkpoint.completed(kvCheckpoint(key)) {
+		return nil
+	}
+
+	if err := p.startPhase(pushPhaseKV); err != nil {
+		return err
+	}
 
+	if err := p.ensureTenancy(value.Datacenter, value.Partition, value.Namespace); err != nil {
 		return err
 	}
+
+	if !c.quiet {
+		c.ui.Output(fmt.Sprintf("   Key: %s", key))
+	}
+
+	// a transaction is made with a single token so entries with their own are written individually
+	if p.txn != nil && value.Token == "" {
+		p.txn.get(value.Datacenter).addOp(&api.TxnOp{
+			KV: &api.KVTxnOp{
+				Verb:      api.KVSet,
+				Key:       key,
+				Value:     []byte(value.Value),
+				Flags:     uint64(value.Flags),
+				Namespace: value.Namespace,
+				Partition: value.Partition,
+			},
+		})
+		return nil
+	}
+
+	pair := api.KVPair{
+		Key:       key,
+		Value:     []byte(value.Value),
+		Flags:     uint64(value.Flags),
+		Namespace: value.Namespace,
+		Partition: value.Partition,
+	}
+
+	// the KV API only takes the namespace and partition from the options
+	opts := api.WriteOptions{
+		Datacenter: value.Datacenter,
+		Namespace:  value.Namespace,
+		Partition:  value.Partition,
+		Token:      value.Token,
+	}
+
+	p.expectWrite(value.ExpectDenied)
+	p.pool.submit(func() error {
+		err := c.requests.do(func() error {
+			_, err := p.kvClient.Put(&pair, &opts)
+			return err
+		})
+		if err != nil && isPermissionDenied(err) {
+			p.writeDenied(value.ExpectDenied)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to push key %s: %w", key, err)
+		}
+		atomic.AddInt64(&p.resources, 1)
+		c.checkpoint.record(kvCheckpoint(key))
+		return nil
+	})
 	return nil
 }
 
-func (c *pushCommand) pushData(data *generate.Data) error {
-	client, err := c.http.APIClient()
-	if err != nil {
-		return fmt.Errorf("Failed to create Consul API client: %w", err)
+func agentService(node *catalog.Node, instance *catalog.ServiceInstance) *api.AgentService {
+	svc := &api.AgentService{
+		Kind:      api.ServiceKind(instance.Kind),
+		ID:        instance.ID,
+		Service:   instance.Name,
+		Address:   instance.Address,
+		Port:      instance.Port,
+		Tags:      instance.Tags,
+		Meta:      instance.Meta,
+		Namespace: instance.Namespace,
+		Partition: node.Partition,
+	}
+
+	if instance.Proxy != nil {
+		svc.Proxy = &api.AgentServiceConnectProxyConfig{
+			DestinationServiceName: instance.Proxy.DestinationServiceName,
+			DestinationServiceID:   instance.Proxy.DestinationServiceID,
+			LocalServicePort:       instance.Proxy.LocalServicePort,
+		}
+
+		for _, upstream := range instance.Proxy.Upstreams {
+			svc.Proxy.Upstreams = append(svc.Proxy.Upstreams, api.Upstream{
+				DestinationType: api.UpstreamDestTypeService,
+				DestinationName: upstream.DestinationName,
+				LocalBindPort:   upstream.LocalBindPort,
+			})
+		}
+	}
+	return svc
+}
+
+func healthCheck(node *catalog.Node, instance *catalog.ServiceInstance, check *catalog.Check) *api.HealthCheck {
+	hc := &api.HealthCheck{
+		Node:      node.Name,
+		CheckID:   check.CheckID,
+		Name:      check.Name,
+		Status:    check.Status,
+		Notes:     check.Notes,
+		Output:    check.Output,
+		Partition: node.Partition,
+	}
+
+	if instance != nil {
+		hc.ServiceID = instance.ID
+		hc.ServiceName = instance.Name
+		hc.Namespace = instance.Namespace
+	}
+	return hc
+}
+
+// pendingChecks returns the checks of the node or service instance which have not
+// already been pushed according to the checkpoint.
+func (c *pushCommand) pendingChecks(node *catalog.Node, instance *catalog.ServiceInstance, checks []*catalog.Check) api.HealthChecks {
+	var pending api.HealthChecks
+	for _, check := range checks {
+		if c.checkpoint.completed(checkCheckpoint(node.Name, check.CheckID)) {
+			continue
+		}
+		pending = append(pending, healthCheck(node, instance, check))
+	}
+	return pending
+}
+
+func (c *pushCommand) recordChecks(checks api.HealthChecks) {
+	for _, check := range checks {
+		c.checkpoint.record(checkCheckpoint(check.Node, check.CheckID))
+	}
+}
+
+func (p *pusher) pushNode(node *catalog.Node) error {
+	// the nodes registered so far are finished along with their coordinates so that
+	// the pending coordinates don't grow with the size of the catalog
+	if len(p.coordinates) >= maxPendingCoordinates {
+		if err := p.finishPhase(); err != nil {
+			return err
+		}
+	}
+
+	if err := p.startPhase(pushPhaseCatalog); err != nil {
+		return err
+	}
+
+	if err := p.ensureTenancy(node.Datacenter, node.Partition, ""); err != nil {
+		return err
+	}
+	for _, service := range node.Services {
+		for _, instance := range service.Instances {
+			if err := p.ensureTenancy(node.Datacenter, node.Partition, instance.Namespace); err != nil {
+				return err
+			}
+		}
+	}
+
+	if node.Coordinate != nil && !node.ExpectDenied && !p.c.checkpoint.completed(coordinateCheckpoint(node.Name)) {
+		p.coordinates = append(p.coordinates, newCoordinateUpdate(node))
+	}
+
+	// a transaction is made with a single token so nodes with their own are registered individually
+	if p.txn != nil && node.Token == "" {
+		p.pushNodeTxn(node)
+		return nil
 	}
 
-	resources := 0
+	c := p.c
+	nodeCompleted := c.checkpoint.completed(nodeCheckpoint(node.Name))
+	if !nodeCompleted && !c.quiet {
+		c.ui.Output(fmt.Sprintf("   Node: %s", node.Name))
+	}
 
-	var txn txnManager
-	if c.useTxn {
-		txn.client = client.Txn()
-		txn.maxOps = c.txnOps
+	// the services of a node can't be registered when the node itself is denied
+	opts := api.WriteOptions{Token: node.Token}
+	if !nodeCompleted {
+		p.expectWrite(node.ExpectDenied)
 	}
+	p.pool.submit(func() error {
+		// node checks get registered along with the node
+		checks := c.pendingChecks(node, nil, node.Checks)
+		if !nodeCompleted || len(checks) > 0 {
+			nodeRegistration := api.CatalogRegistration{
+				ID:             node.ID,
+				Node:           node.Name,
+				Address:        node.Address,
+				NodeMeta:       node.Meta,
+				Datacenter:     node.Datacenter,
+				Partition:      node.Partition,
+				SkipNodeUpdate: nodeCompleted,
+				Checks:         checks,
+			}
 
-	c.ui.Info("Pushing KV data to Consul")
-	kv := client.KV()
+			err := c.requests.do(func() error {
+				_, err := p.catalogClient.Register(&nodeRegistration, &opts)
+				return err
+			})
+			if err != nil && isPermissionDenied(err) {
+				p.writeDenied(node.ExpectDenied && !nodeCompleted)
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("Failed to push Node %s: %w", node.Name, err)
+			}
 
-	if len(data.KV) > 0 {
-		for key, value := range data.KV {
+			created := int64(len(checks))
+			if !nodeCompleted {
+				created += 1
+				c.checkpoint.record(nodeCheckpoint(node.Name))
+			}
+			atomic.AddInt64(&p.resources, created)
+			c.recordChecks(checks)
+		}
+
+		// services can only be registered once their node exists
+		for _, service := range node.Services {
 			if !c.quiet {
-				c.ui.Output(fmt.Sprintf("   Key: %s", key))
+				c.ui.Output(fmt.Sprintf("      Service: %s (Node: %s)", service.Name, node.Name))
 			}
 
-			if c.useTxn {
-				op := api.TxnOp{
-					KV: &api.KVTxnOp{
-						Verb:      api.KVSet,
-						Key:       key,
-						Value:     []byte(value.Value),
-						Flags:     uint64(value.Flags),
-						Namespace: value.Namespace,
-					},
+			for _, instance := range service.Instances {
+				entry := serviceCheckpoint(node.Name, instance.ID)
+				serviceCompleted := c.checkpoint.completed(entry)
+				checks := c.pendingChecks(node, instance, instance.Checks)
+				if serviceCompleted && len(checks) == 0 {
+					continue
 				}
-				err := txn.addOp(&op)
-				if err != nil {
-					return fmt.Errorf("Failed to push txn: %w", err)
+
+				serviceRegistration := api.CatalogRegistration{
+					ID:             node.ID,
+					Node:           node.Name,
+					Datacenter:     node.Datacenter,
+					Partition:      node.Partition,
+					SkipNodeUpdate: true,
+					Checks:         checks,
 				}
-			} else {
-				pair := api.KVPair{
-					Key:       key,
-					Value:     []byte(value.Value),
-					Flags:     uint64(value.Flags),
-					Namespace: value.Namespace,
+				if !serviceCompleted {
+					serviceRegistration.Service = agentService(node, instance)
 				}
 
-				opts := api.WriteOptions{
-					Datacenter: value.Datacenter,
-					Token:      value.Token,
-				}
+				serviceName := service.Name
+				p.pool.submitAsync(func() error {
+					err := c.requests.do(func() error {
+						_, err := p.catalogClient.Register(&serviceRegistration, &opts)
+						return err
+					})
+					if err != nil && isPermissionDenied(err) {
+						p.writeDenied(false)
+						return nil
+					}
+					if err != nil {
+						return fmt.Errorf("Failed to push Service %s for node %s: %w", serviceName, node.Name, err)
+					}
 
-				_, err := kv.Put(&pair, &opts)
-				if err != nil {
-					return fmt.Errorf("Failed to push key %s: %w", key, err)
-				}
+					created := int64(len(checks))
+					if !serviceCompleted {
+						created += 1
+						c.checkpoint.record(entry)
+					}
+					atomic.AddInt64(&p.resources, created)
+					c.recordChecks(checks)
+					return nil
+				})
 			}
-			resources += 1
 		}
-		if c.useTxn {
-			err := txn.finish()
+		return nil
+	})
+	return nil
+}
+
+// maxPendingCoordinates is the most coordinates held in memory before they are pushed
+const maxPendingCoordinates = 10000
+
+// coordinateUpdate is the coordinate of a single node to be pushed
+type coordinateUpdate struct {
+	entry *api.CoordinateEntry
+	opts  api.WriteOptions
+}
+
+func newCoordinateUpdate(node *catalog.Node) *coordinateUpdate {
+	return &coordinateUpdate{
+		entry: &api.CoordinateEntry{
+			Node:      node.Name,
+			Partition: node.Partition,
+			Coord: &coordinate.Coordinate{
+				Vec:        node.Coordinate.Vec,
+				Error:      node.Coordinate.Error,
+				Adjustment: node.Coordinate.Adjustment,
+				Height:     node.Coordinate.Height,
+			},
+		},
+		opts: api.WriteOptions{Datacenter: node.Datacenter, Token: node.Token},
+	}
+}
+
+// pushCoordinates updates the coordinates of the nodes pushed during the catalog phase.
+// This happens in a phase of its own as Consul rejects the coordinates of nodes which
+// haven't been registered yet.
+func (p *pusher) pushCoordinates() error {
+	updates := p.coordinates
+	p.coordinates = nil
+	if len(updates) == 0 {
+		return nil
+	}
+
+	if err := p.startPhase(pushPhaseCoordinates); err != nil {
+		return err
+	}
+
+	c := p.c
+	for _, update := range updates {
+		update := update
+		p.pool.submit(func() error {
+			err := c.requests.do(func() error {
+				_, err := p.coordinateClient.Update(update.entry, &update.opts)
+				return err
+			})
+			if err != nil && isPermissionDenied(err) {
+				p.writeDenied(false)
+				return nil
+			}
 			if err != nil {
-				return fmt.Errorf("Failed to push txn: %w", err)
+				return fmt.Errorf("Failed to push coordinate of Node %s: %w", update.entry.Node, err)
 			}
-		}
-		c.ui.Info("Finished pushing KV data to Consul")
+			atomic.AddInt64(&p.resources, 1)
+			c.checkpoint.record(coordinateCheckpoint(update.entry.Node))
+			return nil
+		})
 	}
+	return p.finishPhase()
+}
 
-	if len(data.Catalog) > 0 {
-		c.ui.Info("Pushing Catalog data to Consul")
-		catalog := client.Catalog()
-		for _, node := range data.Catalog {
-			if !c.quiet {
-				c.ui.Output(fmt.Sprintf("   Node: %s", node.Name))
-			}
+func checkTxnOps(checks api.HealthChecks) api.TxnOps {
+	ops := make(api.TxnOps, 0, len(checks))
+	for _, check := range checks {
+		ops = append(ops, &api.TxnOp{
+			Check: &api.CheckTxnOp{
+				Verb:  api.CheckSet,
+				Check: *check,
+			},
+		})
+	}
+	return ops
+}
 
-			if c.useTxn {
-				op := api.TxnOp{
-					Node: &api.NodeTxnOp{
-						Verb: api.NodeSet,
-						Node: api.Node{
-							ID:         node.ID,
-							Node:       node.Name,
-							Address:    node.Address,
-							Meta:       node.Meta,
-							Datacenter: node.Datacenter,
-						},
-					},
-				}
+func (p *pusher) pushNodeTxn(node *catalog.Node) {
+	c := p.c
 
-				if err := txn.addOp(&op); err != nil {
-					return fmt.Errorf("Failed to push txn: %w", err)
-				}
-			} else {
-				nodeRegistration := api.CatalogRegistration{
+	// Everything for a new node is applied in order after the node itself. When the
+	// node already exists only the checks of each service instance depend on the
+	// instance itself.
+	var nodeOps api.TxnOps
+	nodeCompleted := c.checkpoint.completed(nodeCheckpoint(node.Name))
+	if !nodeCompleted {
+		if !c.quiet {
+			c.ui.Output(fmt.Sprintf("   Node: %s", node.Name))
+		}
+
+		nodeOps = append(nodeOps, &api.TxnOp{
+			Node: &api.NodeTxnOp{
+				Verb: api.NodeSet,
+				Node: api.Node{
 					ID:         node.ID,
 					Node:       node.Name,
 					Address:    node.Address,
-					NodeMeta:   node.Meta,
+					Meta:       node.Meta,
 					Datacenter: node.Datacenter,
-				}
+					Partition:  node.Partition,
+				},
+			},
+		})
+	}
+	nodeOps = append(nodeOps, checkTxnOps(c.pendingChecks(node, nil, node.Checks))...)
 
-				_, err := catalog.Register(&nodeRegistration, nil)
-				if err != nil {
-					return fmt.Errorf("Failed to push Node %s: %w", node.Name, err)
-				}
+	var groups []api.TxnOps
+	for _, service := range node.Services {
+		for _, instance := range service.Instances {
+			var ops api.TxnOps
+			if !c.checkpoint.completed(serviceCheckpoint(node.Name, instance.ID)) {
+				ops = append(ops, &api.TxnOp{
+					Service: &api.ServiceTxnOp{
+						Verb:    api.ServiceSet,
+						Node:    node.Name,
+						Service: *agentService(node, instance),
+					},
+				})
 			}
+			ops = append(ops, checkTxnOps(c.pendingChecks(node, instance, instance.Checks))...)
+
+			if len(ops) > 0 {
+				groups = append(groups, ops)
+			}
+		}
+	}
 
-			resources += 1
+	txn := p.txn.get(node.Datacenter)
+	if !nodeCompleted {
+		for _, ops := range groups {
+			nodeOps = append(nodeOps, ops...)
+		}
+		txn.addOps(nodeOps)
+		return
+	}
 
-			for _, service := range node.Services {
-				if !c.quiet {
-					c.ui.Output(fmt.Sprintf("      Service: %s", service.Name))
-				}
+	for _, op := range nodeOps {
+		txn.addOp(op)
+	}
+	for _, ops := range groups {
+		txn.addOps(ops)
+	}
+}
 
-				for _, instance := range service.Instances {
-					if c.useTxn {
-						op := api.TxnOp{
-							Service: &api.ServiceTxnOp{
-								Verb: api.ServiceSet,
-								Node: node.Name,
-								Service: api.AgentService{
-									ID:      instance.ID,
-									Service: instance.Name,
-									Address: instance.Address,
-									Port:    instance.Port,
-									Meta:    instance.Meta,
-								},
-							},
-						}
-
-						err := txn.addOp(&op)
-						if err != nil {
-							return fmt.Errorf("Failed to push txn: %w", err)
-						}
-					} else {
-						serviceRegistration := api.CatalogRegistration{
-							ID:             node.ID,
-							Node:           node.Name,
-							Datacenter:     node.Datacenter,
-							SkipNodeUpdate: true,
-							Service: &api.AgentService{
-								ID:      instance.ID,
-								Service: instance.Name,
-								Address: instance.Address,
-								Port:    instance.Port,
-								Meta:    instance.Meta,
-							},
-						}
-
-						_, err := catalog.Register(&serviceRegistration, nil)
-						if err != nil {
-							return fmt.Errorf("Failed to push Service %s for node %s: %w", service.Name, node.Name, err)
-						}
-					}
-					resources += 1
+// pushACL submits a request creating a single ACL resource unless the checkpoint
+// records it as already pushed. Found looks the resource up so that a retried create
+// which had already succeeded isn't treated as a conflict.
+func (p *pusher) pushACL(phase int, entry checkpointEntry, desc string, create func() error, found func() (bool, error)) error {
+	c := p.c
+	if c.checkpoint.completed(entry) {
+		return nil
+	}
+
+	if err := p.startPhase(phase); err != nil {
+		return err
+	}
+
+	if !c.quiet {
+		c.ui.Output(fmt.Sprintf("   %s", desc))
+	}
+
+	p.pool.submit(func() error {
+		if err := c.requests.doCreate(create, found); err != nil {
+			return fmt.Errorf("Failed to push %s: %w", desc, err)
+		}
+		atomic.AddInt64(&p.resources, 1)
+		c.checkpoint.record(entry)
+		return nil
+	})
+	return nil
+}
+
+func (p *pusher) pushACLPolicy(policy *acl.Policy) error {
+	apiPolicy := api.ACLPolicy{
+		Name:  policy.Name,
+		Rules: policy.Rules,
+	}
+
+	return p.pushACL(pushPhaseACLPolicies, aclPolicyCheckpoint(policy.Name), "Policy: "+policy.Name, func() error {
+		_, _, err := p.aclClient.PolicyCreate(&apiPolicy, nil)
+		return err
+	}, func() (bool, error) {
+		existing, _, err := p.aclClient.PolicyReadByName(policy.Name, nil)
+		return existing != nil, err
+	})
+}
+
+func serviceIdentities(names []string) []*api.ACLServiceIdentity {
+	var identities []*api.ACLServiceIdentity
+	for _, name := range names {
+		identities = append(identities, &api.ACLServiceIdentity{ServiceName: name})
+	}
+	return identities
+}
+
+func (p *pusher) pushACLRole(role *acl.Role) error {
+	apiRole := api.ACLRole{
+		Name:              role.Name,
+		ServiceIdentities: serviceIdentities(role.ServiceIdentities),
+	}
+	for _, policy := range role.Policies {
+		apiRole.Policies = append(apiRole.Policies, &api.ACLRolePolicyLink{Name: policy})
+	}
+
+	return p.pushACL(pushPhaseACLRoles, aclRoleCheckpoint(role.Name), "Role: "+role.Name, func() error {
+		_, _, err := p.aclClient.RoleCreate(&apiRole, nil)
+		return err
+	}, func() (bool, error) {
+		existing, _, err := p.aclClient.RoleReadByName(role.Name, nil)
+		return existing != nil, err
+	})
+}
+
+func (p *pusher) pushACLToken(token *acl.Token) error {
+	apiToken := api.ACLToken{
+		AccessorID:        token.AccessorID,
+		SecretID:          token.SecretID,
+		ServiceIdentities: serviceIdentities(token.ServiceIdentities),
+	}
+	for _, policy := range token.Policies {
+		apiToken.Policies = append(apiToken.Policies, &api.ACLTokenPolicyLink{Name: policy})
+	}
+	for _, role := range token.Roles {
+		apiToken.Roles = append(apiToken.Roles, &api.ACLTokenRoleLink{Name: role})
+	}
+
+	return p.pushACL(pushPhaseACLTokens, aclTokenCheckpoint(token.AccessorID), "Token: "+token.AccessorID, func() error {
+		_, _, err := p.aclClient.TokenCreate(&apiToken, nil)
+		return err
+	}, func() (bool, error) {
+		// Consul denies reading a token which doesn't exist
+		existing, _, err := p.aclClient.TokenRead(token.AccessorID, nil)
+		if err != nil && (isNotFound(err) || isPermissionDenied(err)) {
+			return false, nil
+		}
+		return existing != nil, err
+	})
+}
+
+// pushConfigEntry submits a request writing a single config entry unless the checkpoint
+// records it as already pushed.
+func (p *pusher) pushConfigEntry(phase int, entry api.ConfigEntry) error {
+	c := p.c
+	checkpoint := configEntryCheckpoint(entry)
+	if c.checkpoint.completed(checkpoint) {
+		return nil
+	}
+
+	if err := p.startPhase(phase); err != nil {
+		return err
+	}
+
+	if err := p.ensureTenancy("", entry.GetPartition(), entry.GetNamespace()); err != nil {
+		return err
+	}
+
+	if !c.quiet {
+		c.ui.Output(fmt.Sprintf("   %s: %s", entry.GetKind(), entry.GetName()))
+	}
+
+	opts := api.WriteOptions{
+		Partition: entry.GetPartition(),
+		Namespace: entry.GetNamespace(),
+	}
+
+	p.pool.submit(func() error {
+		err := c.requests.do(func() error {
+			_, _, err := p.configEntryClient.Set(entry, &opts)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to push %s %s: %w", entry.GetKind(), entry.GetName(), err)
+		}
+		atomic.AddInt64(&p.resources, 1)
+		c.checkpoint.record(checkpoint)
+		return nil
+	})
+	return nil
+}
+
+// apiConfigEntry converts a generated config entry into the API's representation
+func apiConfigEntry(entry *configentries.Entry) (api.ConfigEntry, error) {
+	switch entry.Kind {
+	case configentries.KindProxyDefaults:
+		apiEntry := api.ProxyConfigEntry{
+			Kind:      api.ProxyDefaults,
+			Name:      entry.Name,
+			Partition: entry.Partition,
+			Namespace: entry.Namespace,
+		}
+		if entry.Protocol != "" {
+			apiEntry.Config = map[string]interface{}{"protocol": entry.Protocol}
+		}
+		return &apiEntry, nil
+	case configentries.KindServiceDefaults:
+		return &api.ServiceConfigEntry{
+			Kind:      api.ServiceDefaults,
+			Name:      entry.Name,
+			Partition: entry.Partition,
+			Namespace: entry.Namespace,
+			Protocol:  entry.Protocol,
+		}, nil
+	case configentries.KindServiceResolver:
+		apiEntry := api.ServiceResolverConfigEntry{
+			Kind:          api.ServiceResolver,
+			Name:          entry.Name,
+			Partition:     entry.Partition,
+			Namespace:     entry.Namespace,
+			DefaultSubset: entry.DefaultSubset,
+			Subsets:       make(map[string]api.ServiceResolverSubset, len(entry.Subsets)),
+		}
+		for name, filter := range entry.Subsets {
+			apiEntry.Subsets[name] = api.ServiceResolverSubset{Filter: filter}
+		}
+		return &apiEntry, nil
+	case configentries.KindServiceSplitter:
+		apiEntry := api.ServiceSplitterConfigEntry{
+			Kind:      api.ServiceSplitter,
+			Name:      entry.Name,
+			Partition: entry.Partition,
+			Namespace: entry.Namespace,
+		}
+		for _, split := range entry.Splits {
+			apiEntry.Splits = append(apiEntry.Splits, api.ServiceSplit{
+				Weight:        split.Weight,
+				Service:       split.Service,
+				ServiceSubset: split.ServiceSubset,
+			})
+		}
+		return &apiEntry, nil
+	case configentries.KindServiceRouter:
+		apiEntry := api.ServiceRouterConfigEntry{
+			Kind:      api.ServiceRouter,
+			Name:      entry.Name,
+			Partition: entry.Partition,
+			Namespace: entry.Namespace,
+		}
+		for _, route := range entry.Routes {
+			apiEntry.Routes = append(apiEntry.Routes, api.ServiceRoute{
+				Match: &api.ServiceRouteMatch{
+					HTTP: &api.ServiceRouteHTTPMatch{PathPrefix: route.PathPrefix},
+				},
+				Destination: &api.ServiceRouteDestination{
+					Service:       route.Service,
+					ServiceSubset: route.ServiceSubset,
+				},
+			})
+		}
+		return &apiEntry, nil
+	}
+	return nil, fmt.Errorf("Unknown config entry kind %s for %s", entry.Kind, entry.Name)
+}
+
+func (p *pusher) pushGeneratedConfigEntry(entry *configentries.Entry) error {
+	apiEntry, err := apiConfigEntry(entry)
+	if err != nil {
+		return err
+	}
+	return p.pushConfigEntry(configEntryPhases[entry.Kind], apiEntry)
+}
+
+func serviceIntentionsEntry(entry *intentions.Intentions) *api.ServiceIntentionsConfigEntry {
+	apiEntry := api.ServiceIntentionsConfigEntry{
+		Kind:      api.ServiceIntentions,
+		Name:      entry.Name,
+		Namespace: entry.Namespace,
+		Partition: entry.Partition,
+	}
+
+	for _, source := range entry.Sources {
+		apiSource := api.SourceIntention{
+			Name:      source.Name,
+			Namespace: source.Namespace,
+			Action:    api.IntentionAction(source.Action),
+			Type:      api.IntentionSourceConsul,
+		}
+
+		for _, permission := range source.Permissions {
+			http := api.IntentionHTTPPermission{
+				PathExact:  permission.PathExact,
+				PathPrefix: permission.PathPrefix,
+				PathRegex:  permission.PathRegex,
+				Methods:    permission.Methods,
+			}
+			for _, header := range permission.Headers {
+				http.Header = append(http.Header, api.IntentionHTTPHeaderPermission{
+					Name:    header.Name,
+					Present: header.Present,
+					Exact:   header.Exact,
+					Prefix:  header.Prefix,
+					Regex:   header.Regex,
+					Invert:  header.Invert,
+				})
+			}
+
+			apiSource.Permissions = append(apiSource.Permissions, &api.IntentionPermission{
+				Action: api.IntentionAction(permission.Action),
+				HTTP:   &http,
+			})
+		}
+
+		apiEntry.Sources = append(apiEntry.Sources, &apiSource)
+	}
+	return &apiEntry
+}
+
+func (p *pusher) pushIntentions(entry *intentions.Intentions) error {
+	return p.pushConfigEntry(pushPhaseIntentions, serviceIntentionsEntry(entry))
+}
+
+func apiPreparedQuery(query *preparedqueries.Query) *api.PreparedQueryDefinition {
+	def := api.PreparedQueryDefinition{
+		Name: query.Name,
+		Service: api.ServiceQuery{
+			Service:     query.Service,
+			Namespace:   query.Namespace,
+			OnlyPassing: query.OnlyPassing,
+			Tags:        query.Tags,
+			NodeMeta:    query.NodeMeta,
+			Failover: api.QueryDatacenterOptions{
+				NearestN:    query.NearestN,
+				Datacenters: query.FailoverDatacenters,
+			},
+		},
+	}
+	if query.Template != nil {
+		def.Template = api.QueryTemplate{
+			Type:   "name_prefix_match",
+			Regexp: query.Template.Regexp,
+		}
+	}
+	return &def
+}
+
+// pushPreparedQuery submits a request creating a single prepared query unless the
+// checkpoint records it as already pushed. The ID Consul assigns to it is recorded in
+// the manifest.
+func (p *pusher) pushPreparedQuery(query *preparedqueries.Query) error {
+	c := p.c
+	checkpoint := preparedQueryCheckpoint(query.Datacenter, query.Name)
+	if c.checkpoint.completed(checkpoint) {
+		return nil
+	}
+
+	if err := p.startPhase(pushPhasePreparedQueries); err != nil {
+		return err
+	}
+
+	if !c.quiet {
+		c.ui.Output(fmt.Sprintf("   Prepared Query: %s", query.Name))
+	}
+
+	def := apiPreparedQuery(query)
+	opts := api.WriteOptions{Datacenter: query.Datacenter}
+	p.pool.submit(func() error {
+		var id string
+		err := c.requests.doCreate(func() error {
+			var err error
+			id, _, err = p.preparedQueryClient.Create(def, &opts)
+			return err
+		}, func() (bool, error) {
+			// Consul rejects a second query with the same name so one which was
+			// already created is found by its name
+			queries, _, err := p.preparedQueryClient.List(&api.QueryOptions{Datacenter: query.Datacenter})
+			if err != nil {
+				return false, err
+			}
+			for _, existing := range queries {
+				if existing.Name == query.Name {
+					id = existing.ID
+					return true, nil
 				}
 			}
+			return false, nil
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to push prepared query %s: %w", query.Name, err)
+		}
+		atomic.AddInt64(&p.resources, 1)
+		c.manifest.record(manifestEntry{
+			Type:       manifestTypePreparedQuery,
+			ID:         id,
+			Name:       query.Name,
+			Datacenter: query.Datacenter,
+		})
+		c.checkpoint.record(checkpoint)
+		return nil
+	})
+	return nil
+}
+
+// pushSession submits a request creating a single session followed by requests
+// acquiring each of its locks unless the checkpoint records it as already pushed. The
+// ID Consul assigns to it is recorded in the manifest.
+func (p *pusher) pushSession(session *sessions.Session) error {
+	c := p.c
+	checkpoint := sessionCheckpoint(session.Datacenter, session.Name)
+	if c.checkpoint.completed(checkpoint) {
+		return nil
+	}
+
+	entry, err := apiSession(session)
+	if err != nil {
+		return err
+	}
+
+	var ttl time.Duration
+	if session.TTL != "" {
+		ttl, err = time.ParseDuration(session.TTL)
+		if err != nil {
+			return fmt.Errorf("Failed to parse TTL of session %s: %w", session.Name, err)
+		}
+	}
+
+	if err := p.startPhase(pushPhaseSessions); err != nil {
+		return err
+	}
+
+	if !c.quiet {
+		c.ui.Output(fmt.Sprintf("   Session: %s", session.Name))
+	}
+
+	opts := api.WriteOptions{Datacenter: session.Datacenter, Partition: session.Partition}
+	p.pool.submit(func() error {
+		var id string
+		err := c.requests.do(func() error {
+			var err error
+			id, err = p.sessionClient.CreateSession(entry, &opts)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to push session %s: %w", session.Name, err)
 		}
-		if c.useTxn {
-			err := txn.finish()
+		atomic.AddInt64(&p.resources, 1)
+		c.manifest.record(manifestEntry{
+			Type:       manifestTypeSession,
+			ID:         id,
+			Name:       session.Name,
+			Datacenter: session.Datacenter,
+			Partition:  session.Partition,
+		})
+
+		// renewing starts before acquiring the locks so that short TTLs don't expire
+		// while there are many of them
+		if c.renewer != nil && ttl > 0 {
+			c.renewer.add(id, session.Name, ttl, opts)
+		}
+
+		for _, lock := range session.Locks {
+			pair := api.KVPair{Key: lock.Key, Value: []byte(lock.Value), Session: id}
+			var acquired bool
+			err := c.requests.do(func() error {
+				var err error
+				acquired, err = p.sessionClient.AcquireLock(&pair, &opts)
+				return err
+			})
 			if err != nil {
-				return fmt.Errorf("Failed to push txn: %w", err)
+				return fmt.Errorf("Failed to acquire lock %s for session %s: %w", lock.Key, session.Name, err)
+			}
+			if !acquired {
+				atomic.AddInt64(&p.failedLocks, 1)
+				continue
 			}
+			atomic.AddInt64(&p.resources, 1)
 		}
-		c.ui.Info("Finished pushing Catalog data to Consul")
+		c.checkpoint.record(checkpoint)
+		return nil
+	})
+	return nil
+}
+
+// pushEvent submits a request firing a single user event unless the checkpoint records
+// it as already fired. Events aren't stored by Consul so they don't count as created
+// resources and there is nothing for consul-data cleanup to delete.
+func (p *pusher) pushEvent(event *events.Event) error {
+	c := p.c
+	checkpoint := eventCheckpoint(p.events)
+	p.events += 1
+	if c.checkpoint.completed(checkpoint) {
+		return nil
 	}
 
-	c.ui.Info(fmt.Sprintf("Total Resources Created: %d", resources))
+	if err := p.startPhase(pushPhaseEvents); err != nil {
+		return err
+	}
+
+	if !c.quiet {
+		c.ui.Output(fmt.Sprintf("   Event: %s", event.Name))
+	}
+
+	params := api.UserEvent{
+		Name:          event.Name,
+		NodeFilter:    event.NodeFilter,
+		ServiceFilter: event.ServiceFilter,
+		TagFilter:     event.TagFilter,
+	}
+	if event.Payload != "" {
+		params.Payload = []byte(event.Payload)
+	}
+	opts := api.WriteOptions{Datacenter: event.Datacenter}
+	p.pool.submit(func() error {
+		p.eventLimiter.wait()
+		// firing an event again would deliver it twice so it is only retried when
+		// Consul never received it
+		err := c.requests.doUnsent(func() error {
+			_, _, err := p.eventClient.Fire(&params, &opts)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to fire event %s: %w", event.Name, err)
+		}
+		atomic.AddInt64(&p.firedEvents, 1)
+		c.checkpoint.record(checkpoint)
+		return nil
+	})
 	return nil
 }
 
@@ -306,29 +1443,50 @@ func (c *pushCommand) Run(args []string) int {
 		return 1
 	}
 
-	data, err := c.getData()
-	if err != nil {
-		c.ui.Error(err.Error())
+	if c.dryRun && c.checkpointPath != "" {
+		c.ui.Error("Cannot specify both -dry-run and -checkpoint")
 		return 1
 	}
 
-	if err := c.pushData(data); err != nil {
-		c.ui.Error(err.Error())
+	if c.dryRun && c.manifestPath != "" {
+		c.ui.Error("Cannot specify both -dry-run and -manifest")
+		return 1
+	}
+
+	if c.dryRun && c.renewSessions > 0 {
+		c.ui.Error("Cannot specify both -dry-run and -renew-sessions")
+		return 1
+	}
+
+	if c.dryRunOutput != "" && !c.dryRun {
+		c.ui.Error("Cannot specify -dry-run-output without -dry-run")
 		return 1
 	}
 
 	if c.outputPath != "" {
-		serialized, err := json.MarshalIndent(data, "", "   ")
+		var err error
+		c.output, err = createOutput(c.outputPath, c.outputFormat, c.outputCompress)
 		if err != nil {
-			c.ui.Error(fmt.Sprintf("Failed to serialize Consul data: %v", err))
+			c.ui.Error(err.Error())
 			return 1
 		}
+	}
+
+	pushErr := c.pushData()
 
-		if err := ioutil.WriteFile(c.outputPath, serialized, 0644); err != nil {
+	// the output is completed even when the push fails so that it can be used to
+	// cleanup whatever was pushed
+	if c.output != nil {
+		if err := c.output.Close(); err != nil {
 			c.ui.Error(fmt.Sprintf("Failed to write serialized Consul data to %q: %v", c.outputPath, err))
 			return 1
 		}
-		c.ui.Info(fmt.Sprintf("Consul data written to %s", args[0]))
+		c.ui.Info(fmt.Sprintf("Consul data written to %s", c.outputPath))
+	}
+
+	if pushErr != nil {
+		c.ui.Error(pushErr.Error())
+		return 1
 	}
 
 	return 0
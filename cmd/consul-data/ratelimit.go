@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// minRampRate is the rate used at the very start of a ramp up so that the
+// limiter never ends up with a zero rate which would block all requests.
+const minRampRate = 1.0
+
+// rateLimiter limits the rate at which requests are made to Consul. When a ramp
+// duration is configured the allowed rate linearly increases from minRampRate
+// to the target rate over that period.
+type rateLimiter struct {
+	target float64
+	burst  int
+	ramp   time.Duration
+
+	lock  sync.Mutex
+	start time.Time
+	// next is the time at which the next request is allowed to be made
+	next time.Time
+}
+
+// newRateLimiter returns a rate limiter allowing opsPerSec requests per second. A
+// nil limiter is returned when opsPerSec is not positive which disables limiting.
+func newRateLimiter(opsPerSec float64, burst int, ramp time.Duration) *rateLimiter {
+	if opsPerSec <= 0 {
+		return nil
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		target: opsPerSec,
+		burst:  burst,
+		ramp:   ramp,
+	}
+}
+
+// wait blocks until the next request is allowed to be made.
+func (r *rateLimiter) wait() {
+	if r == nil {
+		return
+	}
+
+	r.lock.Lock()
+	now := time.Now()
+	if r.start.IsZero() {
+		r.start = now
+		r.next = now
+	}
+
+	// Using the rate at the time of the reserved slot instead of the current time
+	// prevents requests queued at the beginning of a ramp from being spaced out
+	// by the much lower initial rate.
+	interval := time.Duration(float64(time.Second) / r.rateAt(r.next))
+
+	// Unused capacity may only accumulate up to the burst size.
+	if earliest := now.Add(-time.Duration(r.burst-1) * interval); r.next.Before(earliest) {
+		r.next = earliest
+	}
+
+	at := r.next
+	r.next = r.next.Add(interval)
+	r.lock.Unlock()
+
+	time.Sleep(time.Until(at))
+}
+
+func (r *rateLimiter) rateAt(t time.Time) float64 {
+	elapsed := t.Sub(r.start)
+	if elapsed >= r.ramp {
+		return r.target
+	}
+
+	current := r.target * float64(elapsed) / float64(r.ramp)
+	if current < minRampRate {
+		return math.Min(minRampRate, r.target)
+	}
+	return current
+}
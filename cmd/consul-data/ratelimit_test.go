@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	if r := newRateLimiter(0, 1, 0); r != nil {
+		t.Fatalf("expected no limiter without a rate")
+	}
+	if r := newRateLimiter(-1, 1, 0); r != nil {
+		t.Fatalf("expected no limiter with a negative rate")
+	}
+	if r := newRateLimiter(10, 0, 0); r == nil || r.burst != 1 {
+		t.Fatalf("expected the burst to be at least 1")
+	}
+
+	// waiting on a disabled limiter never blocks
+	var r *rateLimiter
+	r.wait()
+}
+
+func TestRateLimiter_RateAt(t *testing.T) {
+	start := time.Now()
+
+	cases := map[string]struct {
+		target  float64
+		ramp    time.Duration
+		elapsed time.Duration
+		rate    float64
+	}{
+		"no ramp":          {target: 100, ramp: 0, elapsed: 0, rate: 100},
+		"ramp start":       {target: 100, ramp: 10 * time.Second, elapsed: 0, rate: minRampRate},
+		"ramp quarter":     {target: 100, ramp: 10 * time.Second, elapsed: 2500 * time.Millisecond, rate: 25},
+		"ramp half":        {target: 100, ramp: 10 * time.Second, elapsed: 5 * time.Second, rate: 50},
+		"ramp end":         {target: 100, ramp: 10 * time.Second, elapsed: 10 * time.Second, rate: 100},
+		"after ramp":       {target: 100, ramp: 10 * time.Second, elapsed: time.Minute, rate: 100},
+		"below minimum":    {target: 100, ramp: 10 * time.Second, elapsed: 50 * time.Millisecond, rate: minRampRate},
+		"target below min": {target: 0.5, ramp: 10 * time.Second, elapsed: time.Second, rate: 0.5},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := newRateLimiter(tc.target, 1, tc.ramp)
+			r.start = start
+
+			if rate := r.rateAt(start.Add(tc.elapsed)); rate != tc.rate {
+				t.Fatalf("expected a rate of %v but got %v", tc.rate, rate)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	cases := map[string]struct {
+		rate     float64
+		burst    int
+		requests int
+		min      time.Duration
+	}{
+		// the first request is made immediately and the rest are spaced out
+		"no burst": {rate: 100, burst: 1, requests: 11, min: 90 * time.Millisecond},
+		// unused capacity only accumulates over time so a burst doesn't help at the start
+		"burst": {rate: 100, burst: 5, requests: 11, min: 90 * time.Millisecond},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := newRateLimiter(tc.rate, tc.burst, 0)
+
+			start := time.Now()
+			for i := 0; i < tc.requests; i++ {
+				r.wait()
+			}
+			if elapsed := time.Since(start); elapsed < tc.min {
+				t.Fatalf("expected %d requests to take at least %v but took %v", tc.requests, tc.min, elapsed)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_BurstAfterIdle(t *testing.T) {
+	r := newRateLimiter(10, 5, 0)
+	r.wait()
+
+	// after being idle long enough to accumulate the burst, that many requests are
+	// allowed immediately
+	time.Sleep(600 * time.Millisecond)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		r.wait()
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("expected the burst to be allowed immediately but took %v", elapsed)
+	}
+}
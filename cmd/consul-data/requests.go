@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	txnMaxOps = 64
+)
+
+// requestFlags holds the configuration for how commands writing many resources
+// to Consul make their requests.
+type requestFlags struct {
+	parallel     int
+	useTxn       bool
+	txnOps       int
+	rate         float64
+	burst        int
+	ramp         time.Duration
+	retries      int
+	retryBackoff time.Duration
+	retryMaxWait time.Duration
+
+	limiter *rateLimiter
+	// retried is the number of requests that needed to be retried
+	retried int64
+}
+
+func (f *requestFlags) MergeAll(main *flag.FlagSet) {
+	FlagMerge(main, f.Flags())
+	FlagMerge(main, f.TxnFlags())
+}
+
+func (f *requestFlags) Flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.IntVar(&f.parallel, "parallel", 1, "Number of concurrent requests that can be made")
+	fs.Float64Var(&f.rate, "rate", 0, "Maximum number of requests per second to make to Consul. Each "+
+		"individual KV or catalog request and each Txn counts as a single request. A value of 0 "+
+		"disables rate limiting")
+	fs.IntVar(&f.burst, "burst", 1, "Number of requests that may be made at once in excess of the -rate limit")
+	fs.DurationVar(&f.ramp, "ramp", 0, "Duration over which to linearly increase the request rate up to the -rate limit")
+	fs.IntVar(&f.retries, "retries", 3, "Number of times to retry a request that failed due to rate "+
+		"limiting, a server error or a connection error")
+	fs.DurationVar(&f.retryBackoff, "retry-backoff", 250*time.Millisecond, "Time to wait before the "+
+		"first retry of a request. The wait doubles with each subsequent retry")
+	fs.DurationVar(&f.retryMaxWait, "retry-max-wait", 10*time.Second, "Maximum time to wait between retries of a request")
+	return fs
+}
+
+func (f *requestFlags) TxnFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.BoolVar(&f.useTxn, "txn", false, "Whether to use the transaction API for writing data")
+	fs.IntVar(&f.txnOps, "txn-ops", txnMaxOps, "Number of operations to perform in each Txn")
+	return fs
+}
+
+// init must be called after parsing the flags and before making any requests.
+func (f *requestFlags) init() {
+	f.limiter = newRateLimiter(f.rate, f.burst, f.ramp)
+}
+
+// do makes a single request to Consul once allowed to by the rate limiter. Requests
+// failing with a retryable error are retried with exponential backoff.
+func (f *requestFlags) do(req func() error) error {
+	return f.retry(req, isRetryableError, nil)
+}
+
+// doCreate makes a request creating a resource like do. A create which appeared to
+// fail may have succeeded anyway, such as when the response timed out, and retrying it
+// would then fail as the resource already exists. So found is called before each retry
+// to look the resource up and the create is considered successful once it is found.
+func (f *requestFlags) doCreate(create func() error, found func() (bool, error)) error {
+	return f.retry(create, isRetryableError, found)
+}
+
+// doUnsent makes a request like do but only retries it when it failed without being
+// sent. This is for requests which aren't safe to repeat once Consul has received them.
+func (f *requestFlags) doUnsent(req func() error) error {
+	return f.retry(req, isUnsentError, nil)
+}
+
+// retry makes the request, retrying it with exponential backoff while it fails with an
+// error accepted by retryable. When found is set it is called before each retry and
+// the request is considered successful when it returns true.
+func (f *requestFlags) retry(req func() error, retryable func(error) bool, found func() (bool, error)) error {
+	for attempt := 0; ; attempt++ {
+		f.limiter.wait()
+
+		err := req()
+		if err == nil || attempt >= f.retries || !retryable(err) {
+			if attempt > 0 {
+				atomic.AddInt64(&f.retried, 1)
+			}
+			return err
+		}
+
+		time.Sleep(retryBackoff(attempt, f.retryBackoff, f.retryMaxWait))
+
+		if found != nil {
+			var exists bool
+			err := f.do(func() error {
+				var err error
+				exists, err = found()
+				return err
+			})
+			if err != nil {
+				atomic.AddInt64(&f.retried, 1)
+				return err
+			}
+			if exists {
+				atomic.AddInt64(&f.retried, 1)
+				return nil
+			}
+		}
+	}
+}
+
+// retriedRequests returns the number of requests that needed to be retried.
+func (f *requestFlags) retriedRequests() int64 {
+	return atomic.LoadInt64(&f.retried)
+}
+
+func (f *requestFlags) newPool() *workerPool {
+	return newWorkerPool(f.parallel)
+}
+
+// newTxnManagers returns txnManagers which apply their batches using the pool. The
+// applied function is invoked with the operations of each successfully applied batch.
+func (f *requestFlags) newTxnManagers(client txnWriter, pool *workerPool, applied func(api.TxnOps)) *txnManagers {
+	return newTxnManagers(func(datacenter string) *txnManager {
+		return &txnManager{
+			client:     client,
+			pool:       pool,
+			maxOps:     f.txnOps,
+			datacenter: datacenter,
+			do:         f.do,
+			applied:    applied,
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// statusError is returned for HTTP responses which indicate that the request
+// may succeed if it were retried later.
+type statusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("Unexpected response code: %d (%s)", e.StatusCode, e.Body)
+}
+
+// statusTransport converts responses with a retryable status code into a statusError.
+// The Consul API client only exposes status codes by way of the error message, and
+// not at all for some endpoints like the Txn API, so this lets us reliably classify
+// errors regardless of which endpoint produced them.
+type statusTransport struct {
+	next http.RoundTripper
+}
+
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || !isRetryableStatus(resp.StatusCode) {
+		return resp, err
+	}
+
+	var buf bytes.Buffer
+	io.Copy(&buf, resp.Body)
+	resp.Body.Close()
+
+	return nil, &statusError{StatusCode: resp.StatusCode, Body: buf.String()}
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// isRetryableError returns whether the error returned from a request to Consul is
+// one where the request may succeed when retried.
+func isRetryableError(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return true
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isUnsentError returns whether the request failed before any of it was sent to Consul
+// because the connection couldn't be established.
+func isUnsentError(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isPermissionDenied returns whether the request failed due to the ACL token used
+// lacking the permissions for it.
+func isPermissionDenied(err error) bool {
+	var statusErr api.StatusError
+	return errors.As(err, &statusErr) && statusErr.Code == http.StatusForbidden
+}
+
+// isNotFound returns whether the request failed due to the resource not existing.
+func isNotFound(err error) bool {
+	var statusErr api.StatusError
+	return errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound
+}
+
+// retryBackoff returns how long to wait before making the next attempt. The wait grows
+// exponentially with the number of attempts made and is jittered to prevent many
+// concurrent retries from being made in lock step.
+func retryBackoff(attempt int, base time.Duration, max time.Duration) time.Duration {
+	wait := base
+	for i := 0; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+
+	if wait > max {
+		wait = max
+	}
+
+	if wait <= 0 {
+		return 0
+	}
+
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(wait-half)+1))
+}
+
+// newAPIClient creates a Consul API client whose errors can be classified with isRetryableError.
+func newAPIClient(flags *HTTPFlags) (*api.Client, error) {
+	conf := api.DefaultConfig()
+	flags.MergeOntoConfig(conf)
+
+	httpClient, err := api.NewHttpClient(conf.Transport, conf.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Transport = &statusTransport{next: httpClient.Transport}
+	conf.HttpClient = httpClient
+
+	return api.NewClient(conf)
+}
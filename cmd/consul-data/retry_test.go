@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// timeoutError is a net.Error for a request which timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryableError(t *testing.T) {
+	cases := map[string]struct {
+		err       error
+		retryable bool
+	}{
+		"status":             {err: &statusError{StatusCode: 429}, retryable: true},
+		"wrapped status":     {err: fmt.Errorf("put: %w", &statusError{StatusCode: 503}), retryable: true},
+		"connection reset":   {err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, retryable: true},
+		"connection refused": {err: fmt.Errorf("put: %w", syscall.ECONNREFUSED), retryable: true},
+		"eof":                {err: io.EOF, retryable: true},
+		"unexpected eof":     {err: io.ErrUnexpectedEOF, retryable: true},
+		"timeout":            {err: timeoutError{}, retryable: true},
+		"bad request":        {err: api.StatusError{Code: 400, Body: "invalid"}},
+		"other":              {err: errors.New("invalid")},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if retryable := isRetryableError(tc.err); retryable != tc.retryable {
+				t.Fatalf("expected isRetryableError to return %t", tc.retryable)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	cases := map[string]struct {
+		attempt int
+		base    time.Duration
+		max     time.Duration
+		wait    time.Duration
+	}{
+		"first":    {attempt: 0, base: time.Second, max: time.Minute, wait: time.Second},
+		"doubled":  {attempt: 2, base: time.Second, max: time.Minute, wait: 4 * time.Second},
+		"capped":   {attempt: 10, base: time.Second, max: 5 * time.Second, wait: 5 * time.Second},
+		"no wait":  {attempt: 3, base: 0, max: time.Minute, wait: 0},
+		"overflow": {attempt: 100, base: time.Second, max: time.Hour, wait: time.Hour},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			// the wait is jittered between half of and the full wait
+			for i := 0; i < 100; i++ {
+				wait := retryBackoff(tc.attempt, tc.base, tc.max)
+				if wait < tc.wait/2 || wait > tc.wait {
+					t.Fatalf("expected a wait between %v and %v but got %v", tc.wait/2, tc.wait, wait)
+				}
+			}
+		})
+	}
+}
+
+// testRequests returns requestFlags which retry twice without waiting long
+func testRequests() *requestFlags {
+	f := &requestFlags{retries: 2, retryBackoff: time.Millisecond, retryMaxWait: time.Millisecond}
+	f.init()
+	return f
+}
+
+// failingRequest returns a request which fails with each of the errors in turn before
+// succeeding, along with the number of attempts made
+func failingRequest(errs ...error) (func() error, *int) {
+	attempts := 0
+	return func() error {
+		attempts++
+		if attempts <= len(errs) {
+			return errs[attempts-1]
+		}
+		return nil
+	}, &attempts
+}
+
+func TestRequestFlags_Do(t *testing.T) {
+	retryable := &statusError{StatusCode: 500}
+	invalid := errors.New("invalid")
+
+	cases := map[string]struct {
+		errs     []error
+		attempts int
+		err      error
+		retried  int64
+	}{
+		"success":           {attempts: 1},
+		"retried":           {errs: []error{retryable, retryable}, attempts: 3, retried: 1},
+		"retries exhausted": {errs: []error{retryable, retryable, retryable, retryable}, attempts: 3, err: retryable, retried: 1},
+		"not retryable":     {errs: []error{invalid}, attempts: 1, err: invalid},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := testRequests()
+			req, attempts := failingRequest(tc.errs...)
+
+			if err := f.do(req); err != tc.err {
+				t.Errorf("expected error %v but got %v", tc.err, err)
+			}
+			if *attempts != tc.attempts {
+				t.Errorf("expected %d attempts but got %d", tc.attempts, *attempts)
+			}
+			if retried := f.retriedRequests(); retried != tc.retried {
+				t.Errorf("expected %d retried requests but got %d", tc.retried, retried)
+			}
+		})
+	}
+}
+
+func TestRequestFlags_DoCreate(t *testing.T) {
+	retryable := &statusError{StatusCode: 500}
+	invalid := errors.New("invalid")
+	lookupErr := errors.New("lookup failed")
+
+	cases := map[string]struct {
+		errs []error
+		// foundAfter is the number of lookups after which the resource is found
+		foundAfter int
+		lookupErr  error
+
+		attempts int
+		lookups  int
+		err      error
+		retried  int64
+	}{
+		"success":       {foundAfter: 1, attempts: 1},
+		"found":         {errs: []error{retryable, retryable}, foundAfter: 1, attempts: 1, lookups: 1, retried: 1},
+		"found later":   {errs: []error{retryable, retryable}, foundAfter: 2, attempts: 2, lookups: 2, retried: 1},
+		"not found":     {errs: []error{retryable}, foundAfter: 5, attempts: 2, lookups: 1, retried: 1},
+		"not retryable": {errs: []error{invalid}, foundAfter: 1, attempts: 1, err: invalid},
+		"lookup fails":  {errs: []error{retryable}, lookupErr: lookupErr, attempts: 1, lookups: 1, err: lookupErr, retried: 1},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := testRequests()
+			req, attempts := failingRequest(tc.errs...)
+
+			lookups := 0
+			found := func() (bool, error) {
+				lookups++
+				return lookups >= tc.foundAfter, tc.lookupErr
+			}
+
+			if err := f.doCreate(req, found); err != tc.err {
+				t.Errorf("expected error %v but got %v", tc.err, err)
+			}
+			if *attempts != tc.attempts {
+				t.Errorf("expected %d attempts but got %d", tc.attempts, *attempts)
+			}
+			if lookups != tc.lookups {
+				t.Errorf("expected %d lookups but got %d", tc.lookups, lookups)
+			}
+			if retried := f.retriedRequests(); retried != tc.retried {
+				t.Errorf("expected %d retried requests but got %d", tc.retried, retried)
+			}
+		})
+	}
+}
+
+func TestIsUnsentError(t *testing.T) {
+	cases := map[string]struct {
+		err    error
+		unsent bool
+	}{
+		"connection refused": {err: fmt.Errorf("fire: %w", syscall.ECONNREFUSED), unsent: true},
+		"dial":               {err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no such host")}, unsent: true},
+		"connection reset":   {err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}},
+		"timeout":            {err: timeoutError{}},
+		"status":             {err: &statusError{StatusCode: 503}},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if unsent := isUnsentError(tc.err); unsent != tc.unsent {
+				t.Fatalf("expected unsent %t but got %t", tc.unsent, unsent)
+			}
+		})
+	}
+}
+
+func TestRequestFlags_DoUnsent(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	sent := &statusError{StatusCode: 500}
+
+	cases := map[string]struct {
+		errs     []error
+		attempts int
+		err      error
+		retried  int64
+	}{
+		"success":           {attempts: 1},
+		"unsent":            {errs: []error{refused}, attempts: 2, retried: 1},
+		"retries exhausted": {errs: []error{refused, refused, refused}, attempts: 3, err: refused, retried: 1},
+		"sent":              {errs: []error{sent}, attempts: 1, err: sent},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := testRequests()
+			req, attempts := failingRequest(tc.errs...)
+
+			if err := f.doUnsent(req); err != tc.err {
+				t.Errorf("expected error %v but got %v", tc.err, err)
+			}
+			if *attempts != tc.attempts {
+				t.Errorf("expected %d attempts but got %d", tc.attempts, *attempts)
+			}
+			if retried := f.retriedRequests(); retried != tc.retried {
+				t.Errorf("expected %d retried requests but got %d", tc.retried, retried)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/mitchellh/cli"
+	"github.com/mkeeler/consul-data/generate/sessions"
+)
+
+// sessionRenewInterval is how often the renewer checks for sessions due to be renewed
+const sessionRenewInterval = time.Second
+
+// sessionWriter is the part of the Consul session and KV APIs used to push sessions and
+// acquire their locks.
+type sessionWriter interface {
+	CreateSession(session *api.SessionEntry, q *api.WriteOptions) (string, error)
+	// AcquireLock reports whether the lock was acquired
+	AcquireLock(pair *api.KVPair, q *api.WriteOptions) (bool, error)
+	// RenewSession reports whether the session still exists
+	RenewSession(id string, q *api.WriteOptions) (bool, error)
+}
+
+// apiSessionWriter creates sessions using the Consul API. Sessions are always created
+// with the node checks given as otherwise Consul binds them to the serfHealth check
+// which doesn't exist for nodes registered through the catalog.
+type apiSessionWriter struct {
+	client *api.Client
+}
+
+func (w *apiSessionWriter) CreateSession(session *api.SessionEntry, q *api.WriteOptions) (string, error) {
+	body := map[string]interface{}{
+		"Name":       session.Name,
+		"Node":       session.Node,
+		"Behavior":   session.Behavior,
+		"NodeChecks": session.NodeChecks,
+	}
+	if session.NodeChecks == nil {
+		body["NodeChecks"] = []string{}
+	}
+	if len(session.ServiceChecks) > 0 {
+		body["ServiceChecks"] = session.ServiceChecks
+	}
+	if session.LockDelay != 0 {
+		body["LockDelay"] = session.LockDelay.String()
+	}
+	if session.TTL != "" {
+		body["TTL"] = session.TTL
+	}
+
+	var out struct{ ID string }
+	_, err := w.client.Raw().Write("/v1/session/create", body, &out, q)
+	return out.ID, err
+}
+
+func (w *apiSessionWriter) AcquireLock(pair *api.KVPair, q *api.WriteOptions) (bool, error) {
+	acquired, _, err := w.client.KV().Acquire(pair, q)
+	return acquired, err
+}
+
+func (w *apiSessionWriter) RenewSession(id string, q *api.WriteOptions) (bool, error) {
+	entry, _, err := w.client.Session().Renew(id, q)
+	return entry != nil, err
+}
+
+// apiSession converts a generated session into what is sent to Consul
+func apiSession(session *sessions.Session) (*api.SessionEntry, error) {
+	entry := api.SessionEntry{
+		Name:       session.Name,
+		Node:       session.Node,
+		Behavior:   session.Behavior,
+		TTL:        session.TTL,
+		NodeChecks: session.NodeChecks,
+	}
+
+	if session.LockDelay != "" {
+		delay, err := time.ParseDuration(session.LockDelay)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse lock delay of session %s: %w", session.Name, err)
+		}
+		entry.LockDelay = delay
+	}
+
+	for _, check := range session.ServiceChecks {
+		entry.ServiceChecks = append(entry.ServiceChecks, api.ServiceCheck{ID: check.ID, Namespace: check.Namespace})
+	}
+	return &entry, nil
+}
+
+// renewedSession is a pushed session with a TTL which is being kept alive
+type renewedSession struct {
+	id       string
+	name     string
+	opts     api.WriteOptions
+	interval time.Duration
+	next     time.Time
+}
+
+// sessionRenewer renews the TTLs of pushed sessions in the background until its
+// deadline so that their locks remain held for that long. Each session is renewed
+// after half of its TTL has passed.
+type sessionRenewer struct {
+	client   sessionWriter
+	requests *requestFlags
+	ui       cli.Ui
+	deadline time.Time
+
+	lock     sync.Mutex
+	sessions []*renewedSession
+	expired  int
+
+	done chan struct{}
+}
+
+// startSessionRenewer starts renewing sessions added to the renewer until the duration
+// has passed.
+func startSessionRenewer(client sessionWriter, requests *requestFlags, ui cli.Ui, duration time.Duration) *sessionRenewer {
+	r := &sessionRenewer{
+		client:   client,
+		requests: requests,
+		ui:       ui,
+		deadline: time.Now().Add(duration),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// add starts renewing the session with the given TTL
+func (r *sessionRenewer) add(id string, name string, ttl time.Duration, opts api.WriteOptions) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.sessions = append(r.sessions, &renewedSession{
+		id:       id,
+		name:     name,
+		opts:     opts,
+		interval: ttl / 2,
+		next:     time.Now().Add(ttl / 2),
+	})
+}
+
+func (r *sessionRenewer) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(sessionRenewInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if now.After(r.deadline) {
+			return
+		}
+		r.renew(now)
+	}
+}
+
+// renew renews every session which is due and stops renewing those which no longer
+// exist, such as when a check they are bound to stops passing.
+func (r *sessionRenewer) renew(now time.Time) {
+	r.lock.Lock()
+	var due []*renewedSession
+	for _, session := range r.sessions {
+		if !session.next.After(now) {
+			due = append(due, session)
+		}
+	}
+	r.lock.Unlock()
+
+	var expired sync.Map
+	pool := r.requests.newPool()
+	for _, session := range due {
+		session := session
+		pool.submit(func() error {
+			var found bool
+			err := r.requests.do(func() error {
+				var err error
+				found, err = r.client.RenewSession(session.id, &session.opts)
+				return err
+			})
+			if err != nil {
+				r.ui.Warn(fmt.Sprintf("Failed to renew session %s: %v", session.name, err))
+				return nil
+			}
+			if !found {
+				r.ui.Warn(fmt.Sprintf("Session %s was invalidated before it could be renewed", session.name))
+				expired.Store(session, struct{}{})
+			}
+			session.next = time.Now().Add(session.interval)
+			return nil
+		})
+	}
+	pool.wait()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	remaining := r.sessions[:0]
+	for _, session := range r.sessions {
+		if _, found := expired.Load(session); found {
+			r.expired++
+			continue
+		}
+		remaining = append(remaining, session)
+	}
+	r.sessions = remaining
+}
+
+// wait blocks until the deadline has passed and renewing has stopped unless there are
+// no sessions to renew.
+func (r *sessionRenewer) wait() {
+	r.lock.Lock()
+	count := len(r.sessions)
+	r.lock.Unlock()
+	if count == 0 {
+		return
+	}
+
+	r.ui.Info(fmt.Sprintf("Renewing %d sessions until %s", count, r.deadline.Format(time.RFC3339)))
+	<-r.done
+
+	if r.expired > 0 {
+		r.ui.Warn(fmt.Sprintf("%d sessions were invalidated while being renewed", r.expired))
+	}
+	r.ui.Info("Finished renewing sessions")
+}
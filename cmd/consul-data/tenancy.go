@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/hashicorp/consul/api"
+)
+
+const defaultTenancy = "default"
+
+// tenancyWriter is the part of the Consul API used to create admin partitions and
+// namespaces. Each method reports whether the partition or namespace had to be created.
+type tenancyWriter interface {
+	CreatePartition(datacenter string, name string) (bool, error)
+	CreateNamespace(datacenter string, partition string, name string) (bool, error)
+}
+
+// apiTenancyWriter creates admin partitions and namespaces using the Consul API
+// unless they already exist.
+type apiTenancyWriter struct {
+	client *api.Client
+}
+
+func (w *apiTenancyWriter) CreatePartition(datacenter string, name string) (bool, error) {
+	partitions := w.client.Partitions()
+
+	existing, _, err := partitions.Read(context.Background(), name, &api.QueryOptions{Datacenter: datacenter})
+	if err != nil || existing != nil {
+		return false, err
+	}
+
+	_, _, err = partitions.Create(context.Background(), &api.Partition{Name: name}, &api.WriteOptions{Datacenter: datacenter})
+	return err == nil, err
+}
+
+func (w *apiTenancyWriter) CreateNamespace(datacenter string, partition string, name string) (bool, error) {
+	namespaces := w.client.Namespaces()
+
+	existing, _, err := namespaces.Read(name, &api.QueryOptions{Datacenter: datacenter, Partition: partition})
+	if err != nil || existing != nil {
+		return false, err
+	}
+
+	_, _, err = namespaces.Create(&api.Namespace{Name: name, Partition: partition}, &api.WriteOptions{Datacenter: datacenter, Partition: partition})
+	return err == nil, err
+}
+
+// tenancyKey identifies an admin partition or, when the namespace is set, a namespace
+type tenancyKey struct {
+	datacenter string
+	partition  string
+	namespace  string
+}
+
+func isDefaultTenancy(name string) bool {
+	return name == "" || name == defaultTenancy
+}
+
+// sameTenancy reports whether two partition or namespace names are equivalent. Consul
+// Enterprise returns "default" for data which was written without one.
+func sameTenancy(a string, b string) bool {
+	return a == b || (isDefaultTenancy(a) && isDefaultTenancy(b))
+}
+
+// ensureTenancy creates the partition and namespace the first time they are used when
+// requested. This happens synchronously within the handler so that they always exist
+// before any data is pushed into them.
+func (p *pusher) ensureTenancy(datacenter string, partition string, namespace string) error {
+	c := p.c
+	if !c.createTenancy {
+		return nil
+	}
+
+	if !isDefaultTenancy(partition) {
+		key := tenancyKey{datacenter: datacenter, partition: partition}
+		if _, found := p.tenancy[key]; !found {
+			if !c.quiet {
+				c.ui.Output(fmt.Sprintf("   Partition: %s", partition))
+			}
+
+			var created bool
+			err := c.requests.do(func() error {
+				var err error
+				created, err = p.tenancyClient.CreatePartition(datacenter, partition)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to create partition %s: %w", partition, err)
+			}
+			if created {
+				atomic.AddInt64(&p.resources, 1)
+			}
+			p.tenancy[key] = struct{}{}
+		}
+	}
+
+	if isDefaultTenancy(namespace) {
+		return nil
+	}
+
+	key := tenancyKey{datacenter: datacenter, partition: partition, namespace: namespace}
+	if _, found := p.tenancy[key]; found {
+		return nil
+	}
+
+	if !c.quiet {
+		c.ui.Output(fmt.Sprintf("   Namespace: %s (Partition: %s)", namespace, orDefault(partition)))
+	}
+
+	var created bool
+	err := c.requests.do(func() error {
+		var err error
+		created, err = p.tenancyClient.CreateNamespace(datacenter, partition, namespace)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to create namespace %s: %w", namespace, err)
+	}
+	if created {
+		atomic.AddInt64(&p.resources, 1)
+	}
+	p.tenancy[key] = struct{}{}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/consul/api"
+	merr "github.com/hashicorp/go-multierror"
+)
+
+// txnWriter is the part of the Consul Txn API used to apply transactions.
+type txnWriter interface {
+	Txn(txn api.TxnOps, q *api.QueryOptions) (bool, *api.TxnResponse, *api.QueryMeta, error)
+}
+
+// txnManager batches operations into transactions which are applied concurrently
+// using a worker pool.
+type txnManager struct {
+	client txnWriter
+	pool   *workerPool
+	ops    api.TxnOps
+	maxOps int
+
+	// datacenter is where the transactions are applied. When empty they are applied
+	// in the datacenter of the agent.
+	datacenter string
+
+	// do is used to make every Txn request
+	do func(func() error) error
+
+	// applied is invoked with the operations of each successfully applied batch
+	applied func(api.TxnOps)
+}
+
+// addOp adds an operation which does not depend on any other operation to the current batch.
+func (m *txnManager) addOp(op *api.TxnOp) {
+	m.addOps(api.TxnOps{op})
+}
+
+// addOps adds a group of operations which must be applied in order. The group is kept
+// within a single batch when it fits. Otherwise it is split into batches which are
+// applied one after another, stopping at the first one that fails.
+func (m *txnManager) addOps(ops api.TxnOps) {
+	if len(m.ops)+len(ops) > m.maxOps {
+		m.flush()
+	}
+
+	if len(ops) <= m.maxOps {
+		m.ops = append(m.ops, ops...)
+		if len(m.ops) >= m.maxOps {
+			m.flush()
+		}
+		return
+	}
+
+	m.pool.submit(m.applySequentially(ops))
+}
+
+// applySequentially returns an operation for the worker pool which applies the first
+// batch of ops and then dispatches another operation to apply the remainder.
+func (m *txnManager) applySequentially(ops api.TxnOps) func() error {
+	return func() error {
+		size := m.maxOps
+		if len(ops) < size {
+			size = len(ops)
+		}
+
+		if err := m.apply(ops[:size]); err != nil {
+			return err
+		}
+
+		if rest := ops[size:]; len(rest) > 0 {
+			m.pool.submitAsync(m.applySequentially(rest))
+		}
+		return nil
+	}
+}
+
+// flush dispatches the current batch of operations to the worker pool.
+func (m *txnManager) flush() {
+	if len(m.ops) == 0 {
+		return
+	}
+
+	ops := m.ops
+	m.ops = nil
+	m.pool.submit(func() error {
+		return m.apply(ops)
+	})
+}
+
+func (m *txnManager) apply(ops api.TxnOps) error {
+	var resp *api.TxnResponse
+	err := m.do(func() error {
+		var err error
+		_, resp, _, err = m.client.Txn(ops, &api.QueryOptions{Datacenter: m.datacenter})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to apply txn: %w", err)
+	}
+
+	for _, txnErr := range resp.Errors {
+		err = merr.Append(err, fmt.Errorf("Failed to apply operation %d: %s", txnErr.OpIndex, txnErr.What))
+	}
+
+	if err == nil && m.applied != nil {
+		m.applied(ops)
+	}
+	return err
+}
+
+// txnManagers batches operations separately for each datacenter as every operation of
+// a transaction is applied within the datacenter the transaction is made to.
+type txnManagers struct {
+	managers map[string]*txnManager
+	// newManager returns the manager of a datacenter the first time it is needed
+	newManager func(datacenter string) *txnManager
+}
+
+func newTxnManagers(newManager func(datacenter string) *txnManager) *txnManagers {
+	return &txnManagers{
+		managers:   make(map[string]*txnManager),
+		newManager: newManager,
+	}
+}
+
+// get returns the manager which batches the operations of the datacenter
+func (m *txnManagers) get(datacenter string) *txnManager {
+	manager, found := m.managers[datacenter]
+	if !found {
+		manager = m.newManager(datacenter)
+		m.managers[datacenter] = manager
+	}
+	return manager
+}
+
+// flush dispatches the current batch of every datacenter to the worker pool.
+func (m *txnManagers) flush() {
+	for _, manager := range m.managers {
+		manager.flush()
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// fakeTxnWriter records the keys of the KV operations applied in each datacenter
+type fakeTxnWriter struct {
+	lock sync.Mutex
+	txns int
+	keys map[string][]string
+}
+
+func (f *fakeTxnWriter) Txn(txn api.TxnOps, q *api.QueryOptions) (bool, *api.TxnResponse, *api.QueryMeta, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.txns++
+	for _, op := range txn {
+		f.keys[q.Datacenter] = append(f.keys[q.Datacenter], op.KV.Key)
+	}
+	return true, &api.TxnResponse{}, &api.QueryMeta{}, nil
+}
+
+func kvSetOp(key string) *api.TxnOp {
+	return &api.TxnOp{KV: &api.KVTxnOp{Verb: api.KVSet, Key: key}}
+}
+
+func TestTxnManagers_Datacenters(t *testing.T) {
+	client := &fakeTxnWriter{keys: make(map[string][]string)}
+	requests := &requestFlags{txnOps: 2}
+	requests.init()
+
+	pool := newWorkerPool(1)
+	applied := 0
+	txn := requests.newTxnManagers(client, pool, func(ops api.TxnOps) {
+		applied += len(ops)
+	})
+
+	txn.get("dc1").addOp(kvSetOp("a"))
+	txn.get("dc2").addOp(kvSetOp("b"))
+	txn.get("dc1").addOp(kvSetOp("c"))
+	txn.get("").addOp(kvSetOp("d"))
+	txn.flush()
+
+	if err := pool.wait(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string][]string{
+		"dc1": {"a", "c"},
+		"dc2": {"b"},
+		"":    {"d"},
+	}
+	for dc, keys := range expected {
+		if len(client.keys[dc]) != len(keys) {
+			t.Fatalf("expected keys %v in datacenter %q but got %v", keys, dc, client.keys[dc])
+		}
+		for i, key := range keys {
+			if client.keys[dc][i] != key {
+				t.Fatalf("expected keys %v in datacenter %q but got %v", keys, dc, client.keys[dc])
+			}
+		}
+	}
+
+	if client.txns != 3 {
+		t.Fatalf("expected 3 transactions but got %d", client.txns)
+	}
+	if applied != 4 {
+		t.Fatalf("expected 4 applied operations but got %d", applied)
+	}
+}
+
+func TestTxnManager_SplitsLargeGroups(t *testing.T) {
+	client := &fakeTxnWriter{keys: make(map[string][]string)}
+	requests := &requestFlags{txnOps: 2}
+	requests.init()
+
+	pool := newWorkerPool(4)
+	txn := requests.newTxnManagers(client, pool, nil).get("dc1")
+
+	txn.addOps(api.TxnOps{kvSetOp("a"), kvSetOp("b"), kvSetOp("c"), kvSetOp("d"), kvSetOp("e")})
+	txn.flush()
+
+	if err := pool.wait(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the batches of a group are applied one after another so the order is kept
+	expected := []string{"a", "b", "c", "d", "e"}
+	if len(client.keys["dc1"]) != len(expected) {
+		t.Fatalf("expected keys %v but got %v", expected, client.keys["dc1"])
+	}
+	for i, key := range expected {
+		if client.keys["dc1"][i] != key {
+			t.Fatalf("expected keys %v but got %v", expected, client.keys["dc1"])
+		}
+	}
+	if client.txns != 3 {
+		t.Fatalf("expected 3 transactions but got %d", client.txns)
+	}
+}
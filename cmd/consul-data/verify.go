@@ -0,0 +1,575 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/mitchellh/cli"
+	"github.com/mkeeler/consul-data/generate"
+	"github.com/mkeeler/consul-data/generate/catalog"
+	"github.com/mkeeler/consul-data/generate/kv"
+	"github.com/mkeeler/consul-data/generate/sessions"
+)
+
+type verifyCommand struct {
+	ui       cli.Ui
+	dataPath string
+	extra    bool
+
+	// datacenter is the one requests are made to when the data doesn't name one
+	datacenter string
+
+	// counts of the resources which diverge from the data
+	missing    int64
+	mismatched int64
+	extraCount int64
+
+	flags    *flag.FlagSet
+	http     *HTTPFlags
+	requests *requestFlags
+	help     string
+}
+
+func newVerifyCommand(ui cli.Ui) cli.Command {
+	c := &verifyCommand{
+		// resources are verified from multiple goroutines
+		ui: &cli.ConcurrentUi{Ui: ui},
+	}
+
+	flags := flag.NewFlagSet("", flag.ContinueOnError)
+
+	flags.StringVar(&c.dataPath, "data", "", "Path to data generated by consul-data generate to verify Consul's state against")
+	flags.BoolVar(&c.extra, "extra", false, "Whether to also report KV entries, nodes and service instances present in Consul but not in the data. "+
+		"Note that this includes anything not created by consul-data such as the Consul servers themselves")
+
+	c.http = &HTTPFlags{}
+	c.http.MergeAll(flags)
+
+	c.requests = &requestFlags{}
+	FlagMerge(flags, c.requests.Flags())
+
+	c.flags = flags
+	c.help = genUsage(`Usage: consul-data verify [OPTIONS]
+
+	Verify that Consul contains the data
+
+	Every KV entry, node, service instance and check described by the
+	file given with the -data flag is read back from Consul and compared
+	with the data. Any missing or mismatched resources are reported and the command
+	exits with a status of 2 when Consul's state diverges from the data.`, c.flags)
+
+	return c
+}
+
+func (c *verifyCommand) queryOptions(datacenter string, partition string, namespace string, token string) *api.QueryOptions {
+	return &api.QueryOptions{
+		Datacenter: datacenter,
+		Partition:  partition,
+		Namespace:  namespace,
+		Token:      token,
+		AllowStale: c.http.Stale(),
+	}
+}
+
+func (c *verifyCommand) reportMissing(format string, args ...interface{}) {
+	atomic.AddInt64(&c.missing, 1)
+	c.ui.Output("   Missing " + fmt.Sprintf(format, args...))
+}
+
+func (c *verifyCommand) reportMismatch(format string, args ...interface{}) {
+	atomic.AddInt64(&c.mismatched, 1)
+	c.ui.Output("   Mismatched " + fmt.Sprintf(format, args...))
+}
+
+func (c *verifyCommand) reportExtra(format string, args ...interface{}) {
+	atomic.AddInt64(&c.extraCount, 1)
+	c.ui.Output("   Extra " + fmt.Sprintf(format, args...))
+}
+
+func metaEqual(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for key, value := range a {
+		if other, found := b[key]; !found || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+func tagsEqual(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func proxyEqual(actual *api.AgentServiceConnectProxyConfig, expected *catalog.Proxy) bool {
+	if expected == nil {
+		// Consul may return an empty proxy config for typical services
+		return actual == nil || actual.DestinationServiceName == ""
+	}
+
+	if actual == nil ||
+		actual.DestinationServiceName != expected.DestinationServiceName ||
+		actual.DestinationServiceID != expected.DestinationServiceID ||
+		actual.LocalServicePort != expected.LocalServicePort ||
+		len(actual.Upstreams) != len(expected.Upstreams) {
+		return false
+	}
+
+	for i, upstream := range expected.Upstreams {
+		if actual.Upstreams[i].DestinationName != upstream.DestinationName ||
+			actual.Upstreams[i].LocalBindPort != upstream.LocalBindPort {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *verifyCommand) verifyData(data *generate.Data) error {
+	client, err := newAPIClient(c.http)
+	if err != nil {
+		return fmt.Errorf("Failed to create Consul API client: %w", err)
+	}
+
+	c.requests.init()
+
+	if c.extra {
+		c.datacenter, err = c.localDatacenter(client)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(data.KV) > 0 || c.extra {
+		c.ui.Info("Verifying KV data")
+		if err := c.verifyKV(client, data.KV, data.Sessions); err != nil {
+			return err
+		}
+	}
+
+	if len(data.Catalog) > 0 || c.extra {
+		c.ui.Info("Verifying Catalog data")
+		if err := c.verifyCatalog(client, data.Catalog); err != nil {
+			return err
+		}
+	}
+
+	c.ui.Info(fmt.Sprintf("Missing Resources:    %d", c.missing))
+	c.ui.Info(fmt.Sprintf("Mismatched Resources: %d", c.mismatched))
+	if c.extra {
+		c.ui.Info(fmt.Sprintf("Extra Resources:      %d", c.extraCount))
+	}
+	return nil
+}
+
+// localDatacenter returns the datacenter requests are made to when none is given. That
+// is the one given by the -datacenter flag or otherwise the agent's own.
+func (c *verifyCommand) localDatacenter(client *api.Client) (string, error) {
+	if datacenter := c.http.Datacenter(); datacenter != "" {
+		return datacenter, nil
+	}
+
+	var self map[string]map[string]interface{}
+	err := c.requests.do(func() error {
+		var err error
+		self, err = client.Agent().Self()
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to read the agent's datacenter: %w", err)
+	}
+
+	datacenter, _ := self["Config"]["Datacenter"].(string)
+	return datacenter, nil
+}
+
+// scopeDatacenter returns the datacenter to scope resources to. The local datacenter
+// is the same as not naming one so both share a scope.
+func (c *verifyCommand) scopeDatacenter(datacenter string) string {
+	if datacenter == c.datacenter {
+		return ""
+	}
+	return datacenter
+}
+
+// scopeTenancy returns the partition or namespace to scope resources to. The default
+// one is the same as not naming one so both share a scope.
+func scopeTenancy(name string) string {
+	if isDefaultTenancy(name) {
+		return ""
+	}
+	return name
+}
+
+// kvScope is the set of KV options keys are scoped to
+type kvScope struct {
+	datacenter string
+	partition  string
+	namespace  string
+}
+
+func (c *verifyCommand) kvScope(datacenter string, partition string, namespace string) kvScope {
+	return kvScope{
+		datacenter: c.scopeDatacenter(datacenter),
+		partition:  scopeTenancy(partition),
+		namespace:  scopeTenancy(namespace),
+	}
+}
+
+func (c *verifyCommand) verifyKV(client *api.Client, data kv.KV, locks []*sessions.Session) error {
+	pool := c.requests.newPool()
+	kvClient := client.KV()
+
+	scopes := make(map[kvScope]map[string]struct{})
+	for key, value := range data {
+		scope := c.kvScope(value.Datacenter, value.Partition, value.Namespace)
+		if scopes[scope] == nil {
+			scopes[scope] = make(map[string]struct{})
+		}
+		// keys whose writes should have been denied are extra when they exist
+		if value.ExpectDenied {
+			continue
+		}
+		scopes[scope][key] = struct{}{}
+
+		key, value := key, value
+		pool.submit(func() error {
+			var pair *api.KVPair
+			err := c.requests.do(func() error {
+				var err error
+				pair, _, err = kvClient.Get(key, c.queryOptions(value.Datacenter, value.Partition, value.Namespace, value.Token))
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to read key %s: %w", key, err)
+			}
+
+			switch {
+			case pair == nil:
+				c.reportMissing("Key: %s", key)
+			case string(pair.Value) != value.Value:
+				c.reportMismatch("Key: %s (value differs)", key)
+			case pair.Flags != uint64(value.Flags):
+				c.reportMismatch("Key: %s (flags %d != %d)", key, pair.Flags, value.Flags)
+			}
+			return nil
+		})
+	}
+
+	// the keys locked by sessions aren't verified as they may have been released or
+	// deleted since but they aren't extra either
+	for _, session := range locks {
+		scope := c.kvScope(session.Datacenter, session.Partition, "")
+		if scopes[scope] == nil {
+			scopes[scope] = make(map[string]struct{})
+		}
+		for _, lock := range session.Locks {
+			scopes[scope][lock.Key] = struct{}{}
+		}
+	}
+
+	// even with no data the default scope is checked for extra keys
+	if len(scopes) == 0 {
+		scopes[kvScope{}] = make(map[string]struct{})
+	}
+
+	if c.extra {
+		for scope, keys := range scopes {
+			scope, keys := scope, keys
+			pool.submit(func() error {
+				var existing []string
+				err := c.requests.do(func() error {
+					var err error
+					existing, _, err = kvClient.Keys("", "", c.queryOptions(scope.datacenter, scope.partition, scope.namespace, ""))
+					return err
+				})
+				if err != nil {
+					return fmt.Errorf("Failed to list keys: %w", err)
+				}
+
+				for _, key := range existing {
+					if _, found := keys[key]; !found {
+						c.reportExtra("Key: %s", key)
+					}
+				}
+				return nil
+			})
+		}
+	}
+
+	return pool.wait()
+}
+
+func (c *verifyCommand) verifyCatalog(client *api.Client, data catalog.Catalog) error {
+	pool := c.requests.newPool()
+	catalogClient := client.Catalog()
+	healthClient := client.Health()
+
+	scopes := make(map[catalogScope]map[string]struct{})
+	for _, node := range data {
+		scope := catalogScope{datacenter: c.scopeDatacenter(node.Datacenter), partition: scopeTenancy(node.Partition)}
+		if scopes[scope] == nil {
+			scopes[scope] = make(map[string]struct{})
+		}
+		if node.ExpectDenied {
+			continue
+		}
+		scopes[scope][node.Name] = struct{}{}
+
+		node := node
+		pool.submit(func() error {
+			var actual *api.CatalogNode
+			err := c.requests.do(func() error {
+				var err error
+				actual, _, err = catalogClient.Node(node.Name, c.queryOptions(node.Datacenter, node.Partition, nodeNamespace(node), ""))
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to read Node %s: %w", node.Name, err)
+			}
+
+			c.verifyNode(node, actual)
+
+			if actual == nil || actual.Node == nil || !hasChecks(node) {
+				return nil
+			}
+
+			var checks api.HealthChecks
+			err = c.requests.do(func() error {
+				var err error
+				checks, _, err = healthClient.Node(node.Name, c.queryOptions(node.Datacenter, node.Partition, nodeNamespace(node), ""))
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to read checks for Node %s: %w", node.Name, err)
+			}
+
+			c.verifyChecks(node, checks)
+			return nil
+		})
+	}
+
+	// even with no data the default scope is checked for extra nodes
+	if len(scopes) == 0 {
+		scopes[catalogScope{}] = make(map[string]struct{})
+	}
+
+	if c.extra {
+		for scope, nodes := range scopes {
+			scope, nodes := scope, nodes
+			pool.submit(func() error {
+				var existing []*api.Node
+				err := c.requests.do(func() error {
+					var err error
+					existing, _, err = catalogClient.Nodes(c.queryOptions(scope.datacenter, scope.partition, "", ""))
+					return err
+				})
+				if err != nil {
+					return fmt.Errorf("Failed to list nodes: %w", err)
+				}
+
+				for _, node := range existing {
+					if _, found := nodes[node.Node]; !found {
+						c.reportExtra("Node: %s", node.Node)
+					}
+				}
+				return nil
+			})
+		}
+	}
+
+	return pool.wait()
+}
+
+func (c *verifyCommand) verifyNode(node *catalog.Node, actual *api.CatalogNode) {
+	if actual == nil || actual.Node == nil {
+		c.reportMissing("Node: %s", node.Name)
+		for _, check := range node.Checks {
+			c.reportMissing("Check: %s (Node: %s)", check.CheckID, node.Name)
+		}
+		for _, service := range node.Services {
+			for _, instance := range service.Instances {
+				c.reportMissing("Service Instance: %s (Node: %s)", instance.ID, node.Name)
+				for _, check := range instance.Checks {
+					c.reportMissing("Check: %s (Node: %s)", check.CheckID, node.Name)
+				}
+			}
+		}
+		return
+	}
+
+	switch {
+	case actual.Node.ID != node.ID:
+		c.reportMismatch("Node: %s (ID %s != %s)", node.Name, actual.Node.ID, node.ID)
+	case actual.Node.Address != node.Address:
+		c.reportMismatch("Node: %s (address %s != %s)", node.Name, actual.Node.Address, node.Address)
+	case !metaEqual(actual.Node.Meta, node.Meta):
+		c.reportMismatch("Node: %s (meta differs)", node.Name)
+	}
+
+	expected := make(map[string]struct{})
+	for _, service := range node.Services {
+		for _, instance := range service.Instances {
+			expected[instance.ID] = struct{}{}
+
+			svc := actual.Services[instance.ID]
+			switch {
+			case svc == nil:
+				c.reportMissing("Service Instance: %s (Node: %s)", instance.ID, node.Name)
+			case svc.Service != instance.Name:
+				c.reportMismatch("Service Instance: %s (Node: %s, name %s != %s)", instance.ID, node.Name, svc.Service, instance.Name)
+			case svc.Address != instance.Address:
+				c.reportMismatch("Service Instance: %s (Node: %s, address %s != %s)", instance.ID, node.Name, svc.Address, instance.Address)
+			case svc.Port != instance.Port:
+				c.reportMismatch("Service Instance: %s (Node: %s, port %d != %d)", instance.ID, node.Name, svc.Port, instance.Port)
+			case !sameTenancy(svc.Namespace, instance.Namespace):
+				c.reportMismatch("Service Instance: %s (Node: %s, namespace %s != %s)", instance.ID, node.Name, orDefault(svc.Namespace), orDefault(instance.Namespace))
+			case string(svc.Kind) != instance.Kind:
+				c.reportMismatch("Service Instance: %s (Node: %s, kind %q != %q)", instance.ID, node.Name, svc.Kind, instance.Kind)
+			case !proxyEqual(svc.Proxy, instance.Proxy):
+				c.reportMismatch("Service Instance: %s (Node: %s, proxy differs)", instance.ID, node.Name)
+			case !tagsEqual(svc.Tags, instance.Tags):
+				c.reportMismatch("Service Instance: %s (Node: %s, tags differ)", instance.ID, node.Name)
+			case !metaEqual(svc.Meta, instance.Meta):
+				c.reportMismatch("Service Instance: %s (Node: %s, meta differs)", instance.ID, node.Name)
+			}
+		}
+	}
+
+	if c.extra {
+		for id := range actual.Services {
+			if _, found := expected[id]; !found {
+				c.reportExtra("Service Instance: %s (Node: %s)", id, node.Name)
+			}
+		}
+	}
+}
+
+// catalogScope is the set of options nodes are scoped to
+type catalogScope struct {
+	datacenter string
+	partition  string
+}
+
+// nodeNamespace is the namespace to read a node's services and checks from. When any
+// of its services are namespaced all namespaces must be read.
+func nodeNamespace(node *catalog.Node) string {
+	for _, service := range node.Services {
+		for _, instance := range service.Instances {
+			if !isDefaultTenancy(instance.Namespace) {
+				return "*"
+			}
+		}
+	}
+	return ""
+}
+
+func hasChecks(node *catalog.Node) bool {
+	if len(node.Checks) > 0 {
+		return true
+	}
+
+	for _, service := range node.Services {
+		for _, instance := range service.Instances {
+			if len(instance.Checks) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *verifyCommand) verifyChecks(node *catalog.Node, actual api.HealthChecks) {
+	existing := make(map[string]*api.HealthCheck)
+	for _, check := range actual {
+		existing[check.CheckID] = check
+	}
+
+	verify := func(serviceID string, check *catalog.Check) {
+		hc := existing[check.CheckID]
+		delete(existing, check.CheckID)
+
+		switch {
+		case hc == nil:
+			c.reportMissing("Check: %s (Node: %s)", check.CheckID, node.Name)
+		case hc.ServiceID != serviceID:
+			c.reportMismatch("Check: %s (Node: %s, service %q != %q)", check.CheckID, node.Name, hc.ServiceID, serviceID)
+		case hc.Name != check.Name:
+			c.reportMismatch("Check: %s (Node: %s, name %s != %s)", check.CheckID, node.Name, hc.Name, check.Name)
+		case hc.Status != check.Status:
+			c.reportMismatch("Check: %s (Node: %s, status %s != %s)", check.CheckID, node.Name, hc.Status, check.Status)
+		case hc.Notes != check.Notes:
+			c.reportMismatch("Check: %s (Node: %s, notes differ)", check.CheckID, node.Name)
+		case hc.Output != check.Output:
+			c.reportMismatch("Check: %s (Node: %s, output differs)", check.CheckID, node.Name)
+		}
+	}
+
+	for _, check := range node.Checks {
+		verify("", check)
+	}
+	for _, service := range node.Services {
+		for _, instance := range service.Instances {
+			for _, check := range instance.Checks {
+				verify(instance.ID, check)
+			}
+		}
+	}
+
+	if c.extra {
+		for id := range existing {
+			c.reportExtra("Check: %s (Node: %s)", id, node.Name)
+		}
+	}
+}
+
+func (c *verifyCommand) Run(args []string) int {
+	if err := c.flags.Parse(args); err != nil {
+		c.ui.Error(fmt.Sprintf("Failed to parse command line arguments: %v", err))
+		return 1
+	}
+
+	if c.dataPath == "" {
+		c.ui.Error("Must specify the path to the data to verify with the -data flag")
+		return 1
+	}
+
+	data, err := loadData(c.dataPath)
+	if err != nil {
+		c.ui.Error(err.Error())
+		return 1
+	}
+
+	if err := c.verifyData(data); err != nil {
+		c.ui.Error(err.Error())
+		return 1
+	}
+
+	if c.missing > 0 || c.mismatched > 0 || c.extraCount > 0 {
+		c.ui.Error("Consul's state does not match the data")
+		return 2
+	}
+
+	c.ui.Info("Consul's state matches the data")
+	return 0
+}
+
+func (c *verifyCommand) Synopsis() string {
+	return "Verify that Consul contains the generated data"
+}
+
+func (c *verifyCommand) Help() string {
+	return c.help
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/mitchellh/cli"
+	"github.com/mkeeler/consul-data/generate"
+	"github.com/mkeeler/consul-data/generate/catalog"
+	"github.com/mkeeler/consul-data/generate/kv"
+)
+
+// fakeConsul serves the KV, catalog and agent endpoints read by verify from an agent in
+// dc1. Keys are stored by their datacenter, partition and namespace with requests not
+// naming them being made to dc1 and the default partition and namespace.
+type fakeConsul struct {
+	keys  map[kvScope]map[string]*api.KVPair
+	nodes map[catalogScope]map[string]*api.Node
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		keys:  make(map[kvScope]map[string]*api.KVPair),
+		nodes: make(map[catalogScope]map[string]*api.Node),
+	}
+}
+
+func fakeScope(name string, local string) string {
+	if name == "" {
+		return local
+	}
+	return name
+}
+
+func (f *fakeConsul) putKey(datacenter string, partition string, namespace string, key string, value string) {
+	scope := kvScope{datacenter: fakeScope(datacenter, "dc1"), partition: fakeScope(partition, defaultTenancy), namespace: fakeScope(namespace, defaultTenancy)}
+	if f.keys[scope] == nil {
+		f.keys[scope] = make(map[string]*api.KVPair)
+	}
+	f.keys[scope][key] = &api.KVPair{Key: key, Value: []byte(value)}
+}
+
+func (f *fakeConsul) putNode(datacenter string, partition string, node *api.Node) {
+	scope := catalogScope{datacenter: fakeScope(datacenter, "dc1"), partition: fakeScope(partition, defaultTenancy)}
+	if f.nodes[scope] == nil {
+		f.nodes[scope] = make(map[string]*api.Node)
+	}
+	f.nodes[scope][node.Node] = node
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	datacenter := fakeScope(query.Get("dc"), "dc1")
+	partition := fakeScope(query.Get("partition"), defaultTenancy)
+	keys := f.keys[kvScope{datacenter: datacenter, partition: partition, namespace: fakeScope(query.Get("ns"), defaultTenancy)}]
+	nodes := f.nodes[catalogScope{datacenter: datacenter, partition: partition}]
+
+	_, listKeys := query["keys"]
+
+	var out interface{}
+	switch path := r.URL.Path; {
+	case path == "/v1/agent/self":
+		out = map[string]map[string]interface{}{"Config": {"Datacenter": "dc1"}}
+	case path == "/v1/kv/" && listKeys:
+		var names []string
+		for key := range keys {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+		out = names
+	case strings.HasPrefix(path, "/v1/kv/"):
+		pair := keys[strings.TrimPrefix(path, "/v1/kv/")]
+		if pair == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		out = []*api.KVPair{pair}
+	case path == "/v1/catalog/nodes":
+		var list []*api.Node
+		for _, node := range nodes {
+			list = append(list, node)
+		}
+		out = list
+	case strings.HasPrefix(path, "/v1/catalog/node/"):
+		node := nodes[strings.TrimPrefix(path, "/v1/catalog/node/")]
+		if node == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		out = &api.CatalogNode{Node: node}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(out)
+}
+
+func TestVerify_Scopes(t *testing.T) {
+	type scope struct {
+		datacenter string
+		partition  string
+		namespace  string
+	}
+
+	cases := map[string]struct {
+		// scope is that of the data
+		scope scope
+		// extra adds a key and node in the default scope which are not in the data
+		extra bool
+
+		extraCount int64
+	}{
+		"unscoped":           {},
+		"local datacenter":   {scope: scope{datacenter: "dc1"}},
+		"default tenancy":    {scope: scope{partition: defaultTenancy, namespace: defaultTenancy}},
+		"explicit":           {scope: scope{datacenter: "dc1", partition: defaultTenancy, namespace: defaultTenancy}},
+		"extra":              {extra: true, extraCount: 2},
+		"explicit extra":     {scope: scope{datacenter: "dc1", partition: defaultTenancy, namespace: defaultTenancy}, extra: true, extraCount: 2},
+		"other datacenter":   {scope: scope{datacenter: "dc2"}},
+		"other dc and extra": {scope: scope{datacenter: "dc2"}, extra: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			consul := newFakeConsul()
+			data := &generate.Data{KV: make(kv.KV)}
+
+			for _, key := range []string{"a", "b/c"} {
+				consul.putKey(tc.scope.datacenter, tc.scope.partition, tc.scope.namespace, key, "value")
+				data.KV[key] = kv.Value{
+					Value:      "value",
+					Datacenter: tc.scope.datacenter,
+					Partition:  tc.scope.partition,
+					Namespace:  tc.scope.namespace,
+				}
+			}
+
+			consul.putNode(tc.scope.datacenter, tc.scope.partition, &api.Node{Node: "node1", ID: "id1", Address: "10.0.0.1"})
+			data.Catalog = append(data.Catalog, &catalog.Node{
+				Name:       "node1",
+				ID:         "id1",
+				Address:    "10.0.0.1",
+				Datacenter: tc.scope.datacenter,
+				Partition:  tc.scope.partition,
+			})
+
+			if tc.extra {
+				consul.putKey("", "", "", "extra", "value")
+				consul.putNode("", "", &api.Node{Node: "extra"})
+			}
+
+			server := httptest.NewServer(consul)
+			defer server.Close()
+
+			c := newVerifyCommand(cli.NewMockUi()).(*verifyCommand)
+			if err := c.flags.Parse([]string{"-http-addr", server.URL, "-extra"}); err != nil {
+				t.Fatalf("Failed to parse flags: %v", err)
+			}
+
+			if err := c.verifyData(data); err != nil {
+				t.Fatalf("Failed to verify data: %v", err)
+			}
+
+			if c.missing != 0 || c.mismatched != 0 {
+				t.Fatalf("expected no missing or mismatched resources but got %d and %d", c.missing, c.mismatched)
+			}
+			if c.extraCount != tc.extraCount {
+				t.Fatalf("expected %d extra resources but got %d", tc.extraCount, c.extraCount)
+			}
+		})
+	}
+}
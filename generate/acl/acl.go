@@ -0,0 +1,370 @@
+package acl
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/mkeeler/consul-data/generate/generators"
+)
+
+var (
+	// ACL data is only generated when requested as pushing it requires ACLs to be
+	// enabled within Consul.
+	DefaultNumPolicies             = 0
+	DefaultNumRoles                = 0
+	DefaultNumTokens               = 0
+	DefaultMinRulesPerPolicy       = 1
+	DefaultMaxRulesPerPolicy       = 5
+	DefaultMinPoliciesPerRole      = 1
+	DefaultMaxPoliciesPerRole      = 4
+	DefaultMinPoliciesPerToken     = 0
+	DefaultMaxPoliciesPerToken     = 3
+	DefaultMinRolesPerToken        = 0
+	DefaultMaxRolesPerToken        = 3
+	DefaultServiceIdentityFraction = 0.1
+	DefaultDeniedWriteFraction     = 0.1
+	DefaultMaxWriteTokens          = 10000
+)
+
+// ruleAccess are the access levels which generated rules grant
+var ruleAccess = []string{"read", "write", "deny"}
+
+// Policy is the representation of an ACL policy. Rules are in Consul's HCL rule syntax.
+type Policy struct {
+	Name  string
+	Rules string
+}
+
+// Role is the representation of an ACL role. Policies are linked by name.
+type Role struct {
+	Name              string
+	Policies          []string `json:",omitempty"`
+	ServiceIdentities []string `json:",omitempty"`
+}
+
+// Token is the representation of an ACL token. Policies and roles are linked by name.
+type Token struct {
+	AccessorID        string
+	SecretID          string
+	Policies          []string `json:",omitempty"`
+	Roles             []string `json:",omitempty"`
+	ServiceIdentities []string `json:",omitempty"`
+}
+
+// Config is all the configuration necessary for creating ACL data
+type Config struct {
+	NumPolicies             int
+	MinRulesPerPolicy       int
+	MaxRulesPerPolicy       int
+	NumRoles                int
+	MinPoliciesPerRole      int
+	MaxPoliciesPerRole      int
+	NumTokens               int
+	MinPoliciesPerToken     int
+	MaxPoliciesPerToken     int
+	MinRolesPerToken        int
+	MaxRolesPerToken        int
+	ServiceIdentityFraction float64
+	DeniedWriteFraction     float64
+	// MaxWriteTokens is the most tokens generated for writing KV entries and nodes
+	MaxWriteTokens int
+	NameGen        generators.StringGenerator
+
+	// WriteTokens are streamed along with the rest of the ACL data when set
+	WriteTokens *WriteTokens
+
+	// KeyPrefixes and ServiceNames are what the rules of the generated policies refer
+	// to. Service identities are also picked from the service names.
+	KeyPrefixes  []string
+	ServiceNames []string
+
+	// Rand is the source of randomness for generating the ACL data and any default
+	// generators. When nil a new source seeded with the current time is used.
+	Rand *rand.Rand
+}
+
+func DefaultNameGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, "", 2, "-")
+}
+
+// DefaultConfig returns a config with all the defaults filled in.
+func DefaultConfig(rng *rand.Rand) Config {
+	return Config{
+		NumPolicies:             DefaultNumPolicies,
+		MinRulesPerPolicy:       DefaultMinRulesPerPolicy,
+		MaxRulesPerPolicy:       DefaultMaxRulesPerPolicy,
+		NumRoles:                DefaultNumRoles,
+		MinPoliciesPerRole:      DefaultMinPoliciesPerRole,
+		MaxPoliciesPerRole:      DefaultMaxPoliciesPerRole,
+		NumTokens:               DefaultNumTokens,
+		MinPoliciesPerToken:     DefaultMinPoliciesPerToken,
+		MaxPoliciesPerToken:     DefaultMaxPoliciesPerToken,
+		MinRolesPerToken:        DefaultMinRolesPerToken,
+		MaxRolesPerToken:        DefaultMaxRolesPerToken,
+		ServiceIdentityFraction: DefaultServiceIdentityFraction,
+		DeniedWriteFraction:     DefaultDeniedWriteFraction,
+		MaxWriteTokens:          DefaultMaxWriteTokens,
+		NameGen:                 DefaultNameGenerator(rng),
+		Rand:                    rng,
+	}
+}
+
+func (c *Config) normalize() {
+	if c.Rand == nil {
+		c.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	if c.NameGen == nil {
+		c.NameGen = DefaultNameGenerator(c.Rand)
+	}
+
+	if c.MinRulesPerPolicy < 1 {
+		c.MinRulesPerPolicy = 1
+	}
+
+	if c.MaxRulesPerPolicy < c.MinRulesPerPolicy {
+		c.MaxRulesPerPolicy = c.MinRulesPerPolicy
+	}
+
+	if c.MinPoliciesPerRole < 0 {
+		c.MinPoliciesPerRole = 0
+	}
+
+	if c.MaxPoliciesPerRole < c.MinPoliciesPerRole {
+		c.MaxPoliciesPerRole = c.MinPoliciesPerRole
+	}
+
+	if c.MinPoliciesPerToken < 0 {
+		c.MinPoliciesPerToken = 0
+	}
+
+	if c.MaxPoliciesPerToken < c.MinPoliciesPerToken {
+		c.MaxPoliciesPerToken = c.MinPoliciesPerToken
+	}
+
+	if c.MinRolesPerToken < 0 {
+		c.MinRolesPerToken = 0
+	}
+
+	if c.MaxRolesPerToken < c.MinRolesPerToken {
+		c.MaxRolesPerToken = c.MinRolesPerToken
+	}
+
+	if c.ServiceIdentityFraction < 0 {
+		c.ServiceIdentityFraction = 0
+	}
+
+	if c.DeniedWriteFraction < 0 {
+		c.DeniedWriteFraction = 0
+	}
+}
+
+type generatorState struct {
+	rand     *rand.Rand
+	uuidGen  generators.StringGenerator
+	names    map[string]struct{}
+	policies []string
+	roles    []string
+}
+
+// count picks a number in the range [min, max) or min when the range is empty
+func (g *generatorState) count(min int, max int) int {
+	if min < max {
+		return g.rand.Intn(max-min) + min
+	}
+	return min
+}
+
+// pick returns up to n distinct values from the given ones in a random order
+func (g *generatorState) pick(values []string, n int) []string {
+	if n > len(values) {
+		n = len(values)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	picked := make(map[int]struct{}, n)
+	result := make([]string, 0, n)
+	for len(result) < n {
+		i := g.rand.Intn(len(values))
+		if _, found := picked[i]; found {
+			continue
+		}
+		picked[i] = struct{}{}
+		result = append(result, values[i])
+	}
+	return result
+}
+
+func (g *generatorState) genName(conf Config) (string, error) {
+	for {
+		name, err := conf.NameGen()
+		if err != nil {
+			return "", err
+		}
+
+		if _, found := g.names[name]; !found {
+			g.names[name] = struct{}{}
+			return name, nil
+		}
+	}
+}
+
+// genRules generates the HCL rules of a policy, each granting access to one of the
+// KV prefixes or services.
+func (g *generatorState) genRules(conf Config) string {
+	numRules := g.count(conf.MinRulesPerPolicy, conf.MaxRulesPerPolicy)
+
+	// services come after key prefixes in the resources which may be picked
+	numResources := len(conf.KeyPrefixes) + len(conf.ServiceNames)
+	if numResources == 0 {
+		return fmt.Sprintf("key_prefix \"\" {\n  policy = %q\n}\n", ruleAccess[g.rand.Intn(len(ruleAccess))])
+	}
+
+	if numRules > numResources {
+		numRules = numResources
+	}
+
+	var rules strings.Builder
+	picked := make(map[int]struct{}, numRules)
+	for len(picked) < numRules {
+		i := g.rand.Intn(numResources)
+		if _, found := picked[i]; found {
+			continue
+		}
+		picked[i] = struct{}{}
+
+		access := ruleAccess[g.rand.Intn(len(ruleAccess))]
+		if i < len(conf.KeyPrefixes) {
+			fmt.Fprintf(&rules, "key_prefix %q {\n  policy = %q\n}\n", conf.KeyPrefixes[i], access)
+		} else {
+			fmt.Fprintf(&rules, "service %q {\n  policy = %q\n}\n", conf.ServiceNames[i-len(conf.KeyPrefixes)], access)
+		}
+	}
+	return rules.String()
+}
+
+// genServiceIdentities returns a service identity for the given fraction of calls
+func (g *generatorState) genServiceIdentities(conf Config) []string {
+	if conf.ServiceIdentityFraction <= 0 || len(conf.ServiceNames) == 0 {
+		return nil
+	}
+
+	if g.rand.Float64() >= conf.ServiceIdentityFraction {
+		return nil
+	}
+	return []string{conf.ServiceNames[g.rand.Intn(len(conf.ServiceNames))]}
+}
+
+func (g *generatorState) genPolicy(conf Config) (*Policy, error) {
+	name, err := g.genName(conf)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate policy name: %w", err)
+	}
+	g.policies = append(g.policies, name)
+
+	return &Policy{
+		Name:  name,
+		Rules: g.genRules(conf),
+	}, nil
+}
+
+func (g *generatorState) genRole(conf Config) (*Role, error) {
+	name, err := g.genName(conf)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate role name: %w", err)
+	}
+	g.roles = append(g.roles, name)
+
+	return &Role{
+		Name:              name,
+		Policies:          g.pick(g.policies, g.count(conf.MinPoliciesPerRole, conf.MaxPoliciesPerRole)),
+		ServiceIdentities: g.genServiceIdentities(conf),
+	}, nil
+}
+
+func (g *generatorState) genToken(conf Config) (*Token, error) {
+	accessor, err := g.uuidGen()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate token accessor ID: %w", err)
+	}
+
+	secret, err := g.uuidGen()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate token secret ID: %w", err)
+	}
+
+	return &Token{
+		AccessorID:        accessor,
+		SecretID:          secret,
+		Policies:          g.pick(g.policies, g.count(conf.MinPoliciesPerToken, conf.MaxPoliciesPerToken)),
+		Roles:             g.pick(g.roles, g.count(conf.MinRolesPerToken, conf.MaxRolesPerToken)),
+		ServiceIdentities: g.genServiceIdentities(conf),
+	}, nil
+}
+
+// Stream will generate the desired number of policies, roles and tokens in that order
+// invoking the corresponding function with each as soon as it is generated. Only the
+// names of policies and roles are retained so that they can be linked to. The policies
+// of the write tokens come before all others and the tokens after.
+func Stream(conf Config, policyFn func(*Policy) error, roleFn func(*Role) error, tokenFn func(*Token) error) error {
+	conf.normalize()
+
+	g := generatorState{
+		rand:    conf.Rand,
+		uuidGen: generators.UUIDGenerator(conf.Rand),
+		names:   make(map[string]struct{}),
+	}
+
+	var writes WriteTokens
+	if conf.WriteTokens != nil {
+		writes = *conf.WriteTokens
+	}
+
+	for _, policy := range writes.policies {
+		if err := policyFn(policy); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < conf.NumPolicies; i++ {
+		policy, err := g.genPolicy(conf)
+		if err != nil {
+			return err
+		}
+		if err := policyFn(policy); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < conf.NumRoles; i++ {
+		role, err := g.genRole(conf)
+		if err != nil {
+			return err
+		}
+		if err := roleFn(role); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < conf.NumTokens; i++ {
+		token, err := g.genToken(conf)
+		if err != nil {
+			return err
+		}
+		if err := tokenFn(token); err != nil {
+			return err
+		}
+	}
+
+	for _, token := range writes.tokens {
+		if err := tokenFn(token); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package acl
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	cases := map[string]struct {
+		conf         Config
+		keyPrefixes  []string
+		serviceNames []string
+	}{
+		"none":          {},
+		"policies only": {conf: Config{NumPolicies: 10}},
+		"all": {
+			conf:         Config{NumPolicies: 10, NumRoles: 5, NumTokens: 20, MaxPoliciesPerRole: 4, MaxPoliciesPerToken: 3, MaxRolesPerToken: 3, ServiceIdentityFraction: 1},
+			keyPrefixes:  []string{"a/", "b-"},
+			serviceNames: []string{"web", "api"},
+		},
+		"no policies to link": {conf: Config{NumRoles: 3, NumTokens: 3, MinPoliciesPerRole: 2, MaxPoliciesPerRole: 4}},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			conf := tc.conf
+			conf.KeyPrefixes = tc.keyPrefixes
+			conf.ServiceNames = tc.serviceNames
+			conf.Rand = rand.New(rand.NewSource(1))
+
+			names := make(map[string]struct{})
+			policies := make(map[string]struct{})
+			roles := make(map[string]struct{})
+			accessors := make(map[string]struct{})
+			services := make(map[string]struct{})
+			for _, svc := range tc.serviceNames {
+				services[svc] = struct{}{}
+			}
+
+			checkIdentities := func(identities []string) {
+				for _, svc := range identities {
+					if _, found := services[svc]; !found {
+						t.Fatalf("service identity %s isn't a generated service", svc)
+					}
+				}
+			}
+
+			err := Stream(conf, func(policy *Policy) error {
+				if _, found := names[policy.Name]; found {
+					t.Fatalf("name %s was generated more than once", policy.Name)
+				}
+				names[policy.Name] = struct{}{}
+				policies[policy.Name] = struct{}{}
+
+				if !strings.Contains(policy.Rules, "policy = ") {
+					t.Fatalf("policy %s has invalid rules: %s", policy.Name, policy.Rules)
+				}
+				return nil
+			}, func(role *Role) error {
+				if _, found := names[role.Name]; found {
+					t.Fatalf("name %s was generated more than once", role.Name)
+				}
+				names[role.Name] = struct{}{}
+				roles[role.Name] = struct{}{}
+
+				// roles only link to policies which were already handled
+				for _, policy := range role.Policies {
+					if _, found := policies[policy]; !found {
+						t.Fatalf("role %s links to unknown policy %s", role.Name, policy)
+					}
+				}
+				checkIdentities(role.ServiceIdentities)
+				return nil
+			}, func(token *Token) error {
+				if _, found := accessors[token.AccessorID]; found {
+					t.Fatalf("accessor ID %s was generated more than once", token.AccessorID)
+				}
+				accessors[token.AccessorID] = struct{}{}
+
+				for _, policy := range token.Policies {
+					if _, found := policies[policy]; !found {
+						t.Fatalf("token %s links to unknown policy %s", token.AccessorID, policy)
+					}
+				}
+				for _, role := range token.Roles {
+					if _, found := roles[role]; !found {
+						t.Fatalf("token %s links to unknown role %s", token.AccessorID, role)
+					}
+				}
+				checkIdentities(token.ServiceIdentities)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to generate ACL data: %v", err)
+			}
+
+			if len(policies) != tc.conf.NumPolicies || len(roles) != tc.conf.NumRoles || len(accessors) != tc.conf.NumTokens {
+				t.Fatalf("expected %d policies, %d roles and %d tokens but got %d, %d and %d",
+					tc.conf.NumPolicies, tc.conf.NumRoles, tc.conf.NumTokens, len(policies), len(roles), len(accessors))
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package acl
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/mkeeler/consul-data/generate/generators"
+)
+
+type NameType string
+
+const (
+	NameTypePetName NameType = "pet-name"
+
+	DefaultNameType = NameTypePetName
+)
+
+type UserConfig struct {
+	NumPolicies             int
+	MinRulesPerPolicy       int
+	MaxRulesPerPolicy       int
+	NumRoles                int
+	MinPoliciesPerRole      int
+	MaxPoliciesPerRole      int
+	NumTokens               int
+	MinPoliciesPerToken     int
+	MaxPoliciesPerToken     int
+	MinRolesPerToken        int
+	MaxRolesPerToken        int
+	ServiceIdentityFraction float64
+	// DeniedWriteFraction is the fraction of the writes of generated KV entries and
+	// nodes which are given tokens with insufficient permissions.
+	DeniedWriteFraction float64
+	// MaxWriteTokens is the most tokens generated for writing KV entries and nodes.
+	// Each is retained in memory until the ACL data is streamed so further KV prefixes
+	// and nodes are written with the token of the push instead.
+	MaxWriteTokens int
+	NameType       NameType
+
+	PetNames PetNameUserConfig
+}
+
+func (c *UserConfig) ToGeneratorConfig(rng *rand.Rand) (Config, error) {
+	c.Normalize()
+
+	conf := Config{
+		NumPolicies:             c.NumPolicies,
+		MinRulesPerPolicy:       c.MinRulesPerPolicy,
+		MaxRulesPerPolicy:       c.MaxRulesPerPolicy,
+		NumRoles:                c.NumRoles,
+		MinPoliciesPerRole:      c.MinPoliciesPerRole,
+		MaxPoliciesPerRole:      c.MaxPoliciesPerRole,
+		NumTokens:               c.NumTokens,
+		MinPoliciesPerToken:     c.MinPoliciesPerToken,
+		MaxPoliciesPerToken:     c.MaxPoliciesPerToken,
+		MinRolesPerToken:        c.MinRolesPerToken,
+		MaxRolesPerToken:        c.MaxRolesPerToken,
+		ServiceIdentityFraction: c.ServiceIdentityFraction,
+		DeniedWriteFraction:     c.DeniedWriteFraction,
+		MaxWriteTokens:          c.MaxWriteTokens,
+		Rand:                    rng,
+	}
+
+	switch c.NameType {
+	case NameTypePetName:
+		conf.NameGen = c.PetNames.Generator(rng)
+	default:
+		return Config{}, fmt.Errorf("Invalid ACL generator name type: %s", c.NameType)
+	}
+
+	return conf, nil
+}
+
+// Enabled returns whether any ACL data is to be generated. Generated KV entries and
+// nodes are only written with tokens when it is.
+func (c *UserConfig) Enabled() bool {
+	return c.NumPolicies > 0 || c.NumRoles > 0 || c.NumTokens > 0
+}
+
+func (c *UserConfig) Normalize() {
+	if c.NumPolicies < 0 {
+		c.NumPolicies = DefaultNumPolicies
+	}
+
+	if c.NumRoles < 0 {
+		c.NumRoles = DefaultNumRoles
+	}
+
+	if c.NumTokens < 0 {
+		c.NumTokens = DefaultNumTokens
+	}
+
+	if c.MinRulesPerPolicy <= 0 {
+		c.MinRulesPerPolicy = DefaultMinRulesPerPolicy
+	}
+
+	if c.MaxRulesPerPolicy <= 0 {
+		c.MaxRulesPerPolicy = DefaultMaxRulesPerPolicy
+	}
+
+	if c.MaxRulesPerPolicy < c.MinRulesPerPolicy {
+		c.MaxRulesPerPolicy = c.MinRulesPerPolicy
+	}
+
+	if c.MinPoliciesPerRole <= 0 {
+		c.MinPoliciesPerRole = DefaultMinPoliciesPerRole
+	}
+
+	if c.MaxPoliciesPerRole <= 0 {
+		c.MaxPoliciesPerRole = DefaultMaxPoliciesPerRole
+	}
+
+	if c.MaxPoliciesPerRole < c.MinPoliciesPerRole {
+		c.MaxPoliciesPerRole = c.MinPoliciesPerRole
+	}
+
+	if c.MinPoliciesPerToken < 0 {
+		c.MinPoliciesPerToken = DefaultMinPoliciesPerToken
+	}
+
+	if c.MaxPoliciesPerToken <= 0 {
+		c.MaxPoliciesPerToken = DefaultMaxPoliciesPerToken
+	}
+
+	if c.MaxPoliciesPerToken < c.MinPoliciesPerToken {
+		c.MaxPoliciesPerToken = c.MinPoliciesPerToken
+	}
+
+	if c.MinRolesPerToken < 0 {
+		c.MinRolesPerToken = DefaultMinRolesPerToken
+	}
+
+	if c.MaxRolesPerToken <= 0 {
+		c.MaxRolesPerToken = DefaultMaxRolesPerToken
+	}
+
+	if c.MaxRolesPerToken < c.MinRolesPerToken {
+		c.MaxRolesPerToken = c.MinRolesPerToken
+	}
+
+	if c.ServiceIdentityFraction < 0 {
+		c.ServiceIdentityFraction = DefaultServiceIdentityFraction
+	}
+
+	if c.DeniedWriteFraction < 0 {
+		c.DeniedWriteFraction = DefaultDeniedWriteFraction
+	}
+
+	if c.MaxWriteTokens <= 0 {
+		c.MaxWriteTokens = DefaultMaxWriteTokens
+	}
+
+	if c.NameType == "" {
+		c.NameType = DefaultNameType
+	}
+
+	c.PetNames.Normalize()
+}
+
+func DefaultUserConfig() UserConfig {
+	return UserConfig{
+		NumPolicies:             DefaultNumPolicies,
+		MinRulesPerPolicy:       DefaultMinRulesPerPolicy,
+		MaxRulesPerPolicy:       DefaultMaxRulesPerPolicy,
+		NumRoles:                DefaultNumRoles,
+		MinPoliciesPerRole:      DefaultMinPoliciesPerRole,
+		MaxPoliciesPerRole:      DefaultMaxPoliciesPerRole,
+		NumTokens:               DefaultNumTokens,
+		MinPoliciesPerToken:     DefaultMinPoliciesPerToken,
+		MaxPoliciesPerToken:     DefaultMaxPoliciesPerToken,
+		MinRolesPerToken:        DefaultMinRolesPerToken,
+		MaxRolesPerToken:        DefaultMaxRolesPerToken,
+		ServiceIdentityFraction: DefaultServiceIdentityFraction,
+		DeniedWriteFraction:     DefaultDeniedWriteFraction,
+		MaxWriteTokens:          DefaultMaxWriteTokens,
+		NameType:                DefaultNameType,
+
+		PetNames: DefaultPetNameUserConfig(),
+	}
+}
+
+const (
+	PetNameDefaultPrefix    = ""
+	PetNameDefaultSegments  = 2
+	PetNameDefaultSeparator = "-"
+)
+
+type PetNameUserConfig struct {
+	Prefix    string
+	Segments  int
+	Separator string
+}
+
+func (c *PetNameUserConfig) Normalize() {
+	if c.Segments < 1 {
+		c.Segments = PetNameDefaultSegments
+	}
+
+	if c.Separator == "" {
+		c.Separator = PetNameDefaultSeparator
+	}
+}
+
+func (c *PetNameUserConfig) Generator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, c.Prefix, c.Segments, c.Separator)
+}
+
+func DefaultPetNameUserConfig() PetNameUserConfig {
+	return PetNameUserConfig{
+		Prefix:    PetNameDefaultPrefix,
+		Segments:  PetNameDefaultSegments,
+		Separator: PetNameDefaultSeparator,
+	}
+}
@@ -0,0 +1,202 @@
+package acl
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/mkeeler/consul-data/generate/generators"
+)
+
+// WriteToken is a token which generated data is written with
+type WriteToken struct {
+	SecretID string
+	// Denied is set when the token deliberately lacks the permissions for the write
+	Denied bool
+}
+
+type kvScope struct {
+	partition string
+	namespace string
+	prefix    string
+}
+
+type nodeScope struct {
+	datacenter string
+	partition  string
+	name       string
+}
+
+// kvTokens are the tokens for writing to a single KV prefix
+type kvTokens struct {
+	write  string
+	denied string
+}
+
+// WriteTokens generates the tokens which generated KV entries and catalog registrations
+// are written with along with the policies granting them access. The resources must
+// all be added before the ACL data is streamed so that it can be created before any
+// writes are made. A fraction of the writes are deliberately given tokens
+// with only read access so that they will be denied. At most maxTokens tokens are
+// generated, after which resources are added without any and written with the token
+// of the push.
+type WriteTokens struct {
+	rand           *rand.Rand
+	uuidGen        generators.StringGenerator
+	deniedFraction float64
+	maxTokens      int
+
+	policies []*Policy
+	tokens   []*Token
+	kv       map[kvScope]kvTokens
+	nodes    map[nodeScope]WriteToken
+}
+
+// NewWriteTokens returns a WriteTokens which denies the given fraction of writes and
+// generates at most maxTokens tokens
+func NewWriteTokens(rng *rand.Rand, deniedFraction float64, maxTokens int) *WriteTokens {
+	return &WriteTokens{
+		rand:           rng,
+		uuidGen:        generators.UUIDGenerator(rng),
+		deniedFraction: deniedFraction,
+		maxTokens:      maxTokens,
+		kv:             make(map[kvScope]kvTokens),
+		nodes:          make(map[nodeScope]WriteToken),
+	}
+}
+
+// scopedRule wraps a rule in namespace and partition blocks when they are not the defaults
+func scopedRule(partition string, namespace string, rule string) string {
+	if namespace != "" && namespace != "default" {
+		rule = fmt.Sprintf("namespace %q {\n%s}\n", namespace, indent(rule))
+	}
+	if partition != "" && partition != "default" {
+		rule = fmt.Sprintf("partition %q {\n%s}\n", partition, indent(rule))
+	}
+	return rule
+}
+
+func indent(rules string) string {
+	lines := strings.SplitAfter(rules, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "  " + line
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// addToken generates a policy with the given rules along with a token linked to it
+func (w *WriteTokens) addToken(kind string, rules string) (string, error) {
+	accessor, err := w.uuidGen()
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate token accessor ID: %w", err)
+	}
+
+	secret, err := w.uuidGen()
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate token secret ID: %w", err)
+	}
+
+	// the names can't collide with those generated from pet names as they end in a number
+	name := fmt.Sprintf("%s-%d", kind, len(w.policies)+1)
+	w.policies = append(w.policies, &Policy{Name: name, Rules: rules})
+	w.tokens = append(w.tokens, &Token{
+		AccessorID: accessor,
+		SecretID:   secret,
+		Policies:   []string{name},
+	})
+	return secret, nil
+}
+
+// AddKV generates the tokens for writing to the KV prefix unless it was already added
+func (w *WriteTokens) AddKV(partition string, namespace string, prefix string) error {
+	scope := kvScope{partition: partition, namespace: namespace, prefix: prefix}
+	if _, found := w.kv[scope]; found {
+		return nil
+	}
+
+	needed := 1
+	if w.deniedFraction > 0 {
+		needed = 2
+	}
+	if len(w.tokens)+needed > w.maxTokens {
+		return nil
+	}
+
+	var tokens kvTokens
+	var err error
+	tokens.write, err = w.addToken("kv-write", scopedRule(partition, namespace, fmt.Sprintf("key_prefix %q {\n  policy = \"write\"\n}\n", prefix)))
+	if err != nil {
+		return err
+	}
+
+	if w.deniedFraction > 0 {
+		tokens.denied, err = w.addToken("kv-read", scopedRule(partition, namespace, fmt.Sprintf("key_prefix %q {\n  policy = \"read\"\n}\n", prefix)))
+		if err != nil {
+			return err
+		}
+	}
+
+	w.kv[scope] = tokens
+	return nil
+}
+
+// KVToken picks the token for writing a key with the given prefix. AddKV must have been
+// called for the prefix. No token is returned when it was added beyond the limit.
+func (w *WriteTokens) KVToken(partition string, namespace string, prefix string) WriteToken {
+	tokens, found := w.kv[kvScope{partition: partition, namespace: namespace, prefix: prefix}]
+	if !found {
+		return WriteToken{}
+	}
+	if w.deniedFraction > 0 && w.rand.Float64() < w.deniedFraction {
+		return WriteToken{SecretID: tokens.denied, Denied: true}
+	}
+	return WriteToken{SecretID: tokens.write}
+}
+
+// AddNode generates the token for registering a node along with its services. The
+// services map the name of each service to its namespace. Tokens which are denied
+// are only granted read access to the node.
+func (w *WriteTokens) AddNode(datacenter string, partition string, name string, services map[string]string) error {
+	scope := nodeScope{datacenter: datacenter, partition: partition, name: name}
+	if _, found := w.nodes[scope]; found || len(w.tokens) >= w.maxTokens {
+		return nil
+	}
+
+	token := WriteToken{}
+	access := "write"
+	if w.deniedFraction > 0 && w.rand.Float64() < w.deniedFraction {
+		token.Denied = true
+		access = "read"
+	}
+
+	var rules strings.Builder
+	rules.WriteString(scopedRule(partition, "", fmt.Sprintf("node %q {\n  policy = %q\n}\n", name, access)))
+
+	serviceNames := make([]string, 0, len(services))
+	for service := range services {
+		serviceNames = append(serviceNames, service)
+	}
+	// sorted so that the rules don't depend on map iteration order
+	sort.Strings(serviceNames)
+	for _, service := range serviceNames {
+		rules.WriteString(scopedRule(partition, services[service], fmt.Sprintf("service %q {\n  policy = \"write\"\n}\n", service)))
+	}
+
+	var err error
+	token.SecretID, err = w.addToken("node", rules.String())
+	if err != nil {
+		return err
+	}
+
+	w.nodes[scope] = token
+	return nil
+}
+
+// NodeToken returns the token for registering a node. AddNode must have been called
+// for the node. No token is returned when it was added beyond the limit.
+func (w *WriteTokens) NodeToken(datacenter string, partition string, name string) WriteToken {
+	return w.nodes[nodeScope{datacenter: datacenter, partition: partition, name: name}]
+}
@@ -0,0 +1,268 @@
+package acl
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestScopedRule(t *testing.T) {
+	rule := "key_prefix \"a/\" {\n  policy = \"write\"\n}\n"
+
+	cases := map[string]struct {
+		partition string
+		namespace string
+		expected  string
+	}{
+		"unscoped": {expected: rule},
+		"defaults": {partition: "default", namespace: "default", expected: rule},
+		"namespace": {
+			namespace: "ns",
+			expected:  "namespace \"ns\" {\n  key_prefix \"a/\" {\n    policy = \"write\"\n  }\n}\n",
+		},
+		"partition": {
+			partition: "part",
+			expected:  "partition \"part\" {\n  key_prefix \"a/\" {\n    policy = \"write\"\n  }\n}\n",
+		},
+		"both": {
+			partition: "part",
+			namespace: "ns",
+			expected:  "partition \"part\" {\n  namespace \"ns\" {\n    key_prefix \"a/\" {\n      policy = \"write\"\n    }\n  }\n}\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if actual := scopedRule(tc.partition, tc.namespace, rule); actual != tc.expected {
+				t.Fatalf("expected rule:\n%s\nbut got:\n%s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWriteTokens_KV(t *testing.T) {
+	cases := map[string]struct {
+		deniedFraction float64
+		maxTokens      int
+		prefixes       []string
+		tokens         int
+		withTokens     []string
+		denied         bool
+	}{
+		"no denied tokens": {
+			maxTokens:  10,
+			prefixes:   []string{"a/", "b/", "a/"},
+			tokens:     2,
+			withTokens: []string{"a/", "b/"},
+		},
+		"all denied": {
+			deniedFraction: 1,
+			maxTokens:      10,
+			prefixes:       []string{"a/", "b/", "a/"},
+			tokens:         4,
+			withTokens:     []string{"a/", "b/"},
+			denied:         true,
+		},
+		"limited": {
+			maxTokens:  1,
+			prefixes:   []string{"a/", "b/"},
+			tokens:     1,
+			withTokens: []string{"a/"},
+		},
+		"limited with denied tokens": {
+			deniedFraction: 1,
+			maxTokens:      3,
+			prefixes:       []string{"a/", "b/"},
+			tokens:         2,
+			withTokens:     []string{"a/"},
+			denied:         true,
+		},
+		"none allowed": {
+			maxTokens: 0,
+			prefixes:  []string{"a/"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			w := NewWriteTokens(rand.New(rand.NewSource(1)), tc.deniedFraction, tc.maxTokens)
+			for _, prefix := range tc.prefixes {
+				if err := w.AddKV("", "", prefix); err != nil {
+					t.Fatalf("Failed to add KV prefix %s: %v", prefix, err)
+				}
+			}
+
+			if len(w.tokens) != tc.tokens || len(w.policies) != tc.tokens {
+				t.Fatalf("expected %d tokens and policies but got %d and %d", tc.tokens, len(w.tokens), len(w.policies))
+			}
+
+			withTokens := make(map[string]struct{})
+			for _, prefix := range tc.withTokens {
+				withTokens[prefix] = struct{}{}
+			}
+
+			for _, prefix := range tc.prefixes {
+				token := w.KVToken("", "", prefix)
+				if _, found := withTokens[prefix]; !found {
+					if token != (WriteToken{}) {
+						t.Fatalf("expected no token for prefix %s but got %+v", prefix, token)
+					}
+					continue
+				}
+
+				if token.SecretID == "" || token.Denied != tc.denied {
+					t.Fatalf("expected a token with denied %t for prefix %s but got %+v", tc.denied, prefix, token)
+				}
+			}
+
+			if token := w.KVToken("", "", "unknown/"); token != (WriteToken{}) {
+				t.Fatalf("expected no token for an unknown prefix but got %+v", token)
+			}
+		})
+	}
+}
+
+func TestWriteTokens_KVScopes(t *testing.T) {
+	w := NewWriteTokens(rand.New(rand.NewSource(1)), 0, 10)
+	if err := w.AddKV("part", "ns", "a/"); err != nil {
+		t.Fatalf("Failed to add KV prefix: %v", err)
+	}
+
+	if token := w.KVToken("", "", "a/"); token.SecretID != "" {
+		t.Fatalf("expected no token for the prefix outside of the scope but got %+v", token)
+	}
+	if token := w.KVToken("part", "ns", "a/"); token.SecretID != w.tokens[0].SecretID {
+		t.Fatalf("expected the token of the scope but got %+v", token)
+	}
+
+	rules := w.policies[0].Rules
+	for _, expected := range []string{"partition \"part\"", "namespace \"ns\"", "key_prefix \"a/\"", "policy = \"write\""} {
+		if !strings.Contains(rules, expected) {
+			t.Fatalf("expected rules to contain %s:\n%s", expected, rules)
+		}
+	}
+}
+
+func TestWriteTokens_Node(t *testing.T) {
+	services := map[string]string{"web": "", "api": "ns"}
+
+	cases := map[string]struct {
+		deniedFraction float64
+		maxTokens      int
+		nodes          []string
+		tokens         int
+		access         string
+		without        []string
+	}{
+		"write": {
+			maxTokens: 10,
+			nodes:     []string{"node-1", "node-2", "node-1"},
+			tokens:    2,
+			access:    "write",
+		},
+		"denied": {
+			deniedFraction: 1,
+			maxTokens:      10,
+			nodes:          []string{"node-1", "node-2"},
+			tokens:         2,
+			access:         "read",
+		},
+		"limited": {
+			maxTokens: 1,
+			nodes:     []string{"node-1", "node-2"},
+			tokens:    1,
+			access:    "write",
+			without:   []string{"node-2"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			w := NewWriteTokens(rand.New(rand.NewSource(1)), tc.deniedFraction, tc.maxTokens)
+			for _, node := range tc.nodes {
+				if err := w.AddNode("dc1", "", node, services); err != nil {
+					t.Fatalf("Failed to add node %s: %v", node, err)
+				}
+			}
+
+			if len(w.tokens) != tc.tokens {
+				t.Fatalf("expected %d tokens but got %d", tc.tokens, len(w.tokens))
+			}
+
+			for i, policy := range w.policies {
+				node := tc.nodes[i]
+				for _, expected := range []string{
+					"node \"" + node + "\" {\n  policy = \"" + tc.access + "\"",
+					"service \"web\" {\n  policy = \"write\"",
+					"namespace \"ns\" {\n  service \"api\"",
+				} {
+					if !strings.Contains(policy.Rules, expected) {
+						t.Fatalf("expected rules of %s to contain %q:\n%s", node, expected, policy.Rules)
+					}
+				}
+
+				token := w.NodeToken("dc1", "", node)
+				if token.SecretID != w.tokens[i].SecretID || token.Denied != (tc.access == "read") {
+					t.Fatalf("unexpected token for %s: %+v", node, token)
+				}
+				if token := w.NodeToken("dc2", "", node); token.SecretID != "" {
+					t.Fatalf("expected no token for %s in another datacenter but got %+v", node, token)
+				}
+			}
+
+			for _, node := range tc.without {
+				if token := w.NodeToken("dc1", "", node); token != (WriteToken{}) {
+					t.Fatalf("expected no token for %s beyond the limit but got %+v", node, token)
+				}
+			}
+		})
+	}
+}
+
+func TestStream_WriteTokens(t *testing.T) {
+	w := NewWriteTokens(rand.New(rand.NewSource(1)), 0.5, 10)
+	if err := w.AddKV("", "", "a/"); err != nil {
+		t.Fatalf("Failed to add KV prefix: %v", err)
+	}
+	if err := w.AddNode("dc1", "", "node-1", nil); err != nil {
+		t.Fatalf("Failed to add node: %v", err)
+	}
+
+	conf := Config{NumPolicies: 2, NumTokens: 2, Rand: rand.New(rand.NewSource(1)), WriteTokens: w}
+
+	var policies []string
+	var tokens []string
+	err := Stream(conf, func(policy *Policy) error {
+		policies = append(policies, policy.Name)
+		return nil
+	}, func(role *Role) error {
+		return nil
+	}, func(token *Token) error {
+		tokens = append(tokens, token.SecretID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to generate ACL data: %v", err)
+	}
+
+	// write policies come first so that nothing else has to link to them and their
+	// tokens last so that they can be used as soon as they are created
+	expectedPolicies := []string{"kv-write-1", "kv-read-2", "node-3"}
+	if len(policies) != len(expectedPolicies)+2 {
+		t.Fatalf("expected %d policies but got %v", len(expectedPolicies)+2, policies)
+	}
+	for i, name := range expectedPolicies {
+		if policies[i] != name {
+			t.Fatalf("expected policy %d to be %s but got %s", i, name, policies[i])
+		}
+	}
+
+	if len(tokens) != len(w.tokens)+2 {
+		t.Fatalf("expected %d tokens but got %d", len(w.tokens)+2, len(tokens))
+	}
+	for i, token := range w.tokens {
+		if tokens[i+2] != token.SecretID {
+			t.Fatalf("expected write token %d to be streamed last", i)
+		}
+	}
+}
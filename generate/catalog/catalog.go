@@ -3,17 +3,48 @@ package catalog
 import (
 	"fmt"
 	"math/rand"
+	"time"
 
 	"github.com/mkeeler/consul-data/generate/generators"
 )
 
-var (
-	DefaultNodeNameGenerator    = generators.PetNameGenerator("", 3, "-")
-	DefaultServiceNameGenerator = generators.PetNameGenerator("", 2, "-")
-	DefaultMetaKeyGenerator     = generators.PetNameGenerator("", 1, "")
-	DefaultMetaValueGenerator   = generators.RandomB64Generator(64, 128)
-	DefaultAddressGenerator     = generators.RandomTestingIPGenerator()
+func DefaultNodeNameGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, "", 3, "-")
+}
+
+func DefaultServiceNameGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, "", 2, "-")
+}
+
+func DefaultMetaKeyGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, "", 1, "")
+}
+
+func DefaultMetaValueGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.RandomB64Generator(rng, 64, 128)
+}
+
+func DefaultTagGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, "", 1, "")
+}
+
+func DefaultCheckNameGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, "", 2, "-")
+}
+
+func DefaultCheckNotesGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.EmptyGenerator()
+}
+
+func DefaultCheckOutputGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.RandomB64Generator(rng, 64, 256)
+}
+
+func DefaultAddressGenerator(rng *rand.Rand) generators.IPGenerator {
+	return generators.RandomTestingIPGenerator(rng)
+}
 
+var (
 	DefaultNumNodes               = 1024
 	DefaultMinServicesPerNode     = 8
 	DefaultMaxServicesPerNode     = 32
@@ -23,16 +54,39 @@ var (
 	DefaultMaxMetaPerNode         = 8
 	DefaultMinMetaPerService      = 4
 	DefaultMaxMetaPerService      = 8
+	DefaultMinTagsPerInstance     = 0
+	DefaultMaxTagsPerInstance     = 4
+	DefaultTagVocabularySize      = 32
+	DefaultSidecarFraction        = 0.0
+	DefaultMinUpstreams           = 1
+	DefaultMaxUpstreams           = 4
+	DefaultMinChecksPerNode       = 1
+	DefaultMaxChecksPerNode       = 1
+	DefaultMinChecksPerInstance   = 1
+	DefaultMaxChecksPerInstance   = 3
+	DefaultCheckStatusWeights     = CheckStatusWeights{
+		Passing:  90,
+		Warning:  7,
+		Critical: 3,
+	}
 )
 
 // Node is the representation of a node
 type Node struct {
 	Datacenter string `json:",omitempty"`
+	Partition  string `json:",omitempty"`
 	Address    string
 	ID         string
 	Name       string
 	Meta       map[string]string `json:",omitempty"`
+	Checks     []*Check          `json:",omitempty"`
 	Services   []*Service
+	// Coordinate is the node's network coordinate when coordinates are generated
+	Coordinate *Coordinate `json:",omitempty"`
+	// Token is what the node and its services are registered with. ExpectDenied is
+	// set when it deliberately lacks permission to register the node.
+	Token        string `json:",omitempty"`
+	ExpectDenied bool   `json:",omitempty"`
 }
 
 type Service struct {
@@ -41,11 +95,16 @@ type Service struct {
 }
 
 type ServiceInstance struct {
-	Name    string
-	Address string
-	ID      string `json:",omitempty"`
-	Port    int
-	Meta    map[string]string `json:",omitempty"`
+	Name      string
+	Address   string
+	ID        string `json:",omitempty"`
+	Port      int
+	Kind      string            `json:",omitempty"`
+	Namespace string            `json:",omitempty"`
+	Proxy     *Proxy            `json:",omitempty"`
+	Tags      []string          `json:",omitempty"`
+	Meta      map[string]string `json:",omitempty"`
+	Checks    []*Check          `json:",omitempty"`
 }
 
 // Catalog is the output format of the generated catalog data before serialized to JSON.
@@ -62,16 +121,56 @@ type Config struct {
 	MaxMetaPerNode         int
 	MinMetaPerService      int
 	MaxMetaPerService      int
+	MinTagsPerInstance     int
+	MaxTagsPerInstance     int
+	TagVocabularySize      int
+	SidecarFraction        float64
+	MinUpstreams           int
+	MaxUpstreams           int
+	NumMeshGateways        int
+	NumTerminatingGateways int
+	NumIngressGateways     int
+	ServiceGraph           GraphConfig
+	Coordinates            CoordinateConfig
+	MinChecksPerNode       int
+	MaxChecksPerNode       int
+	MinChecksPerInstance   int
+	MaxChecksPerInstance   int
+	CheckStatusWeights     CheckStatusWeights
 	NodeGen                generators.StringGenerator
 	ServiceGen             generators.StringGenerator
 	ServiceIDGen           generators.StringGenerator
 	MetaKeyGen             generators.StringGenerator
 	MetaValueGen           generators.StringGenerator
 	AddressGen             generators.IPGenerator
+	TagGen                 generators.StringGenerator
+	CheckNameGen           generators.StringGenerator
+	CheckNotesGen          generators.StringGenerator
+	CheckOutputGen         generators.StringGenerator
+	// DatacenterGen picks the datacenter of each node. When nil nodes are not assigned
+	// a datacenter and will be registered in the datacenter of the agent.
+	DatacenterGen generators.StringGenerator
+	// PartitionGen picks the admin partition of each node and NamespaceGen the namespace
+	// of each service. When nil the defaults are used.
+	PartitionGen generators.StringGenerator
+	NamespaceGen generators.StringGenerator
+
+	// Graph is the service dependency graph which service names and proxy upstreams
+	// are taken from. When nil and ServiceGraph.NumServices is not zero it will be
+	// generated.
+	Graph ServiceGraph
+
+	// Rand is the source of randomness for generating the catalog and any default
+	// generators. When nil a new source seeded with the current time is used.
+	Rand *rand.Rand
+	// CoordinateRand is the source of randomness for generating coordinates so that
+	// enabling them doesn't change the rest of the catalog. When nil a new source
+	// seeded with the current time is used.
+	CoordinateRand *rand.Rand
 }
 
 // DefaultConfig returns a config with all the defaults filled in.
-func DefaultConfig() Config {
+func DefaultConfig(rng *rand.Rand) Config {
 	return Config{
 		NumNodes:               DefaultNumNodes,
 		MinServicesPerNode:     DefaultMinServicesPerNode,
@@ -82,10 +181,29 @@ func DefaultConfig() Config {
 		MaxMetaPerNode:         DefaultMaxMetaPerNode,
 		MinMetaPerService:      DefaultMinMetaPerService,
 		MaxMetaPerService:      DefaultMaxMetaPerService,
-		NodeGen:                DefaultNodeNameGenerator,
-		ServiceGen:             DefaultServiceNameGenerator,
-		MetaKeyGen:             DefaultMetaKeyGenerator,
-		AddressGen:             DefaultAddressGenerator,
+		MinTagsPerInstance:     DefaultMinTagsPerInstance,
+		MaxTagsPerInstance:     DefaultMaxTagsPerInstance,
+		TagVocabularySize:      DefaultTagVocabularySize,
+		SidecarFraction:        DefaultSidecarFraction,
+		MinUpstreams:           DefaultMinUpstreams,
+		MaxUpstreams:           DefaultMaxUpstreams,
+		ServiceGraph:           DefaultGraphConfig(),
+		Coordinates:            DefaultCoordinateConfig(),
+		MinChecksPerNode:       DefaultMinChecksPerNode,
+		MaxChecksPerNode:       DefaultMaxChecksPerNode,
+		MinChecksPerInstance:   DefaultMinChecksPerInstance,
+		MaxChecksPerInstance:   DefaultMaxChecksPerInstance,
+		CheckStatusWeights:     DefaultCheckStatusWeights,
+		NodeGen:                DefaultNodeNameGenerator(rng),
+		ServiceGen:             DefaultServiceNameGenerator(rng),
+		MetaKeyGen:             DefaultMetaKeyGenerator(rng),
+		MetaValueGen:           DefaultMetaValueGenerator(rng),
+		AddressGen:             DefaultAddressGenerator(rng),
+		TagGen:                 DefaultTagGenerator(rng),
+		CheckNameGen:           DefaultCheckNameGenerator(rng),
+		CheckNotesGen:          DefaultCheckNotesGenerator(rng),
+		CheckOutputGen:         DefaultCheckOutputGenerator(rng),
+		Rand:                   rng,
 	}
 }
 
@@ -104,39 +222,59 @@ func uniqueString(gen generators.StringGenerator, isUnique func(string) bool) (s
 
 // when determining service ids
 type generatorState struct {
-	// map of map to int where the outer map's keys are node names
-	// and the inner maps keys are service names. The inner map value
-	// represents how many of this named service were assigned to this node
-	nodeAndServiceNames map[string]map[string]int
+	// map of service names to how many of this named service were assigned to
+	// the node being generated
+	nodeServices map[string]int
 
-	nodeIds map[string]struct{}
-}
+	rand      *rand.Rand
+	nodeIDGen generators.StringGenerator
+
+	// the vocabulary of tags which service instance tags are picked from
+	tags []string
+
+	// the distinct service names generated so far which proxy upstreams are picked from
+	serviceNames   []string
+	serviceNameSet map[string]struct{}
+
+	// the index of the node being generated
+	nodeIndex int
+
+	// the service dependency graph indexed by service name
+	graph map[string]*GraphService
 
-func (g *generatorState) initNode(name string) {
-	g.nodeAndServiceNames[name] = make(map[string]int)
+	// coords places nodes when coordinates are generated
+	coords *coordinateState
 }
 
-func (g *generatorState) nodeNameIsUnique(name string) bool {
-	_, found := g.nodeAndServiceNames[name]
-	return !found
+// initNode resets the state kept for the node being generated
+func (g *generatorState) initNode() {
+	g.nodeServices = make(map[string]int)
 }
 
-func (g *generatorState) svcID(node string, svc string) string {
-	services := g.nodeAndServiceNames[node]
+// uniqueNodeName makes the generated name unique by suffixing it with the index of the node
+// so that the names of the nodes generated so far don't need to be kept.
+func (g *generatorState) uniqueNodeName(name string) string {
+	return fmt.Sprintf("%s-%d", name, g.nodeIndex)
+}
 
-	if services == nil {
-		return svc
-	}
+func (g *generatorState) svcID(svc string) string {
+	g.nodeServices[svc] += 1
 
-	services[svc] += 1
+	return fmt.Sprintf("%s-%d", svc, g.nodeServices[svc])
+}
 
-	return fmt.Sprintf("%s-%d", svc, services[svc])
+// count picks how many of something to generate within the given bounds
+func (g *generatorState) count(min int, max int) int {
+	if min < max {
+		return g.rand.Intn(max-min) + min
+	}
+	return min
 }
 
 func (g *generatorState) genMeta(minEntries int, maxEntries int, keyGen generators.StringGenerator, valueGen generators.StringGenerator) (map[string]string, error) {
 	numEntries := minEntries
 	if minEntries < maxEntries {
-		numEntries = rand.Intn(maxEntries-minEntries) + minEntries
+		numEntries = g.rand.Intn(maxEntries-minEntries) + minEntries
 	}
 
 	meta := make(map[string]string)
@@ -154,7 +292,7 @@ func (g *generatorState) genMeta(minEntries int, maxEntries int, keyGen generato
 			return nil, fmt.Errorf("Failed to generate meta key: %w", err)
 		}
 
-		meta[key] = meta[value]
+		meta[key] = value
 	}
 	return meta, nil
 }
@@ -170,12 +308,28 @@ func (g *generatorState) genServiceMeta(conf Config) (map[string]string, error)
 func (g *generatorState) genService(nodeName string, conf Config) (*Service, error) {
 	numInstances := conf.MinInstancesPerService
 	if conf.MinInstancesPerService < conf.MaxInstancesPerService {
-		numInstances = rand.Intn(conf.MaxInstancesPerService-conf.MinInstancesPerService) + conf.MinInstancesPerService
+		numInstances = g.rand.Intn(conf.MaxInstancesPerService-conf.MinInstancesPerService) + conf.MinInstancesPerService
+	}
+
+	var svcName string
+	if len(conf.Graph) > 0 {
+		svcName = conf.Graph[g.rand.Intn(len(conf.Graph))].Name
+	} else {
+		var err error
+		svcName, err = conf.ServiceGen()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate service name: %w", err)
+		}
 	}
 
-	svcName, err := conf.ServiceGen()
+	namespace, err := conf.NamespaceGen()
 	if err != nil {
-		return nil, fmt.Errorf("Failed to generate service name: %w", err)
+		return nil, fmt.Errorf("Failed to generate service namespace: %w", err)
+	}
+
+	if _, found := g.serviceNameSet[svcName]; !found {
+		g.serviceNameSet[svcName] = struct{}{}
+		g.serviceNames = append(g.serviceNames, svcName)
 	}
 
 	data := make([]*ServiceInstance, 0, numInstances)
@@ -185,6 +339,7 @@ func (g *generatorState) genService(nodeName string, conf Config) (*Service, err
 		if err != nil {
 			return nil, fmt.Errorf("Failed to generate Service: %w", err)
 		}
+		service.Namespace = namespace
 
 		data = append(data, service)
 	}
@@ -206,19 +361,31 @@ func (g *generatorState) genServiceInstance(nodeName string, svcName string, con
 		return nil, fmt.Errorf("Failed to generate service meta: %w", err)
 	}
 
+	id := g.svcID(svcName)
+	port := g.rand.Intn(65535)
+
+	tags := g.genTags(conf)
+
+	checks, err := g.genInstanceChecks(id, conf)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate service checks: %w", err)
+	}
+
 	return &ServiceInstance{
 		Name:    svcName,
 		Address: addr.String(),
-		ID:      g.svcID(nodeName, svcName),
-		Port:    rand.Intn(65535),
+		ID:      id,
+		Port:    port,
+		Tags:    tags,
 		Meta:    meta,
+		Checks:  checks,
 	}, nil
 }
 
 func (g *generatorState) genServices(nodeName string, conf Config) ([]*Service, error) {
 	numServices := conf.MinServicesPerNode
 	if conf.MinServicesPerNode < conf.MaxServicesPerNode {
-		numServices = rand.Intn(conf.MaxServicesPerNode-conf.MinServicesPerNode) + conf.MinServicesPerNode
+		numServices = g.rand.Intn(conf.MaxServicesPerNode-conf.MinServicesPerNode) + conf.MinServicesPerNode
 	}
 
 	data := make([]*Service, 0, numServices)
@@ -230,82 +397,201 @@ func (g *generatorState) genServices(nodeName string, conf Config) ([]*Service,
 		}
 
 		data = append(data, service)
+
+		if sidecars := g.genSidecars(service, conf); sidecars != nil {
+			data = append(data, sidecars)
+		}
 	}
-	return data, nil
+
+	gateways, err := g.genGateways(nodeName, conf)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate gateways: %w", err)
+	}
+
+	return append(data, gateways...), nil
 }
 
 func (g *generatorState) genNode(conf Config) (*Node, error) {
-	nodeName, err := uniqueString(conf.NodeGen, g.nodeNameIsUnique)
+	name, err := conf.NodeGen()
 	if err != nil {
 		return nil, fmt.Errorf("Failed to generate node name: %w", err)
 	}
+	nodeName := g.uniqueNodeName(name)
 
-	nodeID, err := uniqueString(generators.UUIDGen, func(val string) bool {
-		_, found := g.nodeIds[val]
-		return !found
-	})
+	nodeID, err := g.nodeIDGen()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate node ID: %w", err)
+	}
 
-	g.initNode(nodeName)
+	g.initNode()
 
 	addr, err := conf.AddressGen()
 	if err != nil {
 		return nil, fmt.Errorf("Failed to generate node address: %w", err)
 	}
 
+	datacenter, err := conf.DatacenterGen()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate node datacenter: %w", err)
+	}
+
+	partition, err := conf.PartitionGen()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate node partition: %w", err)
+	}
+
 	meta, err := g.genNodeMeta(conf)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to generate node meta: %w", err)
 	}
 
+	checks, err := g.genNodeChecks(conf)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate node checks: %w", err)
+	}
+
 	services, err := g.genServices(nodeName, conf)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to generate services for node: %w", err)
 	}
 
+	var coord *Coordinate
+	if g.coords != nil {
+		coord = g.coords.genCoordinate(conf.Coordinates, datacenter)
+	}
+
 	return &Node{
-		Address:  addr.String(),
-		ID:       nodeID,
-		Name:     nodeName,
-		Meta:     meta,
-		Services: services,
+		Datacenter: datacenter,
+		Partition:  partition,
+		Address:    addr.String(),
+		ID:         nodeID,
+		Name:       nodeName,
+		Meta:       meta,
+		Checks:     checks,
+		Services:   services,
+		Coordinate: coord,
 	}, nil
 }
 
 // Generate will generate the desired number of KV entries giving the supplied config
 func Generate(conf Config) (Catalog, error) {
+	var data Catalog
+	err := Stream(conf, func(node *Node) error {
+		data = append(data, node)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Stream will generate the desired number of nodes giving the supplied config and
+// invoke fn with each node, including all of its services, as soon as it is generated.
+// Nodes are not retained in memory once generated.
+func Stream(conf Config, fn func(node *Node) error) error {
 	conf.normalize()
 
-	data := make(Catalog, 0, conf.NumNodes)
+	if conf.Graph == nil {
+		graph, err := GenerateGraph(conf)
+		if err != nil {
+			return fmt.Errorf("Failed to generate service graph: %w", err)
+		}
+		conf.Graph = graph
+	}
 
-	g := generatorState{nodeAndServiceNames: make(map[string]map[string]int)}
+	g := generatorState{
+		rand:           conf.Rand,
+		nodeIDGen:      generators.UUIDGenerator(conf.Rand),
+		serviceNameSet: make(map[string]struct{}),
+		graph:          make(map[string]*GraphService),
+	}
+
+	for _, svc := range conf.Graph {
+		g.graph[svc.Name] = svc
+	}
+
+	if conf.Coordinates.NumZones > 0 {
+		g.coords = &coordinateState{
+			rand:  conf.CoordinateRand,
+			zones: make(map[string][]*coordinateZone),
+		}
+	}
+
+	if err := g.genTagVocabulary(conf); err != nil {
+		return err
+	}
 
 	for i := 0; i < conf.NumNodes; i++ {
+		g.nodeIndex = i
 		node, err := g.genNode(conf)
 		if err != nil {
-			return nil, fmt.Errorf("Failed to generate Node: %w", err)
+			return fmt.Errorf("Failed to generate Node: %w", err)
 		}
 
-		data = append(data, node)
+		if err := fn(node); err != nil {
+			return err
+		}
 	}
 
-	return data, nil
+	return nil
 }
 
 func (c *Config) normalize() {
+	if c.Rand == nil {
+		c.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	if c.CoordinateRand == nil {
+		c.CoordinateRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
 	if c.NodeGen == nil {
-		c.NodeGen = DefaultNodeNameGenerator
+		c.NodeGen = DefaultNodeNameGenerator(c.Rand)
+	}
+
+	if c.DatacenterGen == nil {
+		c.DatacenterGen = generators.EmptyGenerator()
+	}
+
+	if c.PartitionGen == nil {
+		c.PartitionGen = generators.EmptyGenerator()
+	}
+
+	if c.NamespaceGen == nil {
+		c.NamespaceGen = generators.EmptyGenerator()
 	}
 
 	if c.ServiceGen == nil {
-		c.ServiceGen = DefaultServiceNameGenerator
+		c.ServiceGen = DefaultServiceNameGenerator(c.Rand)
 	}
 
 	if c.MetaKeyGen == nil {
-		c.MetaKeyGen = DefaultMetaKeyGenerator
+		c.MetaKeyGen = DefaultMetaKeyGenerator(c.Rand)
 	}
 
 	if c.MetaValueGen == nil {
-		c.MetaValueGen = DefaultMetaValueGenerator
+		c.MetaValueGen = DefaultMetaValueGenerator(c.Rand)
+	}
+
+	if c.AddressGen == nil {
+		c.AddressGen = DefaultAddressGenerator(c.Rand)
+	}
+
+	if c.TagGen == nil {
+		c.TagGen = DefaultTagGenerator(c.Rand)
+	}
+
+	if c.CheckNameGen == nil {
+		c.CheckNameGen = DefaultCheckNameGenerator(c.Rand)
+	}
+
+	if c.CheckNotesGen == nil {
+		c.CheckNotesGen = DefaultCheckNotesGenerator(c.Rand)
+	}
+
+	if c.CheckOutputGen == nil {
+		c.CheckOutputGen = DefaultCheckOutputGenerator(c.Rand)
 	}
 
 	if c.NumNodes < 1 {
@@ -335,4 +621,65 @@ func (c *Config) normalize() {
 	if c.MaxMetaPerService < c.MinMetaPerService {
 		c.MaxMetaPerService = c.MinMetaPerService
 	}
+
+	if c.MinTagsPerInstance < 0 {
+		c.MinTagsPerInstance = 0
+	}
+
+	if c.MaxTagsPerInstance < c.MinTagsPerInstance {
+		c.MaxTagsPerInstance = c.MinTagsPerInstance
+	}
+
+	if c.TagVocabularySize < c.MaxTagsPerInstance {
+		c.TagVocabularySize = c.MaxTagsPerInstance
+	}
+
+	if c.SidecarFraction < 0 {
+		c.SidecarFraction = 0
+	}
+
+	if c.SidecarFraction > 1 {
+		c.SidecarFraction = 1
+	}
+
+	if c.MinUpstreams < 0 {
+		c.MinUpstreams = 0
+	}
+
+	if c.MaxUpstreams < c.MinUpstreams {
+		c.MaxUpstreams = c.MinUpstreams
+	}
+
+	if c.NumMeshGateways < 0 {
+		c.NumMeshGateways = 0
+	}
+
+	if c.NumTerminatingGateways < 0 {
+		c.NumTerminatingGateways = 0
+	}
+
+	if c.NumIngressGateways < 0 {
+		c.NumIngressGateways = 0
+	}
+
+	c.ServiceGraph.normalize()
+	c.Coordinates.normalize()
+
+	if c.MinChecksPerNode < 0 {
+		c.MinChecksPerNode = 0
+	}
+
+	if c.MaxChecksPerNode < c.MinChecksPerNode {
+		c.MaxChecksPerNode = c.MinChecksPerNode
+	}
+
+	if c.MinChecksPerInstance < 0 {
+		c.MinChecksPerInstance = 0
+	}
+
+	if c.MaxChecksPerInstance < c.MinChecksPerInstance {
+		c.MaxChecksPerInstance = c.MinChecksPerInstance
+	}
+
+	c.CheckStatusWeights.normalize()
 }
@@ -0,0 +1,56 @@
+package catalog
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestStream_UniqueNames(t *testing.T) {
+	same := func() (string, error) { return "same", nil }
+
+	cases := map[string]func(conf *Config){
+		"default generators": func(conf *Config) {},
+		// names are unique even when the generators keep producing the same one
+		"repeating generators": func(conf *Config) {
+			conf.NodeGen = same
+			conf.ServiceGen = same
+			conf.ServiceGraph.NumServices = 0
+		},
+	}
+
+	for name, modify := range cases {
+		t.Run(name, func(t *testing.T) {
+			conf := DefaultConfig(rand.New(rand.NewSource(1)))
+			conf.NumNodes = 50
+			conf.MinInstancesPerService = 1
+			conf.MaxInstancesPerService = 3
+			conf.NumMeshGateways = 60
+			modify(&conf)
+
+			nodes := make(map[string]struct{})
+			err := Stream(conf, func(node *Node) error {
+				if _, found := nodes[node.Name]; found {
+					t.Fatalf("node %s was generated more than once", node.Name)
+				}
+				nodes[node.Name] = struct{}{}
+
+				ids := make(map[string]struct{})
+				for _, service := range node.Services {
+					for _, instance := range service.Instances {
+						if _, found := ids[instance.ID]; found {
+							t.Fatalf("service ID %s was generated more than once on node %s", instance.ID, node.Name)
+						}
+						ids[instance.ID] = struct{}{}
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to generate catalog: %v", err)
+			}
+			if len(nodes) != conf.NumNodes {
+				t.Fatalf("expected %d nodes but got %d", conf.NumNodes, len(nodes))
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package catalog
+
+import (
+	"fmt"
+)
+
+const (
+	CheckStatusPassing  = "passing"
+	CheckStatusWarning  = "warning"
+	CheckStatusCritical = "critical"
+)
+
+// Check is the representation of a health check for either a node or a service instance
+type Check struct {
+	CheckID string
+	Name    string
+	Status  string
+	Notes   string `json:",omitempty"`
+	Output  string `json:",omitempty"`
+}
+
+// CheckStatusWeights determines how likely each status is for a generated check. A
+// status is chosen with a probability of its weight divided by the sum of all weights.
+type CheckStatusWeights struct {
+	Passing  int
+	Warning  int
+	Critical int
+}
+
+func (w *CheckStatusWeights) normalize() {
+	if w.Passing < 0 {
+		w.Passing = 0
+	}
+
+	if w.Warning < 0 {
+		w.Warning = 0
+	}
+
+	if w.Critical < 0 {
+		w.Critical = 0
+	}
+
+	if w.Passing+w.Warning+w.Critical == 0 {
+		*w = DefaultCheckStatusWeights
+	}
+}
+
+func (g *generatorState) genCheckStatus(weights CheckStatusWeights) string {
+	choice := g.rand.Intn(weights.Passing + weights.Warning + weights.Critical)
+	switch {
+	case choice < weights.Passing:
+		return CheckStatusPassing
+	case choice < weights.Passing+weights.Warning:
+		return CheckStatusWarning
+	default:
+		return CheckStatusCritical
+	}
+}
+
+func (g *generatorState) genCheck(id string, name string, conf Config) (*Check, error) {
+	notes, err := conf.CheckNotesGen()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate check notes: %w", err)
+	}
+
+	output, err := conf.CheckOutputGen()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate check output: %w", err)
+	}
+
+	return &Check{
+		CheckID: id,
+		Name:    name,
+		Status:  g.genCheckStatus(conf.CheckStatusWeights),
+		Notes:   notes,
+		Output:  output,
+	}, nil
+}
+
+// genNodeChecks generates the checks for a node. The check IDs are the check names
+// which are unique within the node.
+func (g *generatorState) genNodeChecks(conf Config) ([]*Check, error) {
+	numChecks := g.count(conf.MinChecksPerNode, conf.MaxChecksPerNode)
+	if numChecks == 0 {
+		return nil, nil
+	}
+
+	names := make(map[string]struct{})
+	checks := make([]*Check, 0, numChecks)
+	for i := 0; i < numChecks; i++ {
+		name, err := uniqueString(conf.CheckNameGen, func(val string) bool {
+			_, found := names[val]
+			return !found
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate check name: %w", err)
+		}
+		names[name] = struct{}{}
+
+		check, err := g.genCheck(name, name, conf)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// genInstanceChecks generates the checks for a service instance. The check IDs follow
+// the same convention the Consul agent uses for service checks.
+func (g *generatorState) genInstanceChecks(instanceID string, conf Config) ([]*Check, error) {
+	numChecks := g.count(conf.MinChecksPerInstance, conf.MaxChecksPerInstance)
+	if numChecks == 0 {
+		return nil, nil
+	}
+
+	checks := make([]*Check, 0, numChecks)
+	for i := 0; i < numChecks; i++ {
+		name, err := conf.CheckNameGen()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate check name: %w", err)
+		}
+
+		check, err := g.genCheck(fmt.Sprintf("service:%s:%d", instanceID, i+1), name, conf)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
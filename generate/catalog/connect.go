@@ -0,0 +1,158 @@
+package catalog
+
+import (
+	"fmt"
+)
+
+const (
+	ServiceKindConnectProxy       = "connect-proxy"
+	ServiceKindMeshGateway        = "mesh-gateway"
+	ServiceKindTerminatingGateway = "terminating-gateway"
+	ServiceKindIngressGateway     = "ingress-gateway"
+
+	// sidecarSuffix is appended to the name and ID of a service instance to get the
+	// name and ID of its sidecar proxy which is the same convention Consul uses.
+	sidecarSuffix = "-sidecar-proxy"
+
+	// upstreamBasePort is the port the first upstream of each proxy is bound to
+	upstreamBasePort = 10000
+)
+
+// Proxy is the Connect proxy configuration of a sidecar proxy service instance
+type Proxy struct {
+	DestinationServiceName string
+	DestinationServiceID   string
+	LocalServicePort       int
+	Upstreams              []*Upstream `json:",omitempty"`
+}
+
+// Upstream is a service that a sidecar proxy provides access to
+type Upstream struct {
+	DestinationName string
+	LocalBindPort   int
+}
+
+// genSidecars generates a sidecar proxy service for the service containing one proxy
+// for a fraction of its instances. Nil is returned when no proxies were generated.
+func (g *generatorState) genSidecars(service *Service, conf Config) *Service {
+	if conf.SidecarFraction <= 0 {
+		return nil
+	}
+
+	var proxies []*ServiceInstance
+	for _, instance := range service.Instances {
+		if g.rand.Float64() >= conf.SidecarFraction {
+			continue
+		}
+
+		proxies = append(proxies, &ServiceInstance{
+			Name:      service.Name + sidecarSuffix,
+			Address:   instance.Address,
+			ID:        instance.ID + sidecarSuffix,
+			Port:      g.rand.Intn(65535),
+			Kind:      ServiceKindConnectProxy,
+			Namespace: instance.Namespace,
+			Proxy: &Proxy{
+				DestinationServiceName: service.Name,
+				DestinationServiceID:   instance.ID,
+				LocalServicePort:       instance.Port,
+				Upstreams:              g.genUpstreams(service.Name, conf),
+			},
+		})
+	}
+
+	if len(proxies) == 0 {
+		return nil
+	}
+
+	return &Service{
+		Name:      service.Name + sidecarSuffix,
+		Instances: proxies,
+	}
+}
+
+// genUpstreams picks the upstreams of a proxy from the services generated so far
+// unless there is a service graph in which case the upstreams are the service's
+// upstreams within the graph.
+func (g *generatorState) genUpstreams(serviceName string, conf Config) []*Upstream {
+	if svc, found := g.graph[serviceName]; found {
+		var upstreams []*Upstream
+		for i, name := range svc.Upstreams {
+			upstreams = append(upstreams, &Upstream{
+				DestinationName: name,
+				LocalBindPort:   upstreamBasePort + i,
+			})
+		}
+		return upstreams
+	}
+
+	numUpstreams := g.count(conf.MinUpstreams, conf.MaxUpstreams)
+
+	picked := make(map[string]struct{})
+	var upstreams []*Upstream
+	// Attempts are bounded as there may not be enough other services to pick from.
+	for attempt := 0; len(upstreams) < numUpstreams && attempt < numUpstreams*4; attempt++ {
+		if len(g.serviceNames) == 0 {
+			break
+		}
+
+		name := g.serviceNames[g.rand.Intn(len(g.serviceNames))]
+		if _, found := picked[name]; found || name == serviceName {
+			continue
+		}
+		picked[name] = struct{}{}
+
+		upstreams = append(upstreams, &Upstream{
+			DestinationName: name,
+			LocalBindPort:   upstreamBasePort + len(upstreams),
+		})
+	}
+	return upstreams
+}
+
+// genGateways generates the gateway services for the node. Gateways are spread over
+// the nodes in the order they are generated so that each gets registered to a different
+// node when there are more nodes than gateways.
+func (g *generatorState) genGateways(nodeName string, conf Config) ([]*Service, error) {
+	gateways := []struct {
+		kind  string
+		count int
+	}{
+		{ServiceKindMeshGateway, conf.NumMeshGateways},
+		{ServiceKindTerminatingGateway, conf.NumTerminatingGateways},
+		{ServiceKindIngressGateway, conf.NumIngressGateways},
+	}
+
+	var services []*Service
+	offset := 0
+	for _, gateway := range gateways {
+		var instances []*ServiceInstance
+		for i := offset; i < offset+gateway.count; i++ {
+			if i%conf.NumNodes != g.nodeIndex {
+				continue
+			}
+
+			addr, err := conf.AddressGen()
+			if err != nil {
+				return nil, fmt.Errorf("Failed to generate gateway address: %w", err)
+			}
+
+			instances = append(instances, &ServiceInstance{
+				Name:    gateway.kind,
+				Address: addr.String(),
+				ID:      g.svcID(gateway.kind),
+				Port:    g.rand.Intn(65535),
+				Kind:    gateway.kind,
+			})
+		}
+		offset += gateway.count
+
+		if len(instances) > 0 {
+			services = append(services, &Service{
+				Name:      gateway.kind,
+				Instances: instances,
+			})
+		}
+	}
+	return services, nil
+}
@@ -0,0 +1,164 @@
+package catalog
+
+import (
+	"math"
+	"math/rand"
+)
+
+const (
+	// CoordinateDimensions is the dimensionality of the Vivaldi coordinates used by
+	// Serf which Consul rejects any others for
+	CoordinateDimensions = 8
+
+	// coordinateHeightMin is the smallest height Serf allows
+	coordinateHeightMin = 10.0e-6
+)
+
+var (
+	DefaultCoordinateRacksPerZone       = 4
+	DefaultCoordinateInterZoneLatencyMs = 20.0
+	DefaultCoordinateInterRackLatencyMs = 2.0
+	DefaultCoordinateRackLatencyMs      = 0.5
+)
+
+// Coordinate is the Serf network coordinate of a node along with the zone and rack it
+// was placed in. The vector, height and adjustment are in seconds.
+type Coordinate struct {
+	Zone       int
+	Rack       int
+	Vec        []float64
+	Error      float64
+	Adjustment float64
+	Height     float64
+}
+
+// CoordinateConfig configures generation of node network coordinates. Nodes within
+// each datacenter are clustered around racks which are in turn clustered within zones
+// so that the estimated round trip times between nodes roughly match the configured
+// latencies. When NumZones is zero no coordinates are generated.
+type CoordinateConfig struct {
+	NumZones     int
+	RacksPerZone int
+	// InterZoneLatencyMs is the round trip time between nodes in different zones,
+	// InterRackLatencyMs between nodes in different racks of the same zone and
+	// RackLatencyMs between nodes within the same rack
+	InterZoneLatencyMs float64
+	InterRackLatencyMs float64
+	RackLatencyMs      float64
+}
+
+func DefaultCoordinateConfig() CoordinateConfig {
+	return CoordinateConfig{
+		RacksPerZone:       DefaultCoordinateRacksPerZone,
+		InterZoneLatencyMs: DefaultCoordinateInterZoneLatencyMs,
+		InterRackLatencyMs: DefaultCoordinateInterRackLatencyMs,
+		RackLatencyMs:      DefaultCoordinateRackLatencyMs,
+	}
+}
+
+func (c *CoordinateConfig) normalize() {
+	if c.NumZones <= 0 {
+		c.NumZones = 0
+		return
+	}
+
+	if c.RacksPerZone <= 0 {
+		c.RacksPerZone = DefaultCoordinateRacksPerZone
+	}
+
+	if c.InterZoneLatencyMs <= 0 {
+		c.InterZoneLatencyMs = DefaultCoordinateInterZoneLatencyMs
+	}
+
+	if c.InterRackLatencyMs <= 0 {
+		c.InterRackLatencyMs = DefaultCoordinateInterRackLatencyMs
+	}
+
+	if c.RackLatencyMs <= 0 {
+		c.RackLatencyMs = DefaultCoordinateRackLatencyMs
+	}
+}
+
+// coordinateZone is a zone of a datacenter along with the positions of its racks
+type coordinateZone struct {
+	center []float64
+	racks  [][]float64
+}
+
+// coordinateState places nodes in the latency space. Each datacenter gets its own
+// zones as coordinates are only comparable within a datacenter.
+type coordinateState struct {
+	rand  *rand.Rand
+	zones map[string][]*coordinateZone
+}
+
+// randomVector returns a vector in a random direction with the given length
+func (s *coordinateState) randomVector(length float64) []float64 {
+	vec := make([]float64, CoordinateDimensions)
+	sum := 0.0
+	for i := range vec {
+		vec[i] = s.rand.NormFloat64()
+		sum += vec[i] * vec[i]
+	}
+
+	scale := length / math.Sqrt(sum)
+	for i := range vec {
+		vec[i] *= scale
+	}
+	return vec
+}
+
+// jitter returns the value randomly scaled by up to 20% either way
+func (s *coordinateState) jitter(value float64) float64 {
+	return value * (0.8 + 0.4*s.rand.Float64())
+}
+
+// The distance between two vectors of the same length in random directions is about
+// their length times the square root of two within these many dimensions so positions
+// are offset by the desired latency scaled down by that.
+func latencyOffset(ms float64) float64 {
+	return ms / 1000 / math.Sqrt2
+}
+
+func (s *coordinateState) datacenterZones(conf CoordinateConfig, datacenter string) []*coordinateZone {
+	if zones, ok := s.zones[datacenter]; ok {
+		return zones
+	}
+
+	zones := make([]*coordinateZone, 0, conf.NumZones)
+	for i := 0; i < conf.NumZones; i++ {
+		zone := coordinateZone{center: s.randomVector(latencyOffset(conf.InterZoneLatencyMs))}
+		for j := 0; j < conf.RacksPerZone; j++ {
+			offset := s.randomVector(latencyOffset(conf.InterRackLatencyMs))
+			for k := range offset {
+				offset[k] += zone.center[k]
+			}
+			zone.racks = append(zone.racks, offset)
+		}
+		zones = append(zones, &zone)
+	}
+	s.zones[datacenter] = zones
+	return zones
+}
+
+// genCoordinate places a node in a random rack of the datacenter. Half the latency
+// within a rack comes from the distance between nodes and the rest from their heights,
+// which model the latency of a node's own link.
+func (s *coordinateState) genCoordinate(conf CoordinateConfig, datacenter string) *Coordinate {
+	zones := s.datacenterZones(conf, datacenter)
+	zone := s.rand.Intn(len(zones))
+	rack := s.rand.Intn(len(zones[zone].racks))
+
+	vec := s.randomVector(s.jitter(latencyOffset(conf.RackLatencyMs / 2)))
+	for i := range vec {
+		vec[i] += zones[zone].racks[rack][i]
+	}
+
+	return &Coordinate{
+		Zone:   zone + 1,
+		Rack:   rack + 1,
+		Vec:    vec,
+		Error:  0.05 + 0.2*s.rand.Float64(),
+		Height: math.Max(s.jitter(conf.RackLatencyMs/1000/4), coordinateHeightMin),
+	}
+}
@@ -0,0 +1,145 @@
+package catalog
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// rttMs is the round trip time estimated from two coordinates in the way Serf does
+func rttMs(a *Coordinate, b *Coordinate) float64 {
+	sum := 0.0
+	for i := range a.Vec {
+		diff := a.Vec[i] - b.Vec[i]
+		sum += diff * diff
+	}
+	return (math.Sqrt(sum) + a.Height + b.Height + a.Adjustment + b.Adjustment) * 1000
+}
+
+func TestGenCoordinate(t *testing.T) {
+	cases := map[string]struct {
+		conf CoordinateConfig
+	}{
+		"defaults": {
+			conf: CoordinateConfig{NumZones: 3},
+		},
+		"single zone and rack": {
+			conf: CoordinateConfig{NumZones: 1, RacksPerZone: 1},
+		},
+		"custom latencies": {
+			conf: CoordinateConfig{NumZones: 4, RacksPerZone: 2, InterZoneLatencyMs: 100, InterRackLatencyMs: 10, RackLatencyMs: 1},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			conf := tc.conf
+			conf.normalize()
+			s := coordinateState{
+				rand:  rand.New(rand.NewSource(1)),
+				zones: make(map[string][]*coordinateZone),
+			}
+
+			var coords []*Coordinate
+			for i := 0; i < 200; i++ {
+				coord := s.genCoordinate(conf, "dc1")
+				if len(coord.Vec) != CoordinateDimensions {
+					t.Fatalf("expected %d dimensions but got %d", CoordinateDimensions, len(coord.Vec))
+				}
+				if coord.Zone < 1 || coord.Zone > conf.NumZones || coord.Rack < 1 || coord.Rack > conf.RacksPerZone {
+					t.Fatalf("node placed in zone %d rack %d", coord.Zone, coord.Rack)
+				}
+				if coord.Height < coordinateHeightMin || coord.Error <= 0 || coord.Error > 1.5 {
+					t.Fatalf("invalid height %v or error %v", coord.Height, coord.Error)
+				}
+				coords = append(coords, coord)
+			}
+
+			// every pair of nodes should be roughly the configured latency apart
+			expected := []float64{conf.RackLatencyMs, conf.InterRackLatencyMs, conf.InterZoneLatencyMs}
+			sums := make([]float64, len(expected))
+			counts := make([]int, len(expected))
+			for i, a := range coords {
+				for _, b := range coords[i+1:] {
+					level := 0
+					if a.Zone != b.Zone {
+						level = 2
+					} else if a.Rack != b.Rack {
+						level = 1
+					}
+					sums[level] += rttMs(a, b)
+					counts[level]++
+				}
+			}
+
+			for level, latency := range expected {
+				if counts[level] == 0 {
+					continue
+				}
+				if avg := sums[level] / float64(counts[level]); avg < latency/2 || avg > latency*2 {
+					t.Fatalf("expected a round trip time of about %vms between nodes at level %d but got %vms", latency, level, avg)
+				}
+			}
+		})
+	}
+}
+
+func TestGenCoordinate_Datacenters(t *testing.T) {
+	conf := CoordinateConfig{NumZones: 2}
+	conf.normalize()
+	s := coordinateState{
+		rand:  rand.New(rand.NewSource(1)),
+		zones: make(map[string][]*coordinateZone),
+	}
+
+	s.genCoordinate(conf, "dc1")
+	s.genCoordinate(conf, "dc2")
+	zones := s.zones["dc1"]
+	s.genCoordinate(conf, "dc1")
+
+	if len(s.zones) != 2 || len(s.zones["dc2"]) != conf.NumZones {
+		t.Fatalf("expected zones to be generated for each datacenter")
+	}
+	if s.zones["dc1"][0] != zones[0] {
+		t.Fatalf("expected the zones of a datacenter to be reused")
+	}
+	if s.zones["dc1"][0] == s.zones["dc2"][0] {
+		t.Fatalf("expected each datacenter to have its own zones")
+	}
+}
+
+func TestCoordinateConfig_Normalize(t *testing.T) {
+	cases := map[string]struct {
+		conf     CoordinateConfig
+		expected CoordinateConfig
+	}{
+		"disabled": {
+			conf:     CoordinateConfig{NumZones: -1, RacksPerZone: 3},
+			expected: CoordinateConfig{RacksPerZone: 3},
+		},
+		"defaults": {
+			conf: CoordinateConfig{NumZones: 2},
+			expected: CoordinateConfig{
+				NumZones:           2,
+				RacksPerZone:       DefaultCoordinateRacksPerZone,
+				InterZoneLatencyMs: DefaultCoordinateInterZoneLatencyMs,
+				InterRackLatencyMs: DefaultCoordinateInterRackLatencyMs,
+				RackLatencyMs:      DefaultCoordinateRackLatencyMs,
+			},
+		},
+		"set": {
+			conf:     CoordinateConfig{NumZones: 2, RacksPerZone: 1, InterZoneLatencyMs: 3, InterRackLatencyMs: 2, RackLatencyMs: 1},
+			expected: CoordinateConfig{NumZones: 2, RacksPerZone: 1, InterZoneLatencyMs: 3, InterRackLatencyMs: 2, RackLatencyMs: 1},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			conf := tc.conf
+			conf.normalize()
+			if conf != tc.expected {
+				t.Fatalf("expected %+v but got %+v", tc.expected, conf)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package catalog
+
+import (
+	"fmt"
+	"sort"
+)
+
+var (
+	DefaultGraphDepth          = 4
+	DefaultGraphMinFanOut      = 1
+	DefaultGraphMaxFanOut      = 3
+	DefaultGraphNumHubs        = 3
+	DefaultGraphHubProbability = 0.3
+)
+
+// GraphService is a single service within the service dependency graph
+type GraphService struct {
+	Name string
+	// Layer is how far the service is from the top of the graph. Services only
+	// ever depend on services within deeper layers which keeps the graph acyclic.
+	Layer     int
+	Upstreams []string `json:",omitempty"`
+}
+
+// ServiceGraph is a directed acyclic graph of services and the upstream services
+// they depend on.
+type ServiceGraph []*GraphService
+
+// GraphConfig configures generation of the service dependency graph. When NumServices
+// is zero no graph is generated and every generated service gets a new random name.
+type GraphConfig struct {
+	NumServices int
+	// Depth is the number of layers in the graph
+	Depth     int
+	MinFanOut int
+	MaxFanOut int
+	// NumHubs is the number of services in the deepest layer, such as databases or
+	// auth services, which are much more likely to be depended upon than others.
+	// A negative value disables hubs.
+	NumHubs int
+	// HubProbability is the probability that any given upstream will be a hub
+	HubProbability float64
+}
+
+func (c *GraphConfig) normalize() {
+	if c.NumServices <= 0 {
+		c.NumServices = 0
+		return
+	}
+
+	if c.Depth < 1 {
+		c.Depth = DefaultGraphDepth
+	}
+
+	if c.MinFanOut < 0 {
+		c.MinFanOut = 0
+	}
+
+	if c.MaxFanOut <= 0 {
+		c.MaxFanOut = DefaultGraphMaxFanOut
+	}
+
+	if c.MaxFanOut < c.MinFanOut {
+		c.MaxFanOut = c.MinFanOut
+	}
+
+	if c.NumHubs == 0 {
+		c.NumHubs = DefaultGraphNumHubs
+	}
+
+	if c.NumHubs < 0 {
+		c.NumHubs = 0
+	}
+
+	if c.NumHubs > c.NumServices {
+		c.NumHubs = c.NumServices
+	}
+
+	if c.HubProbability <= 0 {
+		c.HubProbability = DefaultGraphHubProbability
+	}
+
+	if c.HubProbability > 1 {
+		c.HubProbability = 1
+	}
+}
+
+func DefaultGraphConfig() GraphConfig {
+	return GraphConfig{
+		Depth:          DefaultGraphDepth,
+		MinFanOut:      DefaultGraphMinFanOut,
+		MaxFanOut:      DefaultGraphMaxFanOut,
+		NumHubs:        DefaultGraphNumHubs,
+		HubProbability: DefaultGraphHubProbability,
+	}
+}
+
+// GenerateGraph generates the service dependency graph described by the config's
+// ServiceGraph settings. Nil is returned when the graph is disabled.
+func GenerateGraph(conf Config) (ServiceGraph, error) {
+	conf.normalize()
+
+	gc := conf.ServiceGraph
+	if gc.NumServices == 0 {
+		return nil, nil
+	}
+
+	g := generatorState{rand: conf.Rand}
+
+	names := make(map[string]struct{})
+	graph := make(ServiceGraph, 0, gc.NumServices)
+	for i := 0; i < gc.NumServices; i++ {
+		name, err := uniqueString(conf.ServiceGen, func(val string) bool {
+			_, found := names[val]
+			return !found
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate service name: %w", err)
+		}
+		names[name] = struct{}{}
+
+		// the hubs are the first services and always in the deepest layer
+		layer := gc.Depth - 1
+		if i >= gc.NumHubs {
+			layer = g.rand.Intn(gc.Depth)
+		}
+
+		graph = append(graph, &GraphService{Name: name, Layer: layer})
+	}
+
+	// ordering by layer allows the candidate upstreams of a service to be the
+	// contiguous set of services following the last one within its layer
+	byLayer := make(ServiceGraph, len(graph))
+	copy(byLayer, graph)
+	sort.SliceStable(byLayer, func(i, j int) bool {
+		return byLayer[i].Layer < byLayer[j].Layer
+	})
+
+	for _, svc := range graph {
+		deeper := byLayer[sort.Search(len(byLayer), func(i int) bool {
+			return byLayer[i].Layer > svc.Layer
+		}):]
+		if len(deeper) == 0 {
+			continue
+		}
+
+		numUpstreams := g.count(gc.MinFanOut, gc.MaxFanOut)
+		picked := make(map[string]struct{})
+		// Attempts are bounded as there may not be enough deeper services to pick from.
+		for attempt := 0; len(svc.Upstreams) < numUpstreams && attempt < numUpstreams*4; attempt++ {
+			var upstream *GraphService
+			if gc.NumHubs > 0 && g.rand.Float64() < gc.HubProbability {
+				upstream = graph[g.rand.Intn(gc.NumHubs)]
+			} else {
+				upstream = deeper[g.rand.Intn(len(deeper))]
+			}
+
+			if _, found := picked[upstream.Name]; found || upstream.Layer <= svc.Layer {
+				continue
+			}
+			picked[upstream.Name] = struct{}{}
+			svc.Upstreams = append(svc.Upstreams, upstream.Name)
+		}
+	}
+
+	return graph, nil
+}
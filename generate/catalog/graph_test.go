@@ -0,0 +1,61 @@
+package catalog
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestGenerateGraph(t *testing.T) {
+	cases := map[string]GraphConfig{
+		"disabled":    {},
+		"default":     {NumServices: 50},
+		"single":      {NumServices: 1},
+		"one layer":   {NumServices: 20, Depth: 1},
+		"deep":        {NumServices: 100, Depth: 10, MinFanOut: 2, MaxFanOut: 5},
+		"no hubs":     {NumServices: 30, NumHubs: -1},
+		"all hubs":    {NumServices: 5, NumHubs: 10, HubProbability: 1},
+		"no fan out":  {NumServices: 10, MinFanOut: 0, MaxFanOut: 0},
+		"big fan out": {NumServices: 10, Depth: 2, MinFanOut: 20, MaxFanOut: 30},
+	}
+
+	for name, gc := range cases {
+		t.Run(name, func(t *testing.T) {
+			conf := DefaultConfig(rand.New(rand.NewSource(1)))
+			conf.ServiceGraph = gc
+
+			graph, err := GenerateGraph(conf)
+			if err != nil {
+				t.Fatalf("Failed to generate graph: %v", err)
+			}
+			if len(graph) != gc.NumServices {
+				t.Fatalf("expected %d services but got %d", gc.NumServices, len(graph))
+			}
+
+			services := make(map[string]*GraphService, len(graph))
+			for _, svc := range graph {
+				if _, found := services[svc.Name]; found {
+					t.Fatalf("service %s is in the graph more than once", svc.Name)
+				}
+				services[svc.Name] = svc
+			}
+
+			// upstreams are always in deeper layers which keeps the graph acyclic
+			for _, svc := range graph {
+				upstreams := make(map[string]struct{})
+				for _, name := range svc.Upstreams {
+					upstream, found := services[name]
+					if !found {
+						t.Fatalf("service %s has upstream %s which isn't in the graph", svc.Name, name)
+					}
+					if upstream.Layer <= svc.Layer {
+						t.Fatalf("service %s in layer %d has upstream %s in layer %d", svc.Name, svc.Layer, name, upstream.Layer)
+					}
+					if _, found := upstreams[name]; found {
+						t.Fatalf("service %s has upstream %s more than once", svc.Name, name)
+					}
+					upstreams[name] = struct{}{}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package catalog
+
+import (
+	"fmt"
+)
+
+// genTagVocabulary generates the unique set of tags that instance tags are drawn from.
+func (g *generatorState) genTagVocabulary(conf Config) error {
+	if conf.MaxTagsPerInstance == 0 {
+		return nil
+	}
+
+	unique := make(map[string]struct{})
+	g.tags = make([]string, 0, conf.TagVocabularySize)
+	for i := 0; i < conf.TagVocabularySize; i++ {
+		tag, err := uniqueString(conf.TagGen, func(val string) bool {
+			_, found := unique[val]
+			return !found
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to generate tag: %w", err)
+		}
+
+		unique[tag] = struct{}{}
+		g.tags = append(g.tags, tag)
+	}
+	return nil
+}
+
+// genTags picks the tags for a service instance from the vocabulary.
+func (g *generatorState) genTags(conf Config) []string {
+	numTags := g.count(conf.MinTagsPerInstance, conf.MaxTagsPerInstance)
+	if numTags > len(g.tags) {
+		numTags = len(g.tags)
+	}
+	if numTags == 0 {
+		return nil
+	}
+
+	tags := make([]string, 0, numTags)
+	for _, i := range g.rand.Perm(len(g.tags))[:numTags] {
+		tags = append(tags, g.tags[i])
+	}
+	return tags
+}
@@ -2,6 +2,7 @@ package catalog
 
 import (
 	"fmt"
+	"math/rand"
 
 	"github.com/mkeeler/consul-data/generate/generators"
 )
@@ -46,6 +47,41 @@ const (
 	DefaultAddressType = AddressTypeRandomTesting
 )
 
+type TagType string
+
+const (
+	TagTypePetName   TagType = "pet-name"
+	TagTypeRandomB64 TagType = "random-b64"
+
+	DefaultTagType = TagTypePetName
+)
+
+type CheckNameType string
+
+const (
+	CheckNameTypePetName CheckNameType = "pet-name"
+
+	DefaultCheckNameType = CheckNameTypePetName
+)
+
+type CheckNotesType string
+
+const (
+	CheckNotesTypeNone    CheckNotesType = "none"
+	CheckNotesTypePetName CheckNotesType = "pet-name"
+
+	DefaultCheckNotesType = CheckNotesTypeNone
+)
+
+type CheckOutputType string
+
+const (
+	CheckOutputTypeNone      CheckOutputType = "none"
+	CheckOutputTypeRandomB64 CheckOutputType = "random-b64"
+
+	DefaultCheckOutputType = CheckOutputTypeRandomB64
+)
+
 type UserConfig struct {
 	NumNodes               int
 	MinServicesPerNode     int
@@ -57,19 +93,59 @@ type UserConfig struct {
 	MinMetaPerService      int
 	MaxMetaPerService      int
 
+	// Unlike the other counts, zero tags and checks are valid and will not be
+	// replaced with the default.
+	MinTagsPerInstance int
+	MaxTagsPerInstance int
+	TagVocabularySize  int
+
+	// SidecarFraction is the fraction of service instances, between 0 and 1, which
+	// get a Connect sidecar proxy with upstreams picked from the other services.
+	SidecarFraction        float64
+	MinUpstreams           int
+	MaxUpstreams           int
+	NumMeshGateways        int
+	NumTerminatingGateways int
+	NumIngressGateways     int
+
+	// ServiceGraph configures the service dependency graph which service names and
+	// sidecar proxy upstreams are taken from. It is disabled when NumServices is zero.
+	ServiceGraph GraphConfig
+
+	// Coordinates configures the network coordinates of nodes. It is disabled when
+	// NumZones is zero.
+	Coordinates CoordinateConfig
+
+	MinChecksPerNode     int
+	MaxChecksPerNode     int
+	MinChecksPerInstance int
+	MaxChecksPerInstance int
+	CheckStatusWeights   CheckStatusWeights
+
 	NodeType      NodeType
 	ServiceType   ServiceType
 	AddressType   AddressType
 	MetaKeyType   MetaKeyType
 	MetaValueType MetaValueType
 
+	TagType         TagType
+	CheckNameType   CheckNameType
+	CheckNotesType  CheckNotesType
+	CheckOutputType CheckOutputType
+
 	NodePetNames       PetNameUserConfig
 	ServicePetNames    PetNameUserConfig
 	MetaKeyPetNames    PetNameUserConfig
 	MetaValueRandomB64 RandomB64UserConfig
+
+	TagPetNames          PetNameUserConfig
+	TagRandomB64         RandomB64UserConfig
+	CheckNamePetNames    PetNameUserConfig
+	CheckNotesPetNames   PetNameUserConfig
+	CheckOutputRandomB64 RandomB64UserConfig
 }
 
-func (c *UserConfig) ToGeneratorConfig() (Config, error) {
+func (c *UserConfig) ToGeneratorConfig(rng *rand.Rand) (Config, error) {
 	c.Normalize()
 
 	conf := Config{
@@ -82,43 +158,94 @@ func (c *UserConfig) ToGeneratorConfig() (Config, error) {
 		MaxMetaPerNode:         c.MaxMetaPerNode,
 		MinMetaPerService:      c.MinMetaPerService,
 		MaxMetaPerService:      c.MaxMetaPerService,
+		MinTagsPerInstance:     c.MinTagsPerInstance,
+		MaxTagsPerInstance:     c.MaxTagsPerInstance,
+		TagVocabularySize:      c.TagVocabularySize,
+		SidecarFraction:        c.SidecarFraction,
+		MinUpstreams:           c.MinUpstreams,
+		MaxUpstreams:           c.MaxUpstreams,
+		NumMeshGateways:        c.NumMeshGateways,
+		NumTerminatingGateways: c.NumTerminatingGateways,
+		NumIngressGateways:     c.NumIngressGateways,
+		ServiceGraph:           c.ServiceGraph,
+		Coordinates:            c.Coordinates,
+		MinChecksPerNode:       c.MinChecksPerNode,
+		MaxChecksPerNode:       c.MaxChecksPerNode,
+		MinChecksPerInstance:   c.MinChecksPerInstance,
+		MaxChecksPerInstance:   c.MaxChecksPerInstance,
+		CheckStatusWeights:     c.CheckStatusWeights,
+		Rand:                   rng,
 	}
 
 	switch c.NodeType {
 	case NodeTypePetName:
-		conf.NodeGen = c.NodePetNames.Generator()
+		conf.NodeGen = c.NodePetNames.Generator(rng)
 	default:
 		return Config{}, fmt.Errorf("Invalid node type: %s", c.NodeType)
 	}
 
 	switch c.ServiceType {
 	case ServiceTypePetName:
-		conf.ServiceGen = c.ServicePetNames.Generator()
+		conf.ServiceGen = c.ServicePetNames.Generator(rng)
 	default:
 		return Config{}, fmt.Errorf("Invalid service type: %s", c.ServiceType)
 	}
 
 	switch c.MetaKeyType {
 	case MetaKeyTypePetName:
-		conf.MetaKeyGen = c.MetaKeyPetNames.Generator()
+		conf.MetaKeyGen = c.MetaKeyPetNames.Generator(rng)
 	default:
 		return Config{}, fmt.Errorf("Invalid meta key type: %s", c.MetaKeyType)
 	}
 
 	switch c.MetaValueType {
 	case MetaValueTypeRandomB64:
-		conf.MetaValueGen = c.MetaValueRandomB64.Generator()
+		conf.MetaValueGen = c.MetaValueRandomB64.Generator(rng)
 	default:
 		return Config{}, fmt.Errorf("Invalid meta value type: %s", c.MetaValueType)
 	}
 
 	switch c.AddressType {
 	case AddressTypeRandomTesting:
-		conf.AddressGen = generators.RandomTestingIPGenerator()
+		conf.AddressGen = generators.RandomTestingIPGenerator(rng)
 	default:
 		return Config{}, fmt.Errorf("Invalid address type: %s", c.MetaValueType)
 	}
 
+	switch c.TagType {
+	case TagTypePetName:
+		conf.TagGen = c.TagPetNames.Generator(rng)
+	case TagTypeRandomB64:
+		conf.TagGen = c.TagRandomB64.Generator(rng)
+	default:
+		return Config{}, fmt.Errorf("Invalid tag type: %s", c.TagType)
+	}
+
+	switch c.CheckNameType {
+	case CheckNameTypePetName:
+		conf.CheckNameGen = c.CheckNamePetNames.Generator(rng)
+	default:
+		return Config{}, fmt.Errorf("Invalid check name type: %s", c.CheckNameType)
+	}
+
+	switch c.CheckNotesType {
+	case CheckNotesTypeNone:
+		conf.CheckNotesGen = generators.EmptyGenerator()
+	case CheckNotesTypePetName:
+		conf.CheckNotesGen = c.CheckNotesPetNames.Generator(rng)
+	default:
+		return Config{}, fmt.Errorf("Invalid check notes type: %s", c.CheckNotesType)
+	}
+
+	switch c.CheckOutputType {
+	case CheckOutputTypeNone:
+		conf.CheckOutputGen = generators.EmptyGenerator()
+	case CheckOutputTypeRandomB64:
+		conf.CheckOutputGen = c.CheckOutputRandomB64.Generator(rng)
+	default:
+		return Config{}, fmt.Errorf("Invalid check output type: %s", c.CheckOutputType)
+	}
+
 	return conf, nil
 }
 
@@ -139,6 +266,18 @@ func (c *UserConfig) Normalize() {
 		c.MaxServicesPerNode = c.MinServicesPerNode
 	}
 
+	if c.MinInstancesPerService <= 0 {
+		c.MinInstancesPerService = DefaultMinInstancesPerService
+	}
+
+	if c.MaxInstancesPerService <= 0 {
+		c.MaxInstancesPerService = DefaultMaxInstancesPerService
+	}
+
+	if c.MaxInstancesPerService < c.MinInstancesPerService {
+		c.MaxInstancesPerService = c.MinInstancesPerService
+	}
+
 	if c.MinMetaPerNode <= 0 {
 		c.MinMetaPerNode = DefaultMinMetaPerNode
 	}
@@ -163,6 +302,67 @@ func (c *UserConfig) Normalize() {
 		c.MaxMetaPerService = c.MinMetaPerService
 	}
 
+	if c.MinTagsPerInstance < 0 {
+		c.MinTagsPerInstance = 0
+	}
+
+	if c.MaxTagsPerInstance < c.MinTagsPerInstance {
+		c.MaxTagsPerInstance = c.MinTagsPerInstance
+	}
+
+	if c.TagVocabularySize <= 0 {
+		c.TagVocabularySize = DefaultTagVocabularySize
+	}
+
+	if c.SidecarFraction < 0 {
+		c.SidecarFraction = 0
+	}
+
+	if c.SidecarFraction > 1 {
+		c.SidecarFraction = 1
+	}
+
+	if c.MinUpstreams < 0 {
+		c.MinUpstreams = 0
+	}
+
+	if c.MaxUpstreams < c.MinUpstreams {
+		c.MaxUpstreams = c.MinUpstreams
+	}
+
+	if c.NumMeshGateways < 0 {
+		c.NumMeshGateways = 0
+	}
+
+	if c.NumTerminatingGateways < 0 {
+		c.NumTerminatingGateways = 0
+	}
+
+	if c.NumIngressGateways < 0 {
+		c.NumIngressGateways = 0
+	}
+
+	c.ServiceGraph.normalize()
+	c.Coordinates.normalize()
+
+	if c.MinChecksPerNode < 0 {
+		c.MinChecksPerNode = 0
+	}
+
+	if c.MaxChecksPerNode < c.MinChecksPerNode {
+		c.MaxChecksPerNode = c.MinChecksPerNode
+	}
+
+	if c.MinChecksPerInstance < 0 {
+		c.MinChecksPerInstance = 0
+	}
+
+	if c.MaxChecksPerInstance < c.MinChecksPerInstance {
+		c.MaxChecksPerInstance = c.MinChecksPerInstance
+	}
+
+	c.CheckStatusWeights.normalize()
+
 	if c.NodeType == "" {
 		c.NodeType = NodeTypePetName
 	}
@@ -183,30 +383,75 @@ func (c *UserConfig) Normalize() {
 		c.AddressType = AddressTypeRandomTesting
 	}
 
+	if c.TagType == "" {
+		c.TagType = DefaultTagType
+	}
+
+	if c.CheckNameType == "" {
+		c.CheckNameType = DefaultCheckNameType
+	}
+
+	if c.CheckNotesType == "" {
+		c.CheckNotesType = DefaultCheckNotesType
+	}
+
+	if c.CheckOutputType == "" {
+		c.CheckOutputType = DefaultCheckOutputType
+	}
+
 	c.NodePetNames.Normalize()
 	c.ServicePetNames.Normalize()
 	c.MetaKeyPetNames.Normalize()
 	c.MetaValueRandomB64.Normalize()
+	c.TagPetNames.Normalize()
+	c.TagRandomB64.Normalize()
+	c.CheckNamePetNames.Normalize()
+	c.CheckNotesPetNames.Normalize()
+	c.CheckOutputRandomB64.Normalize()
 }
 
 func DefaultUserConfig() UserConfig {
 	return UserConfig{
-		NumNodes:           DefaultNumNodes,
-		MinServicesPerNode: DefaultMinServicesPerNode,
-		MaxServicesPerNode: DefaultMaxServicesPerNode,
-		MinMetaPerNode:     DefaultMinMetaPerNode,
-		MaxMetaPerNode:     DefaultMaxMetaPerNode,
-		MinMetaPerService:  DefaultMinMetaPerService,
-		MaxMetaPerService:  DefaultMaxMetaPerService,
-		NodeType:           DefaultNodeType,
-		ServiceType:        DefaultServiceType,
-		AddressType:        DefaultAddressType,
-		MetaKeyType:        DefaultMetaKeyType,
-		MetaValueType:      DefaultMetaValueType,
-		NodePetNames:       DefaultPetNameUserConfig(),
-		ServicePetNames:    DefaultPetNameUserConfig(),
-		MetaKeyPetNames:    DefaultPetNameUserConfig(),
-		MetaValueRandomB64: DefaultRandomB64UserConfig(),
+		NumNodes:               DefaultNumNodes,
+		MinServicesPerNode:     DefaultMinServicesPerNode,
+		MaxServicesPerNode:     DefaultMaxServicesPerNode,
+		MinInstancesPerService: DefaultMinInstancesPerService,
+		MaxInstancesPerService: DefaultMaxInstancesPerService,
+		MinMetaPerNode:         DefaultMinMetaPerNode,
+		MaxMetaPerNode:         DefaultMaxMetaPerNode,
+		MinMetaPerService:      DefaultMinMetaPerService,
+		MaxMetaPerService:      DefaultMaxMetaPerService,
+		MinTagsPerInstance:     DefaultMinTagsPerInstance,
+		MaxTagsPerInstance:     DefaultMaxTagsPerInstance,
+		TagVocabularySize:      DefaultTagVocabularySize,
+		SidecarFraction:        DefaultSidecarFraction,
+		MinUpstreams:           DefaultMinUpstreams,
+		MaxUpstreams:           DefaultMaxUpstreams,
+		ServiceGraph:           DefaultGraphConfig(),
+		Coordinates:            DefaultCoordinateConfig(),
+		MinChecksPerNode:       DefaultMinChecksPerNode,
+		MaxChecksPerNode:       DefaultMaxChecksPerNode,
+		MinChecksPerInstance:   DefaultMinChecksPerInstance,
+		MaxChecksPerInstance:   DefaultMaxChecksPerInstance,
+		CheckStatusWeights:     DefaultCheckStatusWeights,
+		NodeType:               DefaultNodeType,
+		ServiceType:            DefaultServiceType,
+		AddressType:            DefaultAddressType,
+		MetaKeyType:            DefaultMetaKeyType,
+		MetaValueType:          DefaultMetaValueType,
+		NodePetNames:           DefaultPetNameUserConfig(),
+		ServicePetNames:        DefaultPetNameUserConfig(),
+		MetaKeyPetNames:        DefaultPetNameUserConfig(),
+		MetaValueRandomB64:     DefaultRandomB64UserConfig(),
+		TagType:                DefaultTagType,
+		CheckNameType:          DefaultCheckNameType,
+		CheckNotesType:         DefaultCheckNotesType,
+		CheckOutputType:        DefaultCheckOutputType,
+		TagPetNames:            PetNameUserConfig{Segments: 1, Separator: PetNameDefaultSeparator},
+		TagRandomB64:           RandomB64UserConfig{MinSize: 3, MaxSize: 6},
+		CheckNamePetNames:      PetNameUserConfig{Segments: 2, Separator: PetNameDefaultSeparator},
+		CheckNotesPetNames:     PetNameUserConfig{Segments: 6, Separator: " "},
+		CheckOutputRandomB64:   RandomB64UserConfig{MinSize: 64, MaxSize: 256},
 	}
 }
 
@@ -232,8 +477,8 @@ func (c *PetNameUserConfig) Normalize() {
 	}
 }
 
-func (c *PetNameUserConfig) Generator() generators.StringGenerator {
-	return generators.PetNameGenerator(c.Prefix, c.Segments, c.Separator)
+func (c *PetNameUserConfig) Generator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, c.Prefix, c.Segments, c.Separator)
 }
 
 func DefaultPetNameUserConfig() PetNameUserConfig {
@@ -269,8 +514,8 @@ func (c *RandomB64UserConfig) Normalize() {
 	}
 }
 
-func (c *RandomB64UserConfig) Generator() generators.StringGenerator {
-	return generators.RandomB64Generator(c.MinSize, c.MaxSize)
+func (c *RandomB64UserConfig) Generator(rng *rand.Rand) generators.StringGenerator {
+	return generators.RandomB64Generator(rng, c.MinSize, c.MaxSize)
 }
 
 func DefaultRandomB64UserConfig() RandomB64UserConfig {
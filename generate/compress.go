@@ -0,0 +1,112 @@
+package generate
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// CompressionNone writes data as is
+	CompressionNone = "none"
+	// CompressionGzip compresses data with gzip
+	CompressionGzip = "gzip"
+	// CompressionZstd compresses data with zstd
+	CompressionZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ValidateCompression returns an error if the compression is not one of the supported ones.
+func ValidateCompression(compression string) error {
+	switch compression {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	default:
+		return fmt.Errorf("Unknown compression %q: must be one of %q, %q or %q", compression, CompressionNone, CompressionGzip, CompressionZstd)
+	}
+}
+
+// CompressionForPath returns the compression implied by the extension of the path.
+func CompressionForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".gzip":
+		return CompressionGzip
+	case ".zst", ".zstd":
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// NewCompressor wraps w so that everything written is compressed. Closing the returned
+// writer finishes the compressed stream but does not close w.
+func NewCompressor(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to setup zstd compression: %w", err)
+		}
+		return enc, nil
+	default:
+		return nil, ValidateCompression(compression)
+	}
+}
+
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+func (r zstdReadCloser) Close() error {
+	r.Decoder.Close()
+	return nil
+}
+
+// decompress detects whether the data is compressed from its magic number and if so
+// returns a reader of the decompressed data.
+func decompress(r *bufio.Reader) (io.ReadCloser, error) {
+	magic, err := r.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Failed to read data: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		dec, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decompress gzip data: %w", err)
+		}
+		return dec, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decompress zstd data: %w", err)
+		}
+		return zstdReadCloser{dec}, nil
+	default:
+		return ioutil.NopCloser(r), nil
+	}
+}
@@ -0,0 +1,469 @@
+package configentries
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/mkeeler/consul-data/generate/generators"
+)
+
+const (
+	KindProxyDefaults   = "proxy-defaults"
+	KindServiceDefaults = "service-defaults"
+	KindServiceResolver = "service-resolver"
+	KindServiceSplitter = "service-splitter"
+	KindServiceRouter   = "service-router"
+
+	// ProxyDefaultsName is the name Consul requires of proxy-defaults entries
+	ProxyDefaultsName = "global"
+
+	// ProtocolHTTP is the protocol of every service in a discovery chain with routing
+	// or splitting.
+	ProtocolHTTP = "http"
+	protocolTCP  = "tcp"
+)
+
+// Kinds are all the kinds of config entries in the order they must be written so that
+// everything an entry depends on has already been written.
+var Kinds = []string{
+	KindProxyDefaults,
+	KindServiceDefaults,
+	KindServiceResolver,
+	KindServiceSplitter,
+	KindServiceRouter,
+}
+
+// protocols are what service-defaults entries may set
+var protocols = []string{ProtocolHTTP, "http2", "grpc", protocolTCP}
+
+var (
+	// Config entries are only generated when requested as they change how services
+	// within the mesh communicate.
+	DefaultProxyDefaultsProtocol   = ""
+	DefaultServiceDefaultsFraction = 0.0
+	DefaultResolverFraction        = 0.0
+	DefaultSplitterFraction        = 0.0
+	DefaultRouterFraction          = 0.0
+	DefaultMaxSubsets              = 3
+	DefaultMaxSplits               = 3
+	DefaultMaxRoutes               = 3
+	DefaultChainDepth              = 2
+)
+
+// Service is a service which config entries may be generated for
+type Service struct {
+	Name      string
+	Namespace string
+	Partition string
+	// SubsetKey is a meta key of the service's instances and SubsetValues are values
+	// of it which resolver subsets may select.
+	SubsetKey    string
+	SubsetValues []string
+}
+
+// Entry is a single config entry. Only the fields relevant to its kind are set.
+type Entry struct {
+	Kind      string
+	Name      string
+	Namespace string `json:",omitempty"`
+	Partition string `json:",omitempty"`
+
+	// Protocol is set for proxy-defaults and service-defaults entries
+	Protocol string `json:",omitempty"`
+
+	// DefaultSubset and Subsets are set for service-resolver entries. Subsets map the
+	// name of each subset to its filter.
+	DefaultSubset string            `json:",omitempty"`
+	Subsets       map[string]string `json:",omitempty"`
+
+	Splits []*Split `json:",omitempty"`
+	Routes []*Route `json:",omitempty"`
+}
+
+// Target is a service, or subset of one, which traffic is split or routed to
+type Target struct {
+	Service       string `json:",omitempty"`
+	ServiceSubset string `json:",omitempty"`
+}
+
+// Split is a share of a service-splitter entry's traffic. The weights of all the splits
+// of an entry add up to 100.
+type Split struct {
+	Weight float32
+	Target
+}
+
+// Route is a route of a service-router entry which matches a path prefix
+type Route struct {
+	PathPrefix string
+	Target
+}
+
+// Config is all the configuration necessary for creating config entries
+type Config struct {
+	// ProxyDefaultsProtocol is the protocol of a proxy-defaults entry generated in each
+	// partition. None are generated when empty.
+	ProxyDefaultsProtocol string
+	// The fractions of services which each kind of entry is generated for
+	ServiceDefaultsFraction float64
+	ResolverFraction        float64
+	SplitterFraction        float64
+	RouterFraction          float64
+	MaxSubsets              int
+	MaxSplits               int
+	MaxRoutes               int
+	// ChainDepth is the most services with splitters or routers which a request may be
+	// sent through
+	ChainDepth int
+	PathGen    generators.StringGenerator
+
+	// Services are what the config entries are generated for
+	Services []Service
+
+	// Rand is the source of randomness for generating config entries and any default
+	// generators. When nil a new source seeded with the current time is used.
+	Rand *rand.Rand
+}
+
+func DefaultPathGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, "", 1, "-")
+}
+
+// DefaultConfig returns a config with all the defaults filled in.
+func DefaultConfig(rng *rand.Rand) Config {
+	return Config{
+		ProxyDefaultsProtocol:   DefaultProxyDefaultsProtocol,
+		ServiceDefaultsFraction: DefaultServiceDefaultsFraction,
+		ResolverFraction:        DefaultResolverFraction,
+		SplitterFraction:        DefaultSplitterFraction,
+		RouterFraction:          DefaultRouterFraction,
+		MaxSubsets:              DefaultMaxSubsets,
+		MaxSplits:               DefaultMaxSplits,
+		MaxRoutes:               DefaultMaxRoutes,
+		ChainDepth:              DefaultChainDepth,
+		PathGen:                 DefaultPathGenerator(rng),
+		Rand:                    rng,
+	}
+}
+
+func (c *Config) normalize() {
+	if c.Rand == nil {
+		c.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	if c.PathGen == nil {
+		c.PathGen = DefaultPathGenerator(c.Rand)
+	}
+
+	if c.MaxSubsets < 1 {
+		c.MaxSubsets = 1
+	}
+
+	// a split needs somewhere else for the rest of the traffic to go
+	if c.MaxSplits < 2 {
+		c.MaxSplits = 2
+	}
+
+	if c.MaxRoutes < 1 {
+		c.MaxRoutes = 1
+	}
+
+	if c.ChainDepth < 1 {
+		c.ChainDepth = 1
+	}
+}
+
+// chance returns true for the given fraction of calls without consuming any random data
+// when it can't
+func chance(rng *rand.Rand, fraction float64) bool {
+	return fraction > 0 && rng.Float64() < fraction
+}
+
+// scope is the partition and namespace of a service. Entries only refer to services
+// within the same scope.
+type scope struct {
+	partition string
+	namespace string
+}
+
+type generatorState struct {
+	conf Config
+
+	// the effective protocol, resolver subsets and chain depth of each service
+	protocols []string
+	subsets   [][]string
+	depths    []int
+
+	// eligible are the services of each scope which may be split or routed to and
+	// indexes map the names of each scope's services to their index
+	eligible map[scope][]int
+	indexes  map[scope]map[string]int
+}
+
+// targets returns the service's own subsets along with up to max other services which
+// it may split or route to.
+func (g *generatorState) targets(i int, max int) []Target {
+	svc := g.conf.Services[i]
+	targets := []Target{{Service: svc.Name}}
+	for _, subset := range g.subsets[i] {
+		targets = append(targets, Target{Service: svc.Name, ServiceSubset: subset})
+	}
+
+	eligible := g.eligible[scope{partition: svc.Partition, namespace: svc.Namespace}]
+	if max > len(eligible) {
+		max = len(eligible)
+	}
+	picked := make(map[int]struct{}, max)
+	for len(picked) < max {
+		j := g.conf.Rand.Intn(len(eligible))
+		if _, found := picked[j]; found {
+			continue
+		}
+		picked[j] = struct{}{}
+		targets = append(targets, Target{Service: g.conf.Services[eligible[j]].Name})
+	}
+	return targets
+}
+
+// depth returns the chain depth of a service with splits or routes to the targets
+func (g *generatorState) depth(i int, targets []Target) int {
+	svc := g.conf.Services[i]
+	indexes := g.indexes[scope{partition: svc.Partition, namespace: svc.Namespace}]
+
+	depth := 0
+	for _, target := range targets {
+		if target.Service == svc.Name {
+			continue
+		}
+		if j := indexes[target.Service]; g.depths[j] > depth {
+			depth = g.depths[j]
+		}
+	}
+	return depth + 1
+}
+
+func (g *generatorState) genResolver(svc Service) *Entry {
+	values := svc.SubsetValues
+	if len(values) > g.conf.MaxSubsets {
+		values = values[:g.conf.MaxSubsets]
+	}
+
+	entry := Entry{
+		Kind:    KindServiceResolver,
+		Subsets: make(map[string]string, len(values)),
+	}
+	for i, value := range values {
+		entry.Subsets[fmt.Sprintf("v%d", i+1)] = fmt.Sprintf("Service.Meta[%q] == %q", svc.SubsetKey, value)
+	}
+	if g.conf.Rand.Intn(2) == 0 {
+		entry.DefaultSubset = "v1"
+	}
+	return &entry
+}
+
+func (g *generatorState) genSplitter(targets []Target) *Entry {
+	n := 2 + g.conf.Rand.Intn(g.conf.MaxSplits-1)
+	if n > len(targets) {
+		n = len(targets)
+	}
+
+	// the weights are the gaps between distinct cuts of the range [0, 100]
+	cuts := []int{0, 100}
+	for _, cut := range g.conf.Rand.Perm(99)[:n-1] {
+		cuts = append(cuts, cut+1)
+	}
+	sort.Ints(cuts)
+
+	entry := Entry{Kind: KindServiceSplitter}
+	for i, j := range g.conf.Rand.Perm(len(targets))[:n] {
+		entry.Splits = append(entry.Splits, &Split{
+			Weight: float32(cuts[i+1] - cuts[i]),
+			Target: targets[j],
+		})
+	}
+	return &entry
+}
+
+func (g *generatorState) genRouter(targets []Target) (*Entry, error) {
+	n := 1 + g.conf.Rand.Intn(g.conf.MaxRoutes)
+
+	entry := Entry{Kind: KindServiceRouter}
+	prefixes := make(map[string]struct{}, n)
+	for i := 0; i < n; i++ {
+		word, err := g.conf.PathGen()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate route path: %w", err)
+		}
+
+		prefix := "/" + word + "/"
+		if _, found := prefixes[prefix]; found {
+			continue
+		}
+		prefixes[prefix] = struct{}{}
+
+		entry.Routes = append(entry.Routes, &Route{
+			PathPrefix: prefix,
+			Target:     targets[g.conf.Rand.Intn(len(targets))],
+		})
+	}
+	return &entry, nil
+}
+
+// genService generates the entries of a single service. Services are generated in reverse
+// order and may only refer to those generated before them so that chains have no cycles.
+func (g *generatorState) genService(i int) ([]*Entry, error) {
+	conf := g.conf
+	svc := conf.Services[i]
+
+	protocol := ""
+	if chance(conf.Rand, conf.ServiceDefaultsFraction) {
+		protocol = protocols[conf.Rand.Intn(len(protocols))]
+	}
+	hasResolver := len(svc.SubsetValues) > 0 && chance(conf.Rand, conf.ResolverFraction)
+	hasSplitter := chance(conf.Rand, conf.SplitterFraction)
+	hasRouter := chance(conf.Rand, conf.RouterFraction)
+
+	g.protocols[i] = protocol
+	if g.protocols[i] == "" {
+		g.protocols[i] = conf.ProxyDefaultsProtocol
+	}
+	if g.protocols[i] == "" {
+		g.protocols[i] = protocolTCP
+	}
+
+	// splitting and routing require the service to use HTTP
+	if (hasSplitter || hasRouter) && g.protocols[i] != ProtocolHTTP {
+		protocol = ProtocolHTTP
+		g.protocols[i] = ProtocolHTTP
+	}
+
+	var entries []*Entry
+	if protocol != "" {
+		entries = append(entries, &Entry{Kind: KindServiceDefaults, Protocol: protocol})
+	}
+
+	if hasResolver {
+		resolver := g.genResolver(svc)
+		entries = append(entries, resolver)
+		for subset := range resolver.Subsets {
+			g.subsets[i] = append(g.subsets[i], subset)
+		}
+		sort.Strings(g.subsets[i])
+	}
+
+	var used []Target
+	if hasSplitter {
+		splitter := g.genSplitter(g.targets(i, conf.MaxSplits))
+		entries = append(entries, splitter)
+		for _, split := range splitter.Splits {
+			used = append(used, split.Target)
+		}
+	}
+
+	if hasRouter {
+		router, err := g.genRouter(g.targets(i, conf.MaxRoutes))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, router)
+		for _, route := range router.Routes {
+			used = append(used, route.Target)
+		}
+	}
+
+	if hasSplitter || hasRouter {
+		g.depths[i] = g.depth(i, used)
+	}
+
+	for _, entry := range entries {
+		entry.Name = svc.Name
+		entry.Namespace = svc.Namespace
+		entry.Partition = svc.Partition
+	}
+
+	key := scope{partition: svc.Partition, namespace: svc.Namespace}
+	if g.indexes[key] == nil {
+		g.indexes[key] = make(map[string]int)
+	}
+	g.indexes[key][svc.Name] = i
+	if g.protocols[i] == ProtocolHTTP && g.depths[i] < conf.ChainDepth {
+		g.eligible[key] = append(g.eligible[key], i)
+	}
+	return entries, nil
+}
+
+// Generate generates all of the config entries in the order they must be written
+func Generate(conf Config) ([]*Entry, error) {
+	conf.normalize()
+
+	g := generatorState{
+		conf:      conf,
+		protocols: make([]string, len(conf.Services)),
+		subsets:   make([][]string, len(conf.Services)),
+		depths:    make([]int, len(conf.Services)),
+		eligible:  make(map[scope][]int),
+		indexes:   make(map[scope]map[string]int),
+	}
+
+	byService := make([][]*Entry, len(conf.Services))
+	for i := len(conf.Services) - 1; i >= 0; i-- {
+		entries, err := g.genService(i)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate config entries for %s: %w", conf.Services[i].Name, err)
+		}
+		byService[i] = entries
+	}
+
+	var entries []*Entry
+	if conf.ProxyDefaultsProtocol != "" {
+		partitions := make(map[string]struct{})
+		for _, svc := range conf.Services {
+			if _, found := partitions[svc.Partition]; found {
+				continue
+			}
+			partitions[svc.Partition] = struct{}{}
+
+			entries = append(entries, &Entry{
+				Kind:      KindProxyDefaults,
+				Name:      ProxyDefaultsName,
+				Partition: svc.Partition,
+				Protocol:  conf.ProxyDefaultsProtocol,
+			})
+		}
+	}
+
+	// the remaining kinds are all per service
+	for _, kind := range Kinds[1:] {
+		for _, serviceEntries := range byService {
+			for _, entry := range serviceEntries {
+				if entry.Kind == kind {
+					entries = append(entries, entry)
+				}
+			}
+		}
+	}
+
+	if err := Validate(entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Stream generates all of the config entries and then invokes the function with each
+// in the order they must be written. Unlike other data the entries are all generated
+// up front so that they can be validated.
+func Stream(conf Config, fn func(*Entry) error) error {
+	entries, err := Generate(conf)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
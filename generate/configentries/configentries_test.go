@@ -0,0 +1,133 @@
+package configentries
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func testServices(n int) []Service {
+	services := make([]Service, n)
+	for i := range services {
+		services[i] = Service{
+			Name:         fmt.Sprintf("svc-%d", i),
+			SubsetKey:    "version",
+			SubsetValues: []string{"1", "2", "3", "4"},
+		}
+		if i%2 == 1 {
+			services[i].Partition = "p1"
+		}
+	}
+	return services
+}
+
+// chainDepth returns the most services with splitters or routers a request to the
+// service is sent through
+func chainDepth(entries []*Entry, scope scope, name string) int {
+	depth := 0
+	for _, entry := range entries {
+		if entry.Name != name || entry.Partition != scope.partition || entry.Namespace != scope.namespace {
+			continue
+		}
+
+		var targets []Target
+		for _, split := range entry.Splits {
+			targets = append(targets, split.Target)
+		}
+		for _, route := range entry.Routes {
+			targets = append(targets, route.Target)
+		}
+
+		for _, target := range targets {
+			d := 1
+			if target.Service != "" && target.Service != name {
+				d += chainDepth(entries, scope, target.Service)
+			}
+			if d > depth {
+				depth = d
+			}
+		}
+	}
+	return depth
+}
+
+func TestGenerate(t *testing.T) {
+	cases := map[string]struct {
+		conf     Config
+		services int
+		none     bool
+	}{
+		"defaults": {
+			conf:     DefaultConfig(nil),
+			services: 20,
+			none:     true,
+		},
+		"no services": {
+			conf: Config{ProxyDefaultsProtocol: ProtocolHTTP, ResolverFraction: 1, SplitterFraction: 1, RouterFraction: 1},
+			none: true,
+		},
+		"all": {
+			conf:     Config{ServiceDefaultsFraction: 1, ResolverFraction: 1, SplitterFraction: 1, RouterFraction: 1, MaxSubsets: 2, ChainDepth: 1},
+			services: 20,
+		},
+		"deep chains": {
+			conf:     Config{ProxyDefaultsProtocol: "grpc", ResolverFraction: 0.5, SplitterFraction: 0.5, RouterFraction: 0.5, MaxSplits: 5, MaxSubsets: 2, MaxRoutes: 5, ChainDepth: 3},
+			services: 50,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			conf := tc.conf
+			conf.Services = testServices(tc.services)
+			conf.Rand = rand.New(rand.NewSource(1))
+			conf.PathGen = nil
+
+			// Generate validates the entries itself
+			entries, err := Generate(conf)
+			if err != nil {
+				t.Fatalf("Failed to generate config entries: %v", err)
+			}
+			if tc.none {
+				if len(entries) != 0 {
+					t.Fatalf("expected no entries but got %d", len(entries))
+				}
+				return
+			}
+			if len(entries) == 0 {
+				t.Fatalf("expected entries to be generated")
+			}
+
+			kinds := make(map[string]int)
+			for i, kind := range Kinds {
+				kinds[kind] = i
+			}
+
+			partitions := make(map[string]struct{})
+			for i, entry := range entries {
+				if i > 0 && kinds[entry.Kind] < kinds[entries[i-1].Kind] {
+					t.Fatalf("%s %s was generated after a %s", entry.Kind, entry.Name, entries[i-1].Kind)
+				}
+
+				if entry.Kind == KindProxyDefaults {
+					if _, found := partitions[entry.Partition]; found {
+						t.Fatalf("more than one %s was generated for partition %q", entry.Kind, entry.Partition)
+					}
+					partitions[entry.Partition] = struct{}{}
+				}
+
+				if len(entry.Subsets) > tc.conf.MaxSubsets {
+					t.Fatalf("%s %s has %d subsets", entry.Kind, entry.Name, len(entry.Subsets))
+				}
+
+				if depth := chainDepth(entries, scope{partition: entry.Partition, namespace: entry.Namespace}, entry.Name); depth > tc.conf.ChainDepth {
+					t.Fatalf("chain of %s is %d services deep instead of at most %d", entry.Name, depth, tc.conf.ChainDepth)
+				}
+			}
+
+			if tc.conf.ProxyDefaultsProtocol != "" && len(partitions) != 2 {
+				t.Fatalf("expected proxy-defaults in 2 partitions but got %d", len(partitions))
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package configentries
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+type UserConfig struct {
+	ProxyDefaultsProtocol   string
+	ServiceDefaultsFraction float64
+	ResolverFraction        float64
+	SplitterFraction        float64
+	RouterFraction          float64
+	MaxSubsets              int
+	MaxSplits               int
+	MaxRoutes               int
+	ChainDepth              int
+}
+
+func (c *UserConfig) ToGeneratorConfig(rng *rand.Rand) (Config, error) {
+	c.Normalize()
+
+	if c.ProxyDefaultsProtocol != "" {
+		valid := false
+		for _, protocol := range protocols {
+			if c.ProxyDefaultsProtocol == protocol {
+				valid = true
+			}
+		}
+		if !valid {
+			return Config{}, fmt.Errorf("Invalid proxy-defaults protocol: %s", c.ProxyDefaultsProtocol)
+		}
+	}
+
+	return Config{
+		ProxyDefaultsProtocol:   c.ProxyDefaultsProtocol,
+		ServiceDefaultsFraction: c.ServiceDefaultsFraction,
+		ResolverFraction:        c.ResolverFraction,
+		SplitterFraction:        c.SplitterFraction,
+		RouterFraction:          c.RouterFraction,
+		MaxSubsets:              c.MaxSubsets,
+		MaxSplits:               c.MaxSplits,
+		MaxRoutes:               c.MaxRoutes,
+		ChainDepth:              c.ChainDepth,
+		PathGen:                 DefaultPathGenerator(rng),
+		Rand:                    rng,
+	}, nil
+}
+
+// Enabled returns whether any config entries are to be generated
+func (c *UserConfig) Enabled() bool {
+	return c.ProxyDefaultsProtocol != "" ||
+		c.ServiceDefaultsFraction > 0 ||
+		c.ResolverFraction > 0 ||
+		c.SplitterFraction > 0 ||
+		c.RouterFraction > 0
+}
+
+func (c *UserConfig) Normalize() {
+	if c.ServiceDefaultsFraction < 0 {
+		c.ServiceDefaultsFraction = DefaultServiceDefaultsFraction
+	}
+
+	if c.ResolverFraction < 0 {
+		c.ResolverFraction = DefaultResolverFraction
+	}
+
+	if c.SplitterFraction < 0 {
+		c.SplitterFraction = DefaultSplitterFraction
+	}
+
+	if c.RouterFraction < 0 {
+		c.RouterFraction = DefaultRouterFraction
+	}
+
+	if c.MaxSubsets <= 0 {
+		c.MaxSubsets = DefaultMaxSubsets
+	}
+
+	if c.MaxSplits <= 0 {
+		c.MaxSplits = DefaultMaxSplits
+	}
+
+	if c.MaxRoutes <= 0 {
+		c.MaxRoutes = DefaultMaxRoutes
+	}
+
+	if c.ChainDepth <= 0 {
+		c.ChainDepth = DefaultChainDepth
+	}
+}
+
+func DefaultUserConfig() UserConfig {
+	return UserConfig{
+		ProxyDefaultsProtocol:   DefaultProxyDefaultsProtocol,
+		ServiceDefaultsFraction: DefaultServiceDefaultsFraction,
+		ResolverFraction:        DefaultResolverFraction,
+		SplitterFraction:        DefaultSplitterFraction,
+		RouterFraction:          DefaultRouterFraction,
+		MaxSubsets:              DefaultMaxSubsets,
+		MaxSplits:               DefaultMaxSplits,
+		MaxRoutes:               DefaultMaxRoutes,
+		ChainDepth:              DefaultChainDepth,
+	}
+}
@@ -0,0 +1,127 @@
+package configentries
+
+import (
+	"fmt"
+)
+
+type entryKey struct {
+	scope
+	name string
+}
+
+// Protocols tracks the effective protocol of services from the proxy-defaults and
+// service-defaults entries added to it.
+type Protocols struct {
+	partitions map[string]string
+	services   map[entryKey]string
+}
+
+func NewProtocols() *Protocols {
+	return &Protocols{
+		partitions: make(map[string]string),
+		services:   make(map[entryKey]string),
+	}
+}
+
+// Add records the protocol set by a proxy-defaults or service-defaults entry. Entries
+// of other kinds are ignored.
+func (p *Protocols) Add(entry *Entry) {
+	switch entry.Kind {
+	case KindProxyDefaults:
+		p.partitions[entry.Partition] = entry.Protocol
+	case KindServiceDefaults:
+		p.services[entryKey{scope: scope{partition: entry.Partition, namespace: entry.Namespace}, name: entry.Name}] = entry.Protocol
+	}
+}
+
+// Protocol returns the effective protocol of the service, which is tcp unless set by
+// an entry.
+func (p *Protocols) Protocol(partition string, namespace string, name string) string {
+	if protocol, found := p.services[entryKey{scope: scope{partition: partition, namespace: namespace}, name: name}]; found {
+		return protocol
+	}
+	if protocol, found := p.partitions[partition]; found {
+		return protocol
+	}
+	return protocolTCP
+}
+
+// Validate checks that the entries are consistent with each other. Every service split
+// or routed to must use HTTP, every subset referenced must be defined by a resolver and
+// the weights of each splitter must add up to 100. Entries must be in the order they
+// are written so that a reference is only valid once the entry it refers to is defined.
+func Validate(entries []*Entry) error {
+	protocols := NewProtocols()
+	subsets := make(map[entryKey]map[string]string)
+
+	protocol := func(key entryKey) string {
+		return protocols.Protocol(key.partition, key.namespace, key.name)
+	}
+
+	checkTarget := func(key entryKey, target Target) error {
+		targetKey := entryKey{scope: key.scope, name: target.Service}
+		if target.Service == "" {
+			targetKey.name = key.name
+		}
+
+		if p := protocol(targetKey); p != ProtocolHTTP {
+			return fmt.Errorf("target %s uses protocol %s instead of %s", targetKey.name, p, ProtocolHTTP)
+		}
+
+		if target.ServiceSubset != "" {
+			if _, found := subsets[targetKey][target.ServiceSubset]; !found {
+				return fmt.Errorf("target %s has no subset %s", targetKey.name, target.ServiceSubset)
+			}
+		}
+		return nil
+	}
+
+	for _, entry := range entries {
+		key := entryKey{scope: scope{partition: entry.Partition, namespace: entry.Namespace}, name: entry.Name}
+
+		switch entry.Kind {
+		case KindProxyDefaults:
+			if entry.Name != ProxyDefaultsName {
+				return fmt.Errorf("Invalid %s %s: must be named %s", entry.Kind, entry.Name, ProxyDefaultsName)
+			}
+			protocols.Add(entry)
+		case KindServiceDefaults:
+			protocols.Add(entry)
+		case KindServiceResolver:
+			if entry.DefaultSubset != "" {
+				if _, found := entry.Subsets[entry.DefaultSubset]; !found {
+					return fmt.Errorf("Invalid %s %s: default subset %s is not defined", entry.Kind, entry.Name, entry.DefaultSubset)
+				}
+			}
+			subsets[key] = entry.Subsets
+		case KindServiceSplitter:
+			if p := protocol(key); p != ProtocolHTTP {
+				return fmt.Errorf("Invalid %s %s: service uses protocol %s instead of %s", entry.Kind, entry.Name, p, ProtocolHTTP)
+			}
+
+			var total float32
+			for _, split := range entry.Splits {
+				if err := checkTarget(key, split.Target); err != nil {
+					return fmt.Errorf("Invalid %s %s: %w", entry.Kind, entry.Name, err)
+				}
+				total += split.Weight
+			}
+			if total != 100 {
+				return fmt.Errorf("Invalid %s %s: split weights add up to %v instead of 100", entry.Kind, entry.Name, total)
+			}
+		case KindServiceRouter:
+			if p := protocol(key); p != ProtocolHTTP {
+				return fmt.Errorf("Invalid %s %s: service uses protocol %s instead of %s", entry.Kind, entry.Name, p, ProtocolHTTP)
+			}
+
+			for _, route := range entry.Routes {
+				if err := checkTarget(key, route.Target); err != nil {
+					return fmt.Errorf("Invalid %s %s: %w", entry.Kind, entry.Name, err)
+				}
+			}
+		default:
+			return fmt.Errorf("Invalid config entry %s: unknown kind %s", entry.Name, entry.Kind)
+		}
+	}
+	return nil
+}
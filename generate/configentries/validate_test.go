@@ -0,0 +1,153 @@
+package configentries
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProtocols(t *testing.T) {
+	entries := []*Entry{
+		{Kind: KindProxyDefaults, Name: ProxyDefaultsName, Partition: "p1", Protocol: "http2"},
+		{Kind: KindServiceDefaults, Name: "api", Protocol: ProtocolHTTP},
+		{Kind: KindServiceDefaults, Name: "db", Partition: "p1", Protocol: protocolTCP},
+		{Kind: KindServiceResolver, Name: "web", Subsets: map[string]string{"v1": ""}},
+	}
+
+	cases := map[string]struct {
+		partition string
+		namespace string
+		name      string
+		protocol  string
+	}{
+		"service defaults":           {name: "api", protocol: ProtocolHTTP},
+		"default":                    {name: "web", protocol: protocolTCP},
+		"other namespace":            {namespace: "ns", name: "api", protocol: protocolTCP},
+		"proxy defaults":             {partition: "p1", name: "api", protocol: "http2"},
+		"service overrides defaults": {partition: "p1", name: "db", protocol: protocolTCP},
+	}
+
+	protocols := NewProtocols()
+	for _, entry := range entries {
+		protocols.Add(entry)
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if protocol := protocols.Protocol(tc.partition, tc.namespace, tc.name); protocol != tc.protocol {
+				t.Fatalf("expected protocol %s but got %s", tc.protocol, protocol)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	httpDefaults := func(name string) *Entry {
+		return &Entry{Kind: KindServiceDefaults, Name: name, Protocol: ProtocolHTTP}
+	}
+	resolver := &Entry{Kind: KindServiceResolver, Name: "api", Subsets: map[string]string{"v1": "", "v2": ""}}
+	split := func(weight float32, service string, subset string) *Split {
+		return &Split{Weight: weight, Target: Target{Service: service, ServiceSubset: subset}}
+	}
+
+	cases := map[string]struct {
+		entries  []*Entry
+		expected string
+	}{
+		"none": {},
+		"valid chain": {
+			entries: []*Entry{
+				{Kind: KindProxyDefaults, Name: ProxyDefaultsName, Protocol: "grpc"},
+				httpDefaults("web"),
+				httpDefaults("api"),
+				resolver,
+				{Kind: KindServiceSplitter, Name: "api", Splits: []*Split{split(40, "", "v1"), split(60, "api", "v2")}},
+				{Kind: KindServiceRouter, Name: "web", Routes: []*Route{{PathPrefix: "/a/", Target: Target{Service: "api", ServiceSubset: "v1"}}}},
+			},
+		},
+		"proxy defaults protocol": {
+			entries: []*Entry{
+				{Kind: KindProxyDefaults, Name: ProxyDefaultsName, Protocol: ProtocolHTTP},
+				{Kind: KindServiceRouter, Name: "web", Routes: []*Route{{PathPrefix: "/a/", Target: Target{Service: "api"}}}},
+			},
+		},
+		"proxy defaults name": {
+			entries:  []*Entry{{Kind: KindProxyDefaults, Name: "web"}},
+			expected: "must be named global",
+		},
+		"undefined default subset": {
+			entries:  []*Entry{{Kind: KindServiceResolver, Name: "api", DefaultSubset: "v3", Subsets: resolver.Subsets}},
+			expected: "default subset v3 is not defined",
+		},
+		"splitter on tcp service": {
+			entries:  []*Entry{{Kind: KindServiceSplitter, Name: "api", Splits: []*Split{split(100, "", "")}}},
+			expected: "service uses protocol tcp",
+		},
+		"router on tcp service": {
+			entries: []*Entry{
+				{Kind: KindServiceDefaults, Name: "web", Protocol: protocolTCP},
+				{Kind: KindServiceRouter, Name: "web", Routes: []*Route{{PathPrefix: "/a/"}}},
+			},
+			expected: "service uses protocol tcp",
+		},
+		"target protocol": {
+			entries: []*Entry{
+				httpDefaults("web"),
+				{Kind: KindServiceDefaults, Name: "api", Protocol: "grpc"},
+				{Kind: KindServiceRouter, Name: "web", Routes: []*Route{{PathPrefix: "/a/", Target: Target{Service: "api"}}}},
+			},
+			expected: "target api uses protocol grpc",
+		},
+		"target in another namespace": {
+			entries: []*Entry{
+				httpDefaults("web"),
+				{Kind: KindServiceDefaults, Name: "api", Namespace: "ns", Protocol: ProtocolHTTP},
+				{Kind: KindServiceRouter, Name: "web", Routes: []*Route{{PathPrefix: "/a/", Target: Target{Service: "api"}}}},
+			},
+			expected: "target api uses protocol tcp",
+		},
+		"missing subset": {
+			entries: []*Entry{
+				httpDefaults("api"),
+				resolver,
+				{Kind: KindServiceSplitter, Name: "api", Splits: []*Split{split(50, "", "v1"), split(50, "", "v3")}},
+			},
+			expected: "target api has no subset v3",
+		},
+		"subset before resolver": {
+			entries: []*Entry{
+				httpDefaults("api"),
+				{Kind: KindServiceSplitter, Name: "api", Splits: []*Split{split(50, "", "v1"), split(50, "", "")}},
+				resolver,
+			},
+			expected: "target api has no subset v1",
+		},
+		"weights": {
+			entries: []*Entry{
+				httpDefaults("api"),
+				resolver,
+				{Kind: KindServiceSplitter, Name: "api", Splits: []*Split{split(50, "", "v1"), split(40, "", "v2")}},
+			},
+			expected: "split weights add up to 90 instead of 100",
+		},
+		"unknown kind": {
+			entries:  []*Entry{{Kind: "ingress-gateway", Name: "api"}},
+			expected: "unknown kind ingress-gateway",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := Validate(tc.entries)
+			if tc.expected == "" {
+				if err != nil {
+					t.Fatalf("expected entries to be valid but got: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Fatalf("expected error containing %q but got: %v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package events
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mkeeler/consul-data/generate/generators"
+)
+
+// Serf limits the size of a user event including its name and filters to 512 bytes so
+// payloads are limited to what leaves room for those once base64 encoded.
+const maxPayloadSize = 192
+
+var (
+	// Events are only generated when requested as firing them is fire and forget
+	// traffic rather than data stored in Consul.
+	DefaultNumEvents             = 0
+	DefaultNumNames              = 10
+	DefaultMinPayloadSize        = 0
+	DefaultMaxPayloadSize        = 64
+	DefaultNodeFilterFraction    = 0.2
+	DefaultServiceFilterFraction = 0.3
+	DefaultTagFilterFraction     = 0.5
+	DefaultPrefixFilterFraction  = 0.3
+)
+
+// Node is a catalog node which events may be filtered to along with the services
+// registered on it.
+type Node struct {
+	Name       string
+	Datacenter string
+	Services   []Service
+}
+
+// Service is a service registered on a node along with the tags of its instances
+type Service struct {
+	Name string
+	Tags []string
+}
+
+// Event is a single user event. The filters are regular expressions which the name of
+// the node, a service registered on it and a tag of that service must match for the
+// node to handle the event. The payload is sent as is.
+type Event struct {
+	Name          string
+	Datacenter    string `json:",omitempty"`
+	Payload       string `json:",omitempty"`
+	NodeFilter    string `json:",omitempty"`
+	ServiceFilter string `json:",omitempty"`
+	TagFilter     string `json:",omitempty"`
+}
+
+// Config is all the configuration necessary for creating events
+type Config struct {
+	NumEvents int
+	// NumNames is how many distinct event names the events are spread across as
+	// watches are for all events with a given name
+	NumNames       int
+	MinPayloadSize int
+	MaxPayloadSize int
+	// The filter fractions are the fraction of events filtered to the nodes of a
+	// generated node, service or tag. Only events with a service filter may have a tag
+	// filter as Consul requires it.
+	NodeFilterFraction    float64
+	ServiceFilterFraction float64
+	TagFilterFraction     float64
+	// PrefixFilterFraction is the fraction of node and service filters which match the
+	// first word of the name rather than the whole name so that the event reaches
+	// every node with a similarly named node or service.
+	PrefixFilterFraction float64
+	NameGen              generators.StringGenerator
+	PayloadGen           generators.StringGenerator
+
+	// Nodes are what the filters are generated from. Events are fired in the
+	// datacenter of a randomly picked node so that the filters match it.
+	Nodes []Node
+
+	// Rand is the source of randomness for generating events and any default
+	// generators. When nil a new source seeded with the current time is used.
+	Rand *rand.Rand
+}
+
+func DefaultNameGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, "", 2, "-")
+}
+
+func DefaultPayloadGenerator(rng *rand.Rand, minSize int, maxSize int) generators.StringGenerator {
+	return generators.RandomB64Generator(rng, minSize, maxSize)
+}
+
+// DefaultConfig returns a config with all the defaults filled in.
+func DefaultConfig(rng *rand.Rand) Config {
+	return Config{
+		NumEvents:             DefaultNumEvents,
+		NumNames:              DefaultNumNames,
+		MinPayloadSize:        DefaultMinPayloadSize,
+		MaxPayloadSize:        DefaultMaxPayloadSize,
+		NodeFilterFraction:    DefaultNodeFilterFraction,
+		ServiceFilterFraction: DefaultServiceFilterFraction,
+		TagFilterFraction:     DefaultTagFilterFraction,
+		PrefixFilterFraction:  DefaultPrefixFilterFraction,
+		NameGen:               DefaultNameGenerator(rng),
+		PayloadGen:            DefaultPayloadGenerator(rng, DefaultMinPayloadSize, DefaultMaxPayloadSize),
+		Rand:                  rng,
+	}
+}
+
+func (c *Config) normalize() {
+	if c.Rand == nil {
+		c.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	if c.NumNames <= 0 {
+		c.NumNames = 1
+	}
+
+	if c.MinPayloadSize < 0 {
+		c.MinPayloadSize = 0
+	}
+
+	if c.MaxPayloadSize > maxPayloadSize {
+		c.MaxPayloadSize = maxPayloadSize
+	}
+
+	if c.MaxPayloadSize < c.MinPayloadSize {
+		c.MaxPayloadSize = c.MinPayloadSize
+	}
+
+	if c.NameGen == nil {
+		c.NameGen = DefaultNameGenerator(c.Rand)
+	}
+
+	if c.PayloadGen == nil {
+		c.PayloadGen = DefaultPayloadGenerator(c.Rand, c.MinPayloadSize, c.MaxPayloadSize)
+	}
+}
+
+// chance returns true for the given fraction of calls without consuming any random data
+// when it can't
+func chance(rng *rand.Rand, fraction float64) bool {
+	return fraction > 0 && rng.Float64() < fraction
+}
+
+// genNames generates the distinct names which the events are fired with
+func genNames(conf Config) ([]string, error) {
+	names := make([]string, 0, conf.NumNames)
+	seen := make(map[string]struct{}, conf.NumNames)
+	for attempt := 0; len(names) < conf.NumNames && attempt < conf.NumNames*100; attempt++ {
+		name, err := conf.NameGen()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, found := seen[name]; !found {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// filter returns an anchored regular expression matching the name or, for the given
+// fraction of calls, any name starting with the same first word.
+func filter(conf Config, name string) string {
+	if i := strings.Index(name, "-"); i > 0 && chance(conf.Rand, conf.PrefixFilterFraction) {
+		return "^" + regexp.QuoteMeta(name[:i+1])
+	}
+	return "^" + regexp.QuoteMeta(name) + "$"
+}
+
+func genEvent(conf Config, node Node, name string) (*Event, error) {
+	payload, err := conf.PayloadGen()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate payload of event %s: %w", name, err)
+	}
+
+	event := Event{
+		Name:       name,
+		Datacenter: node.Datacenter,
+		Payload:    payload,
+	}
+
+	if chance(conf.Rand, conf.NodeFilterFraction) {
+		event.NodeFilter = filter(conf, node.Name)
+	}
+
+	if len(node.Services) > 0 && chance(conf.Rand, conf.ServiceFilterFraction) {
+		service := node.Services[conf.Rand.Intn(len(node.Services))]
+		event.ServiceFilter = filter(conf, service.Name)
+
+		if len(service.Tags) > 0 && chance(conf.Rand, conf.TagFilterFraction) {
+			tag := service.Tags[conf.Rand.Intn(len(service.Tags))]
+			event.TagFilter = "^" + regexp.QuoteMeta(tag) + "$"
+		}
+	}
+	return &event, nil
+}
+
+// Stream will generate the events invoking the function with each as soon as it is
+// generated. Each event's filters match at least the node it was generated from.
+func Stream(conf Config, fn func(*Event) error) error {
+	conf.normalize()
+
+	if len(conf.Nodes) == 0 || conf.NumEvents <= 0 {
+		return nil
+	}
+
+	names, err := genNames(conf)
+	if err != nil {
+		return fmt.Errorf("Failed to generate event names: %w", err)
+	}
+
+	for i := 0; i < conf.NumEvents; i++ {
+		node := conf.Nodes[conf.Rand.Intn(len(conf.Nodes))]
+
+		event, err := genEvent(conf, node, names[conf.Rand.Intn(len(names))])
+		if err != nil {
+			return err
+		}
+
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package events
+
+import (
+	"encoding/base64"
+	"math/rand"
+	"regexp"
+	"testing"
+)
+
+func testNodes() []Node {
+	return []Node{
+		{Name: "web-node-1", Datacenter: "dc1", Services: []Service{{Name: "web-frontend", Tags: []string{"v1", "primary"}}, {Name: "api"}}},
+		{Name: "web-node-2", Datacenter: "dc1", Services: []Service{{Name: "web-backend", Tags: []string{"v2"}}}},
+		{Name: "db", Datacenter: "dc2"},
+	}
+}
+
+// matches returns whether the node handles the event
+func matches(t *testing.T, event *Event, node Node) bool {
+	t.Helper()
+
+	match := func(filter string, value string) bool {
+		if filter == "" {
+			return true
+		}
+		re, err := regexp.Compile(filter)
+		if err != nil {
+			t.Fatalf("event %s has invalid filter %s: %v", event.Name, filter, err)
+		}
+		return re.MatchString(value)
+	}
+
+	if node.Datacenter != event.Datacenter || !match(event.NodeFilter, node.Name) {
+		return false
+	}
+	if event.ServiceFilter == "" {
+		return true
+	}
+	for _, svc := range node.Services {
+		if !match(event.ServiceFilter, svc.Name) {
+			continue
+		}
+		if event.TagFilter == "" {
+			return true
+		}
+		for _, tag := range svc.Tags {
+			if match(event.TagFilter, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestStream(t *testing.T) {
+	cases := map[string]struct {
+		conf   Config
+		nodes  []Node
+		events int
+	}{
+		"defaults": {
+			conf:  DefaultConfig(nil),
+			nodes: testNodes(),
+		},
+		"no nodes": {
+			conf: Config{NumEvents: 10},
+		},
+		"no filters": {
+			conf:   Config{NumEvents: 20, NumNames: 3, MaxPayloadSize: 16},
+			nodes:  testNodes(),
+			events: 20,
+		},
+		"all filters": {
+			conf:   Config{NumEvents: 100, NumNames: 5, NodeFilterFraction: 1, ServiceFilterFraction: 1, TagFilterFraction: 1},
+			nodes:  testNodes(),
+			events: 100,
+		},
+		"prefix filters": {
+			conf:   Config{NumEvents: 100, NumNames: 5, NodeFilterFraction: 1, ServiceFilterFraction: 1, PrefixFilterFraction: 1},
+			nodes:  testNodes(),
+			events: 100,
+		},
+		"mixed filters": {
+			conf:   Config{NumEvents: 100, NumNames: 5, MinPayloadSize: 8, MaxPayloadSize: 1000, NodeFilterFraction: 0.5, ServiceFilterFraction: 0.5, TagFilterFraction: 0.5, PrefixFilterFraction: 0.5},
+			nodes:  testNodes(),
+			events: 100,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			conf := tc.conf
+			conf.Nodes = tc.nodes
+			conf.Rand = rand.New(rand.NewSource(1))
+			conf.NameGen = nil
+			conf.PayloadGen = nil
+
+			maxPayload := conf.MaxPayloadSize
+			if maxPayload > maxPayloadSize {
+				maxPayload = maxPayloadSize
+			}
+
+			names := make(map[string]struct{})
+			events := 0
+			err := Stream(conf, func(event *Event) error {
+				events++
+				names[event.Name] = struct{}{}
+
+				payload, err := base64.StdEncoding.DecodeString(event.Payload)
+				if err != nil {
+					t.Fatalf("event %s has invalid payload: %v", event.Name, err)
+				}
+				if len(payload) < conf.MinPayloadSize || len(payload) > maxPayload {
+					t.Fatalf("event %s has a payload of %d bytes", event.Name, len(payload))
+				}
+
+				if (conf.NodeFilterFraction == 0 && event.NodeFilter != "") || (conf.NodeFilterFraction == 1 && event.NodeFilter == "") {
+					t.Fatalf("event %s has node filter %q", event.Name, event.NodeFilter)
+				}
+				if event.TagFilter != "" && event.ServiceFilter == "" {
+					t.Fatalf("event %s has a tag filter without a service filter", event.Name)
+				}
+				if conf.PrefixFilterFraction == 1 && event.NodeFilter == "^web-node-1$" {
+					t.Fatalf("event %s has node filter %s instead of matching the prefix", event.Name, event.NodeFilter)
+				}
+
+				var matched bool
+				for _, node := range tc.nodes {
+					matched = matched || matches(t, event, node)
+				}
+				if !matched {
+					t.Fatalf("event %+v doesn't match any node", event)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to generate events: %v", err)
+			}
+
+			if events != tc.events {
+				t.Fatalf("expected %d events but got %d", tc.events, events)
+			}
+			if len(names) > conf.NumNames {
+				t.Fatalf("expected at most %d event names but got %d", conf.NumNames, len(names))
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	cases := map[string]struct {
+		name     string
+		fraction float64
+		expected string
+	}{
+		"exact":            {name: "web-frontend", expected: "^web-frontend$"},
+		"prefix":           {name: "web-frontend", fraction: 1, expected: "^web-"},
+		"no prefix":        {name: "web", fraction: 1, expected: "^web$"},
+		"leading dash":     {name: "-web", fraction: 1, expected: "^-web$"},
+		"quoted":           {name: "web.frontend", expected: `^web\.frontend$`},
+		"quoted in prefix": {name: "web.a-frontend", fraction: 1, expected: `^web\.a-`},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			conf := Config{PrefixFilterFraction: tc.fraction, Rand: rand.New(rand.NewSource(1))}
+			if actual := filter(conf, tc.name); actual != tc.expected {
+				t.Fatalf("expected filter %s but got %s", tc.expected, actual)
+			}
+		})
+	}
+}
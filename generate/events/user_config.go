@@ -0,0 +1,94 @@
+package events
+
+import (
+	"math/rand"
+)
+
+type UserConfig struct {
+	NumEvents             int
+	NumNames              int
+	MinPayloadSize        int
+	MaxPayloadSize        int
+	NodeFilterFraction    float64
+	ServiceFilterFraction float64
+	TagFilterFraction     float64
+	PrefixFilterFraction  float64
+}
+
+func (c *UserConfig) ToGeneratorConfig(rng *rand.Rand) (Config, error) {
+	c.Normalize()
+
+	return Config{
+		NumEvents:             c.NumEvents,
+		NumNames:              c.NumNames,
+		MinPayloadSize:        c.MinPayloadSize,
+		MaxPayloadSize:        c.MaxPayloadSize,
+		NodeFilterFraction:    c.NodeFilterFraction,
+		ServiceFilterFraction: c.ServiceFilterFraction,
+		TagFilterFraction:     c.TagFilterFraction,
+		PrefixFilterFraction:  c.PrefixFilterFraction,
+		NameGen:               DefaultNameGenerator(rng),
+		PayloadGen:            DefaultPayloadGenerator(rng, c.MinPayloadSize, c.MaxPayloadSize),
+		Rand:                  rng,
+	}, nil
+}
+
+// Enabled returns whether any events are to be generated
+func (c *UserConfig) Enabled() bool {
+	return c.NumEvents > 0
+}
+
+func (c *UserConfig) Normalize() {
+	if c.NumEvents < 0 {
+		c.NumEvents = DefaultNumEvents
+	}
+
+	if c.NumNames <= 0 {
+		c.NumNames = DefaultNumNames
+	}
+
+	if c.MinPayloadSize < 0 {
+		c.MinPayloadSize = DefaultMinPayloadSize
+	}
+
+	if c.MaxPayloadSize <= 0 {
+		c.MaxPayloadSize = DefaultMaxPayloadSize
+	}
+
+	if c.MaxPayloadSize > maxPayloadSize {
+		c.MaxPayloadSize = maxPayloadSize
+	}
+
+	if c.MaxPayloadSize < c.MinPayloadSize {
+		c.MaxPayloadSize = c.MinPayloadSize
+	}
+
+	if c.NodeFilterFraction < 0 {
+		c.NodeFilterFraction = DefaultNodeFilterFraction
+	}
+
+	if c.ServiceFilterFraction < 0 {
+		c.ServiceFilterFraction = DefaultServiceFilterFraction
+	}
+
+	if c.TagFilterFraction < 0 {
+		c.TagFilterFraction = DefaultTagFilterFraction
+	}
+
+	if c.PrefixFilterFraction < 0 {
+		c.PrefixFilterFraction = DefaultPrefixFilterFraction
+	}
+}
+
+func DefaultUserConfig() UserConfig {
+	return UserConfig{
+		NumEvents:             DefaultNumEvents,
+		NumNames:              DefaultNumNames,
+		MinPayloadSize:        DefaultMinPayloadSize,
+		MaxPayloadSize:        DefaultMaxPayloadSize,
+		NodeFilterFraction:    DefaultNodeFilterFraction,
+		ServiceFilterFraction: DefaultServiceFilterFraction,
+		TagFilterFraction:     DefaultTagFilterFraction,
+		PrefixFilterFraction:  DefaultPrefixFilterFraction,
+	}
+}
@@ -0,0 +1,114 @@
+package generate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/mkeeler/consul-data/generate/acl"
+	"github.com/mkeeler/consul-data/generate/catalog"
+	"github.com/mkeeler/consul-data/generate/configentries"
+	"github.com/mkeeler/consul-data/generate/events"
+	"github.com/mkeeler/consul-data/generate/intentions"
+	"github.com/mkeeler/consul-data/generate/kv"
+	"github.com/mkeeler/consul-data/generate/preparedqueries"
+	"github.com/mkeeler/consul-data/generate/sessions"
+)
+
+const (
+	// FormatJSON is a single JSON object as produced by marshalling a Data struct
+	FormatJSON = "json"
+	// FormatNDJSON is newline delimited JSON with one KV entry or node per line
+	FormatNDJSON = "ndjson"
+)
+
+// formatSniffSize is how much of the data is inspected to detect its format
+const formatSniffSize = 4096
+
+// Encoder incrementally serializes data in one of the supported formats.
+type Encoder interface {
+	Handler() Handler
+	WriteKV(key string, value kv.Value) error
+	WriteGraphService(svc *catalog.GraphService) error
+	WriteNode(node *catalog.Node) error
+	WriteACLPolicy(policy *acl.Policy) error
+	WriteACLRole(role *acl.Role) error
+	WriteACLToken(token *acl.Token) error
+	WriteConfigEntry(entry *configentries.Entry) error
+	WriteIntentions(intentions *intentions.Intentions) error
+	WritePreparedQuery(query *preparedqueries.Query) error
+	WriteSession(session *sessions.Session) error
+	WriteEvent(event *events.Event) error
+	Close() error
+}
+
+// ValidateFormat returns an error if the format is not one of the supported formats.
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatJSON, FormatNDJSON:
+		return nil
+	default:
+		return fmt.Errorf("Unknown data format %q: must be either %q or %q", format, FormatJSON, FormatNDJSON)
+	}
+}
+
+// NewEncoder creates an Encoder which outputs data in the given format to w.
+func NewEncoder(w io.Writer, format string) (Encoder, error) {
+	if err := ValidateFormat(format); err != nil {
+		return nil, err
+	}
+
+	if format == FormatNDJSON {
+		return NewNDJSONWriter(w), nil
+	}
+	return NewWriter(w), nil
+}
+
+// Decode reads data in any of the supported formats and hands each KV entry and node
+// to the handler as it is read, without retaining the data in memory. Entries are
+// handled in the order they appear. The format and any compression of the data are
+// detected from the data itself.
+func Decode(r io.Reader, h Handler) error {
+	decompressed, err := decompress(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	defer decompressed.Close()
+
+	buf := bufio.NewReaderSize(decompressed, formatSniffSize)
+
+	format, err := detectFormat(buf)
+	if err != nil {
+		return err
+	}
+
+	if format == FormatNDJSON {
+		return decodeNDJSON(buf, h)
+	}
+	return decodeJSON(buf, h)
+}
+
+// detectFormat inspects the start of the data without consuming it. NDJSON records
+// always begin with their Type field whereas the JSON format's fields are KV and Catalog.
+func detectFormat(r *bufio.Reader) (string, error) {
+	peeked, err := r.Peek(formatSniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", fmt.Errorf("Failed to read data: %w", err)
+	}
+
+	// empty NDJSON is valid whereas empty JSON is not
+	if len(bytes.TrimSpace(peeked)) == 0 {
+		return FormatNDJSON, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(peeked))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return FormatJSON, nil
+	}
+	if tok, err := dec.Token(); err == nil && tok == "Type" {
+		return FormatNDJSON, nil
+	}
+	return FormatJSON, nil
+}
@@ -0,0 +1,101 @@
+package generate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode_RoundTrip(t *testing.T) {
+	data := testData(t)
+	expected, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Failed to marshal data: %v", err)
+	}
+
+	for _, format := range []string{FormatJSON, FormatNDJSON} {
+		for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+			t.Run(format+"-"+compression, func(t *testing.T) {
+				var buf bytes.Buffer
+				compressor, err := NewCompressor(&buf, compression)
+				if err != nil {
+					t.Fatalf("Failed to create compressor: %v", err)
+				}
+				enc, err := NewEncoder(compressor, format)
+				if err != nil {
+					t.Fatalf("Failed to create encoder: %v", err)
+				}
+				if err := data.Stream(enc.Handler()); err != nil {
+					t.Fatalf("Failed to encode data: %v", err)
+				}
+				if err := enc.Close(); err != nil {
+					t.Fatalf("Failed to close encoder: %v", err)
+				}
+				if err := compressor.Close(); err != nil {
+					t.Fatalf("Failed to close compressor: %v", err)
+				}
+
+				// the compression is detected when decoding
+				var decoded Data
+				if err := Decode(&buf, collect(&decoded)); err != nil {
+					t.Fatalf("Failed to decode data: %v", err)
+				}
+
+				actual, err := json.Marshal(&decoded)
+				if err != nil {
+					t.Fatalf("Failed to marshal data: %v", err)
+				}
+				if !bytes.Equal(expected, actual) {
+					t.Fatalf("decoded data differs from what was encoded")
+				}
+			})
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	cases := map[string]struct {
+		input  string
+		format string
+	}{
+		"empty":         {input: "", format: FormatNDJSON},
+		"whitespace":    {input: " \n\t", format: FormatNDJSON},
+		"ndjson":        {input: `{"Type":"kv","Key":"a"}` + "\n", format: FormatNDJSON},
+		"json":          {input: `{"KV":{},"Catalog":[]}`, format: FormatJSON},
+		"json indent":   {input: "{\n   \"KV\": {}\n}", format: FormatJSON},
+		"not an object": {input: `[1, 2]`, format: FormatJSON},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			format, err := detectFormat(bufio.NewReaderSize(strings.NewReader(tc.input), formatSniffSize))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if format != tc.format {
+				t.Fatalf("expected format %s but got %s", tc.format, format)
+			}
+		})
+	}
+}
+
+func TestCompressionForPath(t *testing.T) {
+	cases := map[string]string{
+		"data.json":      CompressionNone,
+		"data.ndjson":    CompressionNone,
+		"data.json.gz":   CompressionGzip,
+		"data.ndjson.GZ": CompressionGzip,
+		"data.gzip":      CompressionGzip,
+		"data.json.zst":  CompressionZstd,
+		"data.zstd":      CompressionZstd,
+		"dir.gz/data":    CompressionNone,
+	}
+
+	for path, compression := range cases {
+		if actual := CompressionForPath(path); actual != compression {
+			t.Errorf("expected compression %s for %s but got %s", compression, path, actual)
+		}
+	}
+}
@@ -4,46 +4,641 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strings"
 
+	"github.com/mkeeler/consul-data/generate/acl"
 	"github.com/mkeeler/consul-data/generate/catalog"
+	"github.com/mkeeler/consul-data/generate/configentries"
+	"github.com/mkeeler/consul-data/generate/events"
+	"github.com/mkeeler/consul-data/generate/generators"
+	"github.com/mkeeler/consul-data/generate/intentions"
 	"github.com/mkeeler/consul-data/generate/kv"
+	"github.com/mkeeler/consul-data/generate/preparedqueries"
+	"github.com/mkeeler/consul-data/generate/sessions"
 )
 
+const (
+	randStreamKV         = "kv"
+	randStreamCatalog    = "catalog"
+	randStreamACL        = "acl"
+	randStreamIntentions = "intentions"
+	randStreamConfig     = "config-entries"
+	randStreamQueries    = "prepared-queries"
+	randStreamSessions   = "sessions"
+	randStreamEvents     = "events"
+	// randStreamCoordinates is for node coordinates which are generated along with the catalog
+	randStreamCoordinates = "coordinates"
+	// randStreamACLWrite is for the tokens which KV entries and nodes are written with
+	randStreamACLWrite = "acl-write"
+	// the datacenter, partition and namespace pickers each have their own stream, suffixed
+	// to the stream of what they are picked for, so that spreading data across them
+	// doesn't change the rest of the data
+	randStreamDatacenters = "-datacenters"
+	randStreamPartitions  = "-partitions"
+	randStreamNamespaces  = "-namespaces"
+	// randStreamSample is suffixed to the stream of what nodes are sampled for
+	randStreamSample = "-sample"
+)
+
+// maxSampledNodes is the most nodes retained for attaching sessions to and filtering
+// events to. Beyond that a uniform sample of the nodes is kept so that the memory used
+// doesn't grow with the size of the catalog.
+const maxSampledNodes = 10000
+
+// reservoir picks a uniform random sample of a fixed size from a stream of items of
+// unknown length. No random data is consumed until the sample is full so that catalogs
+// which fit within it always use all of their nodes.
+type reservoir struct {
+	rand *rand.Rand
+	size int
+	seen int
+}
+
+// add returns the index of the sample which the next item replaces, which is the
+// length of the sample when it is to be appended, or -1 when it isn't sampled.
+func (r *reservoir) add() int {
+	r.seen++
+	if r.seen <= r.size {
+		return r.seen - 1
+	}
+	if i := r.rand.Intn(r.seen); i < r.size {
+		return i
+	}
+	return -1
+}
+
 type Config struct {
-	KV      kv.UserConfig
-	Catalog catalog.UserConfig
+	// Datacenters are the datacenters that generated KV entries and nodes are
+	// distributed across. When empty no datacenter is set on the data and it will
+	// be pushed to the datacenter of the agent.
+	Datacenters []Datacenter `json:",omitempty"`
+	// Partitions and Namespaces are the admin partitions and namespaces that generated
+	// data is spread across. KV entries are placed in both, nodes in a partition and
+	// services in a namespace. Both are Consul Enterprise features.
+	Partitions      Tenancy
+	Namespaces      Tenancy
+	KV              kv.UserConfig
+	Catalog         catalog.UserConfig
+	ACL             acl.UserConfig
+	ConfigEntries   configentries.UserConfig
+	Intentions      intentions.UserConfig
+	PreparedQueries preparedqueries.UserConfig
+	Sessions        sessions.UserConfig
+	Events          events.UserConfig
+}
+
+// Datacenter is a datacenter which generated data may be placed in
+type Datacenter struct {
+	Name string
+	// Weight is the share of the data that will be placed in this datacenter relative
+	// to the others. It defaults to 1 so that data is evenly distributed.
+	Weight int
 }
 
+// datacenterGenerator returns a generator which picks datacenters according to their
+// weights or nil when no datacenters are configured.
+func datacenterGenerator(rng *rand.Rand, datacenters []Datacenter) generators.StringGenerator {
+	if len(datacenters) == 0 {
+		return nil
+	}
+
+	choices := make([]generators.WeightedChoice, 0, len(datacenters))
+	for _, dc := range datacenters {
+		weight := dc.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		choices = append(choices, generators.WeightedChoice{Value: dc.Name, Weight: weight})
+	}
+	return generators.WeightedGenerator(rng, choices)
+}
+
+// tenancySkewScale is the weight of the first name of a Tenancy without weights
+const tenancySkewScale = 1000
+
+// Tenancy is a set of namespaces or admin partitions which generated data may be placed in
+type Tenancy struct {
+	Names []string `json:",omitempty"`
+	// Weights are the share of the data placed in each of the names relative to the
+	// others. When omitted the data is skewed towards the first names with the Nth name
+	// receiving a share proportional to 1/N, which is how data tends to be spread across
+	// tenants in practice.
+	Weights []int `json:",omitempty"`
+}
+
+// generator returns a generator which picks names according to their weights or nil
+// when no names are configured.
+func (t Tenancy) generator(rng *rand.Rand) generators.StringGenerator {
+	if len(t.Names) == 0 {
+		return nil
+	}
+
+	choices := make([]generators.WeightedChoice, 0, len(t.Names))
+	for i, name := range t.Names {
+		weight := tenancySkewScale / (i + 1)
+		if len(t.Weights) > 0 {
+			weight = 0
+			if i < len(t.Weights) {
+				weight = t.Weights[i]
+			}
+		}
+		if weight == 0 {
+			weight = 1
+		}
+		choices = append(choices, generators.WeightedChoice{Value: name, Weight: weight})
+	}
+	return generators.WeightedGenerator(rng, choices)
+}
+
+// Data is all the generated data. ACL data comes first as the tokens which the other
+// data is written with must exist beforehand.
 type Data struct {
-	KV      kv.KV
-	Catalog catalog.Catalog
+	ACLPolicies     []*acl.Policy `json:",omitempty"`
+	ACLRoles        []*acl.Role   `json:",omitempty"`
+	ACLTokens       []*acl.Token  `json:",omitempty"`
+	KV              kv.KV
+	ServiceGraph    catalog.ServiceGraph `json:",omitempty"`
+	Catalog         catalog.Catalog
+	ConfigEntries   []*configentries.Entry   `json:",omitempty"`
+	Intentions      []*intentions.Intentions `json:",omitempty"`
+	PreparedQueries []*preparedqueries.Query `json:",omitempty"`
+	Sessions        []*sessions.Session      `json:",omitempty"`
+	Events          []*events.Event          `json:",omitempty"`
+}
+
+// GenerateAll generates all the data described by the config. Each type of data is
+// generated using its own pseudo-random stream derived from the seed so that the
+// same seed will always produce the same data for a given subsystem's config regardless
+// of how the others are configured. Concurrent calls are safe.
+func GenerateAll(conf Config, seed int64) (*Data, error) {
+	data := &Data{
+		KV: make(kv.KV),
+	}
+
+	err := StreamAll(conf, seed, Handler{
+		KV: func(key string, value kv.Value) error {
+			data.KV[key] = value
+			return nil
+		},
+		GraphService: func(svc *catalog.GraphService) error {
+			data.ServiceGraph = append(data.ServiceGraph, svc)
+			return nil
+		},
+		Node: func(node *catalog.Node) error {
+			data.Catalog = append(data.Catalog, node)
+			return nil
+		},
+		ACLPolicy: func(policy *acl.Policy) error {
+			data.ACLPolicies = append(data.ACLPolicies, policy)
+			return nil
+		},
+		ACLRole: func(role *acl.Role) error {
+			data.ACLRoles = append(data.ACLRoles, role)
+			return nil
+		},
+		ACLToken: func(token *acl.Token) error {
+			data.ACLTokens = append(data.ACLTokens, token)
+			return nil
+		},
+		ConfigEntry: func(entry *configentries.Entry) error {
+			data.ConfigEntries = append(data.ConfigEntries, entry)
+			return nil
+		},
+		Intentions: func(intentions *intentions.Intentions) error {
+			data.Intentions = append(data.Intentions, intentions)
+			return nil
+		},
+		PreparedQuery: func(query *preparedqueries.Query) error {
+			data.PreparedQueries = append(data.PreparedQueries, query)
+			return nil
+		},
+		Session: func(session *sessions.Session) error {
+			data.Sessions = append(data.Sessions, session)
+			return nil
+		},
+		Event: func(event *events.Event) error {
+			data.Events = append(data.Events, event)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// StreamAll generates the same data as GenerateAll but hands each item to the
+// handler as soon as it is generated instead of retaining it in memory. All ACL data
+// is handled first, followed by the KV entries, the service graph, the nodes and then
+// the config entries, intentions and prepared queries of the generated services and
+// finally the sessions attached to and user events filtered to the generated nodes. ACL
+// policies refer to the generated KV prefixes and services so when ACL data is enabled
+// the KV entries and nodes are generated twice, once to collect what the ACL data
+// refers to and then again to be handled. Only the ACL data, the names of services, the
+// dependencies between services of the service graph and a sample of at most
+// maxSampledNodes nodes for sessions and events are retained.
+func StreamAll(conf Config, seed int64, h Handler) error {
+	var writes *acl.WriteTokens
+	if conf.ACL.Enabled() {
+		var err error
+		writes, err = streamACL(conf, seed, h)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := streamKV(conf, seed, func(key string, value kv.Value) error {
+		if writes != nil {
+			token := writes.KVToken(value.Partition, value.Namespace, kvPrefix(key))
+			value.Token = token.SecretID
+			value.ExpectDenied = token.Denied
+		}
+		return h.handleKV(key, value)
+	})
+	if err != nil {
+		return err
+	}
+
+	// the services which intentions, config entries and prepared queries are generated
+	// for in the order they are first seen. Prepared queries additionally use the
+	// datacenter, tags and node meta of the first instance seen.
+	var services []configentries.Service
+	var queryServices []preparedqueries.Service
+	seen := make(map[intentions.Service]int)
+	collectServices := conf.Intentions.Enabled() || conf.ConfigEntries.Enabled() || conf.PreparedQueries.Enabled()
+	// the nodes which sessions are attached to and events are filtered to
+	var sessionNodes []sessions.Node
+	var eventNodes []events.Node
+	sessionSample := reservoir{rand: generators.NewRand(seed, randStreamSessions+randStreamSample), size: maxSampledNodes}
+	eventSample := reservoir{rand: generators.NewRand(seed, randStreamEvents+randStreamSample), size: maxSampledNodes}
+	maxSubsets := 0
+	if conf.ConfigEntries.Enabled() {
+		conf.ConfigEntries.Normalize()
+		maxSubsets = conf.ConfigEntries.MaxSubsets
+	}
+	// the services depending on each service of the graph, which intentions are from
+	var downstreams map[string][]string
+	err = streamCatalog(conf, seed, Handler{
+		GraphService: func(svc *catalog.GraphService) error {
+			if conf.Intentions.Enabled() {
+				if downstreams == nil {
+					downstreams = make(map[string][]string)
+				}
+				for _, upstream := range svc.Upstreams {
+					downstreams[upstream] = append(downstreams[upstream], svc.Name)
+				}
+			}
+			return h.handleGraphService(svc)
+		},
+		Node: func(node *catalog.Node) error {
+			if writes != nil {
+				token := writes.NodeToken(node.Datacenter, node.Partition, node.Name)
+				node.Token = token.SecretID
+				node.ExpectDenied = token.Denied
+			}
+
+			if collectServices {
+				for _, service := range node.Services {
+					// proxies and gateways aren't the subject of intentions or config entries
+					if len(service.Instances) == 0 || service.Instances[0].Kind != "" {
+						continue
+					}
+					svc := intentions.Service{Name: service.Name, Namespace: service.Instances[0].Namespace, Partition: node.Partition}
+					i, found := seen[svc]
+					if !found {
+						i = len(services)
+						seen[svc] = i
+						services = append(services, configentries.Service{
+							Name:      svc.Name,
+							Namespace: svc.Namespace,
+							Partition: svc.Partition,
+							SubsetKey: subsetKey(service.Instances[0]),
+						})
+						queryServices = append(queryServices, preparedqueries.Service{
+							Name:       svc.Name,
+							Namespace:  svc.Namespace,
+							Partition:  svc.Partition,
+							Datacenter: node.Datacenter,
+							Tags:       service.Instances[0].Tags,
+							NodeMeta:   node.Meta,
+						})
+					}
+					addSubsetValues(&services[i], service.Instances, maxSubsets)
+				}
+			}
+
+			// the node won't exist when registering it is expected to be denied
+			if conf.Sessions.Enabled() && !node.ExpectDenied {
+				if i := sessionSample.add(); i == len(sessionNodes) {
+					sessionNodes = append(sessionNodes, sessionNode(node))
+				} else if i >= 0 {
+					sessionNodes[i] = sessionNode(node)
+				}
+			}
+			if conf.Events.Enabled() && !node.ExpectDenied {
+				if i := eventSample.add(); i == len(eventNodes) {
+					eventNodes = append(eventNodes, eventNode(node))
+				} else if i >= 0 {
+					eventNodes[i] = eventNode(node)
+				}
+			}
+			return h.handleNode(node)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// the effective protocol of each service determines whether its intentions may be L7
+	protocols := configentries.NewProtocols()
+	if conf.ConfigEntries.Enabled() {
+		configConf, err := conf.ConfigEntries.ToGeneratorConfig(generators.NewRand(seed, randStreamConfig))
+		if err != nil {
+			return fmt.Errorf("Failed to setup config entries config: %w", err)
+		}
+		configConf.Services = services
+
+		err = configentries.Stream(configConf, func(entry *configentries.Entry) error {
+			protocols.Add(entry)
+			return h.handleConfigEntry(entry)
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to generate config entries: %w", err)
+		}
+	}
+
+	if conf.Intentions.Enabled() {
+		intentionsConf, err := conf.Intentions.ToGeneratorConfig(generators.NewRand(seed, randStreamIntentions))
+		if err != nil {
+			return fmt.Errorf("Failed to setup intentions config: %w", err)
+		}
+		intentionsConf.Services = make([]intentions.Service, 0, len(services))
+		for _, svc := range services {
+			intentionsConf.Services = append(intentionsConf.Services, intentions.Service{
+				Name:      svc.Name,
+				Namespace: svc.Namespace,
+				Partition: svc.Partition,
+				Protocol:  protocols.Protocol(svc.Partition, svc.Namespace, svc.Name),
+			})
+		}
+		intentionsConf.Downstreams = downstreams
+
+		if err := intentions.Stream(intentionsConf, h.handleIntentions); err != nil {
+			return fmt.Errorf("Failed to generate intentions: %w", err)
+		}
+	}
+
+	if conf.PreparedQueries.Enabled() {
+		queriesConf, err := conf.PreparedQueries.ToGeneratorConfig(generators.NewRand(seed, randStreamQueries))
+		if err != nil {
+			return fmt.Errorf("Failed to setup prepared queries config: %w", err)
+		}
+		queriesConf.Services = queryServices
+		for _, dc := range conf.Datacenters {
+			queriesConf.Datacenters = append(queriesConf.Datacenters, dc.Name)
+		}
+
+		if err := preparedqueries.Stream(queriesConf, h.handlePreparedQuery); err != nil {
+			return fmt.Errorf("Failed to generate prepared queries: %w", err)
+		}
+	}
+
+	if conf.Sessions.Enabled() {
+		sessionsConf, err := conf.Sessions.ToGeneratorConfig(generators.NewRand(seed, randStreamSessions))
+		if err != nil {
+			return fmt.Errorf("Failed to setup sessions config: %w", err)
+		}
+		sessionsConf.Nodes = sessionNodes
+
+		if err := sessions.Stream(sessionsConf, h.handleSession); err != nil {
+			return fmt.Errorf("Failed to generate sessions: %w", err)
+		}
+	}
+
+	if !conf.Events.Enabled() {
+		return nil
+	}
+
+	eventsConf, err := conf.Events.ToGeneratorConfig(generators.NewRand(seed, randStreamEvents))
+	if err != nil {
+		return fmt.Errorf("Failed to setup events config: %w", err)
+	}
+	eventsConf.Nodes = eventNodes
+
+	if err := events.Stream(eventsConf, h.handleEvent); err != nil {
+		return fmt.Errorf("Failed to generate events: %w", err)
+	}
+	return nil
 }
 
-func GenerateAll(conf Config) (*Data, error) {
-	kvConf, err := conf.KV.ToGeneratorConfig()
+// eventNode returns the node which events may be filtered to along with its services
+// and all the tags of their instances.
+func eventNode(node *catalog.Node) events.Node {
+	en := events.Node{
+		Name:       node.Name,
+		Datacenter: node.Datacenter,
+	}
+
+	for _, service := range node.Services {
+		svc := events.Service{Name: service.Name}
+		seen := make(map[string]struct{})
+		for _, instance := range service.Instances {
+			for _, tag := range instance.Tags {
+				if _, found := seen[tag]; !found {
+					seen[tag] = struct{}{}
+					svc.Tags = append(svc.Tags, tag)
+				}
+			}
+		}
+		en.Services = append(en.Services, svc)
+	}
+	return en
+}
+
+// sessionNode returns the node which sessions may be attached to along with its
+// passing checks as sessions can't be created with any others.
+func sessionNode(node *catalog.Node) sessions.Node {
+	sn := sessions.Node{
+		Name:       node.Name,
+		Datacenter: node.Datacenter,
+		Partition:  node.Partition,
+	}
+
+	for _, check := range node.Checks {
+		if check.Status == catalog.CheckStatusPassing {
+			sn.NodeChecks = append(sn.NodeChecks, check.CheckID)
+		}
+	}
+
+	for _, service := range node.Services {
+		for _, instance := range service.Instances {
+			for _, check := range instance.Checks {
+				if check.Status == catalog.CheckStatusPassing {
+					sn.ServiceChecks = append(sn.ServiceChecks, sessions.ServiceCheck{ID: check.CheckID, Namespace: instance.Namespace})
+				}
+			}
+		}
+	}
+	return sn
+}
+
+// streamACL generates the ACL data, including the tokens which the KV entries and
+// nodes are to be written with, from the KV prefixes and services that get generated.
+func streamACL(conf Config, seed int64, h Handler) (*acl.WriteTokens, error) {
+	aclConf, err := conf.ACL.ToGeneratorConfig(generators.NewRand(seed, randStreamACL))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to setup ACL config: %w", err)
+	}
+	writes := acl.NewWriteTokens(generators.NewRand(seed, randStreamACLWrite), aclConf.DeniedWriteFraction, aclConf.MaxWriteTokens)
+	aclConf.WriteTokens = writes
+
+	prefixes := make(map[string]struct{})
+	err = streamKV(conf, seed, func(key string, value kv.Value) error {
+		prefix := kvPrefix(key)
+		prefixes[prefix] = struct{}{}
+		return writes.AddKV(value.Partition, value.Namespace, prefix)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[string]struct{})
+	err = streamCatalog(conf, seed, Handler{
+		Node: func(node *catalog.Node) error {
+			namespaces := make(map[string]string, len(node.Services))
+			for _, service := range node.Services {
+				if len(service.Instances) == 0 {
+					continue
+				}
+				namespaces[service.Name] = service.Instances[0].Namespace
+
+				// proxies and gateways aren't what policies would typically grant access to
+				if service.Instances[0].Kind == "" {
+					services[service.Name] = struct{}{}
+				}
+			}
+			return writes.AddNode(node.Datacenter, node.Partition, node.Name, namespaces)
+		},
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Failed to setup catalog config: %w", err)
+		return nil, err
 	}
 
-	kvData, err := kv.Generate(kvConf)
+	aclConf.KeyPrefixes = sortedKeys(prefixes)
+	aclConf.ServiceNames = sortedKeys(services)
+
+	if err := acl.Stream(aclConf, h.handleACLPolicy, h.handleACLRole, h.handleACLToken); err != nil {
+		return nil, fmt.Errorf("Failed to generate ACL data: %w", err)
+	}
+	return writes, nil
+}
+
+func streamKV(conf Config, seed int64, fn func(string, kv.Value) error) error {
+	kvConf, err := conf.KV.ToGeneratorConfig(generators.NewRand(seed, randStreamKV))
 	if err != nil {
-		return nil, fmt.Errorf("Failed to generate KV data: %w", err)
+		return fmt.Errorf("Failed to setup KV config: %w", err)
 	}
+	kvConf.DatacenterGen = datacenterGenerator(generators.NewRand(seed, randStreamKV+randStreamDatacenters), conf.Datacenters)
+	kvConf.PartitionGen = conf.Partitions.generator(generators.NewRand(seed, randStreamKV+randStreamPartitions))
+	kvConf.NamespaceGen = conf.Namespaces.generator(generators.NewRand(seed, randStreamKV+randStreamNamespaces))
+
+	if err := kv.Stream(kvConf, fn); err != nil {
+		return fmt.Errorf("Failed to generate KV data: %w", err)
+	}
+	return nil
+}
 
-	catalogConf, err := conf.Catalog.ToGeneratorConfig()
+func streamCatalog(conf Config, seed int64, h Handler) error {
+	catalogConf, err := conf.Catalog.ToGeneratorConfig(generators.NewRand(seed, randStreamCatalog))
 	if err != nil {
-		return nil, fmt.Errorf("Failed to setup catalog config: %w", err)
+		return fmt.Errorf("Failed to setup catalog config: %w", err)
 	}
+	catalogConf.DatacenterGen = datacenterGenerator(generators.NewRand(seed, randStreamCatalog+randStreamDatacenters), conf.Datacenters)
+	catalogConf.PartitionGen = conf.Partitions.generator(generators.NewRand(seed, randStreamCatalog+randStreamPartitions))
+	catalogConf.NamespaceGen = conf.Namespaces.generator(generators.NewRand(seed, randStreamCatalog+randStreamNamespaces))
+	catalogConf.CoordinateRand = generators.NewRand(seed, randStreamCoordinates)
 
-	catalogData, err := catalog.Generate(catalogConf)
+	// the graph is generated up front so that it can be handled before any nodes
+	catalogConf.Graph, err = catalog.GenerateGraph(catalogConf)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to generate catalog data: %w", err)
+		return fmt.Errorf("Failed to generate service graph: %w", err)
 	}
 
-	return &Data{
-		KV:      kvData,
-		Catalog: catalogData,
-	}, nil
+	for _, svc := range catalogConf.Graph {
+		if err := h.handleGraphService(svc); err != nil {
+			return err
+		}
+	}
+
+	if err := catalog.Stream(catalogConf, h.handleNode); err != nil {
+		return fmt.Errorf("Failed to generate catalog data: %w", err)
+	}
+	return nil
+}
+
+// subsetKey returns the meta key which resolver subsets of the instance's service select
+// on. This is the first in sorted order so that it doesn't depend on map iteration.
+func subsetKey(instance *catalog.ServiceInstance) string {
+	key := ""
+	for k := range instance.Meta {
+		if key == "" || k < key {
+			key = k
+		}
+	}
+	return key
+}
+
+// addSubsetValues adds the distinct values of the service's subset key from the
+// instances until it has max of them.
+func addSubsetValues(svc *configentries.Service, instances []*catalog.ServiceInstance, max int) {
+	if svc.SubsetKey == "" {
+		return
+	}
+
+	for _, instance := range instances {
+		if len(svc.SubsetValues) >= max {
+			return
+		}
+
+		value, found := instance.Meta[svc.SubsetKey]
+		if !found {
+			continue
+		}
+
+		duplicate := false
+		for _, existing := range svc.SubsetValues {
+			if existing == value {
+				duplicate = true
+			}
+		}
+		if !duplicate {
+			svc.SubsetValues = append(svc.SubsetValues, value)
+		}
+	}
+}
+
+// kvPrefix returns the prefix of a key which ACL rules may refer to. This is everything
+// up to the last '/' or otherwise the first word of the generated names.
+func kvPrefix(key string) string {
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		return key[:i+1]
+	}
+	if i := strings.Index(key, "-"); i >= 0 {
+		return key[:i+1]
+	}
+	return key
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func ParseConfig(path string) (Config, error) {
@@ -62,7 +657,13 @@ func ParseConfig(path string) (Config, error) {
 
 func DefaultConfig() Config {
 	return Config{
-		KV:      kv.DefaultUserConfig(),
-		Catalog: catalog.DefaultUserConfig(),
+		KV:              kv.DefaultUserConfig(),
+		Catalog:         catalog.DefaultUserConfig(),
+		ACL:             acl.DefaultUserConfig(),
+		ConfigEntries:   configentries.DefaultUserConfig(),
+		Intentions:      intentions.DefaultUserConfig(),
+		PreparedQueries: preparedqueries.DefaultUserConfig(),
+		Sessions:        sessions.DefaultUserConfig(),
+		Events:          events.DefaultUserConfig(),
 	}
 }
@@ -0,0 +1,199 @@
+package generate
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/mkeeler/consul-data/generate/catalog"
+	"github.com/mkeeler/consul-data/generate/configentries"
+)
+
+func TestGenerateAll_ResolverSubsets(t *testing.T) {
+	conf := DefaultConfig()
+	conf.Catalog.NumNodes = 16
+	conf.ConfigEntries.ResolverFraction = 1
+
+	data, err := GenerateAll(conf, 1)
+	if err != nil {
+		t.Fatalf("Failed to generate data: %v", err)
+	}
+
+	resolvers := 0
+	for _, entry := range data.ConfigEntries {
+		if entry.Kind != configentries.KindServiceResolver {
+			continue
+		}
+		resolvers++
+
+		if len(entry.Subsets) == 0 {
+			t.Errorf("resolver %s has no subsets", entry.Name)
+		}
+		for name, filter := range entry.Subsets {
+			if !strings.HasPrefix(filter, `Service.Meta["`) || strings.HasSuffix(filter, `== ""`) {
+				t.Errorf("resolver %s subset %s has an invalid filter: %s", entry.Name, name, filter)
+			}
+		}
+	}
+
+	if resolvers == 0 {
+		t.Fatalf("no resolvers were generated")
+	}
+
+	if err := configentries.Validate(data.ConfigEntries); err != nil {
+		t.Fatalf("generated config entries are invalid: %v", err)
+	}
+}
+
+func TestSubsetKey(t *testing.T) {
+	cases := []struct {
+		meta map[string]string
+		key  string
+	}{
+		{meta: nil, key: ""},
+		{meta: map[string]string{"one": "1"}, key: "one"},
+		{meta: map[string]string{"sharp-cobra": "1", "able-ant": "2", "zesty": "3"}, key: "able-ant"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			if key := subsetKey(&catalog.ServiceInstance{Meta: tc.meta}); key != tc.key {
+				t.Fatalf("expected key %q but got %q", tc.key, key)
+			}
+		})
+	}
+}
+
+func TestGenerateAll_TenancyDoesNotChangeData(t *testing.T) {
+	conf := DefaultConfig()
+	conf.KV.NumEntries = 64
+	conf.Catalog.NumNodes = 16
+
+	base, err := GenerateAll(conf, 1)
+	if err != nil {
+		t.Fatalf("Failed to generate data: %v", err)
+	}
+
+	conf.Datacenters = []Datacenter{{Name: "dc1"}, {Name: "dc2", Weight: 3}}
+	conf.Partitions = Tenancy{Names: []string{"default", "part1"}}
+	conf.Namespaces = Tenancy{Names: []string{"default", "ns1", "ns2"}}
+
+	spread, err := GenerateAll(conf, 1)
+	if err != nil {
+		t.Fatalf("Failed to generate data: %v", err)
+	}
+
+	for key := range base.KV {
+		if _, found := spread.KV[key]; !found {
+			t.Errorf("KV key %s is missing once spread across tenants", key)
+		}
+	}
+
+	if len(base.Catalog) != len(spread.Catalog) {
+		t.Fatalf("expected %d nodes but got %d", len(base.Catalog), len(spread.Catalog))
+	}
+	for i, node := range base.Catalog {
+		if spread.Catalog[i].Name != node.Name {
+			t.Errorf("node %d is named %s instead of %s once spread across tenants", i, spread.Catalog[i].Name, node.Name)
+		}
+	}
+}
+
+func TestReservoir(t *testing.T) {
+	r := reservoir{rand: rand.New(rand.NewSource(1)), size: 3}
+
+	for i := 0; i < r.size; i++ {
+		if j := r.add(); j != i {
+			t.Fatalf("expected item %d to be appended but got index %d", i, j)
+		}
+	}
+
+	replaced := 0
+	for i := r.size; i < 1000; i++ {
+		j := r.add()
+		if j < -1 || j >= r.size {
+			t.Fatalf("item %d got index %d outside of the sample", i, j)
+		}
+		if j >= 0 {
+			replaced++
+		}
+	}
+
+	// each item is kept with a probability of size/seen
+	if replaced == 0 || replaced > 100 {
+		t.Fatalf("unexpected number of sampled items: %d", replaced)
+	}
+}
+
+func TestGenerateAll_IntentionsFollowGraph(t *testing.T) {
+	conf := DefaultConfig()
+	conf.Catalog.NumNodes = 32
+	conf.Catalog.ServiceGraph.NumServices = 20
+	conf.Intentions.Density = 0.1
+	conf.Intentions.WildcardFraction = 0
+
+	data, err := GenerateAll(conf, 1)
+	if err != nil {
+		t.Fatalf("Failed to generate data: %v", err)
+	}
+
+	downstreams := make(map[string]map[string]struct{})
+	for _, svc := range data.ServiceGraph {
+		for _, upstream := range svc.Upstreams {
+			if downstreams[upstream] == nil {
+				downstreams[upstream] = make(map[string]struct{})
+			}
+			downstreams[upstream][svc.Name] = struct{}{}
+		}
+	}
+
+	if len(data.Intentions) == 0 {
+		t.Fatalf("no intentions were generated")
+	}
+	for _, intentions := range data.Intentions {
+		for _, source := range intentions.Sources {
+			if _, found := downstreams[intentions.Name][source.Name]; !found {
+				t.Errorf("%s has an intention from %s which doesn't depend on it", intentions.Name, source.Name)
+			}
+		}
+	}
+}
+
+func TestGenerateAll_L7IntentionsUseHTTP(t *testing.T) {
+	conf := DefaultConfig()
+	conf.Catalog.NumNodes = 32
+	conf.ConfigEntries.ServiceDefaultsFraction = 0.5
+	conf.Intentions.Density = 0.2
+	conf.Intentions.L7Fraction = 1
+
+	data, err := GenerateAll(conf, 1)
+	if err != nil {
+		t.Fatalf("Failed to generate data: %v", err)
+	}
+
+	protocols := configentries.NewProtocols()
+	for _, entry := range data.ConfigEntries {
+		protocols.Add(entry)
+	}
+
+	l4, l7 := 0, 0
+	for _, intentions := range data.Intentions {
+		protocol := protocols.Protocol(intentions.Partition, intentions.Namespace, intentions.Name)
+		for _, source := range intentions.Sources {
+			if len(source.Permissions) == 0 {
+				l4++
+				continue
+			}
+			l7++
+			if protocol != "http" && protocol != "http2" && protocol != "grpc" {
+				t.Errorf("%s uses protocol %s but has L7 intentions", intentions.Name, protocol)
+			}
+		}
+	}
+
+	// services without HTTP based service-defaults still get L4 intentions
+	if l4 == 0 || l7 == 0 {
+		t.Fatalf("expected both L4 and L7 intentions but got %d and %d", l4, l7)
+	}
+}
@@ -6,11 +6,15 @@ import (
 	"math/rand"
 )
 
-func RandomB64Generator(minSize int, maxSize int) StringGenerator {
+func RandomB64Generator(rng *rand.Rand, minSize int, maxSize int) StringGenerator {
 	return func() (string, error) {
-		size := minSize + rand.Intn(maxSize-minSize)
+		size := minSize
+		if minSize < maxSize {
+			size += rng.Intn(maxSize - minSize)
+		}
+
 		raw := make([]byte, size)
-		_, err := rand.Read(raw)
+		_, err := rng.Read(raw)
 
 		// Technically math/rand.Read is guaranteed to always return a nil error but
 		// we are checking anyways just in case we switch over to something else like
@@ -0,0 +1,9 @@
+package generators
+
+// EmptyGenerator always generates an empty string. This is useful for optional
+// values which should be omitted.
+func EmptyGenerator() StringGenerator {
+	return func() (string, error) {
+		return "", nil
+	}
+}
@@ -1,7 +1,23 @@
 package generators
 
-import "net"
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"net"
+)
 
 type StringGenerator func() (string, error)
 
 type IPGenerator func() (net.IP, error)
+
+// NewRand returns a new pseudo-random number generator whose stream is derived from
+// both the seed and the name. This allows each subsystem to have its own independent
+// stream of random data so that changes to how one generates data do not affect the
+// data generated by the others when using the same seed.
+func NewRand(seed int64, name string) *rand.Rand {
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, seed)
+	h.Write([]byte(name))
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
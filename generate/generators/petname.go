@@ -2,12 +2,14 @@ package generators
 
 import (
 	"fmt"
+	"math/rand"
 
 	petname "github.com/dustinkirkland/golang-petname"
 )
 
-func PetNameGenerator(prefix string, words int, separator string) StringGenerator {
+func PetNameGenerator(rng *rand.Rand, prefix string, words int, separator string) StringGenerator {
+	gen := petname.New(rng)
 	return func() (string, error) {
-		return fmt.Sprintf("%s%s", prefix, petname.Generate(words, separator)), nil
+		return fmt.Sprintf("%s%s", prefix, gen.Generate(words, separator)), nil
 	}
 }
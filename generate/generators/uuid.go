@@ -6,16 +6,8 @@ import (
 	uuid "github.com/hashicorp/go-uuid"
 )
 
-type randReader struct{}
-
-func (r *randReader) Read(p []byte) (n int, err error) {
-	return rand.Read(p)
-}
-
-var (
-	uuidRand = &randReader{}
-)
-
-func UUIDGen() (string, error) {
-	return uuid.GenerateUUIDWithReader(uuidRand)
+func UUIDGenerator(rng *rand.Rand) StringGenerator {
+	return func() (string, error) {
+		return uuid.GenerateUUIDWithReader(rng)
+	}
 }
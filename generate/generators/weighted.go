@@ -0,0 +1,44 @@
+package generators
+
+import (
+	"math/rand"
+)
+
+// WeightedChoice is a value which is chosen with a probability of its weight divided by
+// the sum of the weights of all the choices.
+type WeightedChoice struct {
+	Value  string
+	Weight int
+}
+
+// WeightedGenerator randomly picks one of the choices according to their weights.
+// Choices without a positive weight are never picked. No random data is consumed when
+// there is only a single choice to pick from.
+func WeightedGenerator(rng *rand.Rand, choices []WeightedChoice) StringGenerator {
+	var picks []WeightedChoice
+	total := 0
+	for _, choice := range choices {
+		if choice.Weight > 0 {
+			picks = append(picks, choice)
+			total += choice.Weight
+		}
+	}
+
+	return func() (string, error) {
+		switch len(picks) {
+		case 0:
+			return "", nil
+		case 1:
+			return picks[0].Value, nil
+		}
+
+		n := rng.Intn(total)
+		for _, choice := range picks {
+			if n < choice.Weight {
+				return choice.Value, nil
+			}
+			n -= choice.Weight
+		}
+		return picks[len(picks)-1].Value, nil
+	}
+}
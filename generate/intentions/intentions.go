@@ -0,0 +1,461 @@
+package intentions
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/mkeeler/consul-data/generate/generators"
+)
+
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+
+	// Wildcard matches any service or namespace
+	Wildcard = "*"
+)
+
+var (
+	// Intentions are only generated when requested as they restrict which services
+	// may communicate.
+	DefaultDensity                  = 0.0
+	DefaultMaxSourcesPerDestination = 50
+	DefaultWildcardFraction         = 0.2
+	DefaultDenyFraction             = 0.2
+	DefaultL7Fraction               = 0.0
+	DefaultMinPermissions           = 1
+	DefaultMaxPermissions           = 4
+	DefaultDefaultAction            = ""
+)
+
+// httpMethods are what L7 permissions may be restricted to
+var httpMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "PATCH"}
+
+// l7Protocols are the protocols of the destinations which Consul allows intentions with
+// L7 permissions for
+var l7Protocols = []string{"http", "http2", "grpc"}
+
+// IsL7Protocol returns whether intentions for a destination using the protocol may
+// have L7 permissions.
+func IsL7Protocol(protocol string) bool {
+	for _, p := range l7Protocols {
+		if protocol == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Service is a service which intentions may be generated between
+type Service struct {
+	Name      string
+	Namespace string
+	Partition string
+	// Protocol is the effective protocol of the service. Intentions only have L7
+	// permissions when the destination uses an HTTP based protocol.
+	Protocol string
+}
+
+// Intentions are all the intentions of a single destination service. They are pushed
+// as a service-intentions config entry.
+type Intentions struct {
+	Name      string
+	Namespace string `json:",omitempty"`
+	Partition string `json:",omitempty"`
+	Sources   []*Source
+}
+
+// Source is an intention from a source service. It either has an action for L4
+// intentions or permissions for L7 ones.
+type Source struct {
+	Name        string
+	Namespace   string        `json:",omitempty"`
+	Action      string        `json:",omitempty"`
+	Permissions []*Permission `json:",omitempty"`
+}
+
+// Permission is an L7 permission matching HTTP requests
+type Permission struct {
+	Action     string
+	PathExact  string    `json:",omitempty"`
+	PathPrefix string    `json:",omitempty"`
+	PathRegex  string    `json:",omitempty"`
+	Methods    []string  `json:",omitempty"`
+	Headers    []*Header `json:",omitempty"`
+}
+
+// Header is an L7 permission's match of a single HTTP header
+type Header struct {
+	Name    string
+	Present bool   `json:",omitempty"`
+	Exact   string `json:",omitempty"`
+	Prefix  string `json:",omitempty"`
+	Regex   string `json:",omitempty"`
+	Invert  bool   `json:",omitempty"`
+}
+
+// Config is all the configuration necessary for creating intentions
+type Config struct {
+	// Density is the fraction of the other services in its partition which each
+	// destination has intentions from when there is no service graph.
+	Density                  float64
+	MaxSourcesPerDestination int
+	// WildcardFraction is the fraction of destinations with an additional intention
+	// from all services, which the intentions from exact services take precedence over.
+	WildcardFraction float64
+	DenyFraction     float64
+	// L7Fraction is the fraction of intentions to destinations using an HTTP based
+	// protocol which have L7 permissions instead of an action
+	L7Fraction     float64
+	MinPermissions int
+	MaxPermissions int
+	// DefaultAction is the action of an intention between all services in each
+	// namespace, which has the lowest precedence of all. None are generated when empty.
+	DefaultAction string
+	WordGen       generators.StringGenerator
+
+	// Services are what the intentions are generated between
+	Services []Service
+	// Downstreams maps the name of each service in the service graph to the names of
+	// the services depending on it. When set each destination has intentions from its
+	// downstreams instead of from services picked at random.
+	Downstreams map[string][]string
+
+	// Rand is the source of randomness for generating intentions and any default
+	// generators. When nil a new source seeded with the current time is used.
+	Rand *rand.Rand
+}
+
+func DefaultWordGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, "", 1, "-")
+}
+
+// DefaultConfig returns a config with all the defaults filled in.
+func DefaultConfig(rng *rand.Rand) Config {
+	return Config{
+		Density:                  DefaultDensity,
+		MaxSourcesPerDestination: DefaultMaxSourcesPerDestination,
+		WildcardFraction:         DefaultWildcardFraction,
+		DenyFraction:             DefaultDenyFraction,
+		L7Fraction:               DefaultL7Fraction,
+		MinPermissions:           DefaultMinPermissions,
+		MaxPermissions:           DefaultMaxPermissions,
+		DefaultAction:            DefaultDefaultAction,
+		WordGen:                  DefaultWordGenerator(rng),
+		Rand:                     rng,
+	}
+}
+
+func (c *Config) normalize() {
+	if c.Rand == nil {
+		c.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	if c.WordGen == nil {
+		c.WordGen = DefaultWordGenerator(c.Rand)
+	}
+
+	if c.MaxSourcesPerDestination < 0 {
+		c.MaxSourcesPerDestination = 0
+	}
+
+	if c.MinPermissions < 1 {
+		c.MinPermissions = 1
+	}
+
+	if c.MaxPermissions < c.MinPermissions {
+		c.MaxPermissions = c.MinPermissions
+	}
+}
+
+// chance returns true for the given fraction of calls without consuming any random data
+// when it can't
+func chance(rng *rand.Rand, fraction float64) bool {
+	return fraction > 0 && rng.Float64() < fraction
+}
+
+func action(conf Config) string {
+	if chance(conf.Rand, conf.DenyFraction) {
+		return ActionDeny
+	}
+	return ActionAllow
+}
+
+func genHeader(conf Config) (*Header, error) {
+	word, err := conf.WordGen()
+	if err != nil {
+		return nil, err
+	}
+
+	header := Header{Name: "x-" + word}
+	switch conf.Rand.Intn(4) {
+	case 0:
+		header.Present = true
+	case 1:
+		header.Exact = word
+	case 2:
+		header.Prefix = word[:1]
+	case 3:
+		header.Regex = "^" + word + "-[0-9]+$"
+	}
+	header.Invert = chance(conf.Rand, 0.1)
+	return &header, nil
+}
+
+func genPermission(conf Config) (*Permission, error) {
+	word, err := conf.WordGen()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate path: %w", err)
+	}
+
+	permission := Permission{Action: action(conf)}
+	switch conf.Rand.Intn(3) {
+	case 0:
+		permission.PathExact = "/" + word
+	case 1:
+		permission.PathPrefix = "/" + word + "/"
+	case 2:
+		permission.PathRegex = "/" + word + "/[0-9]+"
+	}
+
+	// half of the permissions are restricted to a few methods
+	if conf.Rand.Intn(2) == 0 {
+		for _, i := range conf.Rand.Perm(len(httpMethods))[:conf.Rand.Intn(3)+1] {
+			permission.Methods = append(permission.Methods, httpMethods[i])
+		}
+	}
+
+	if conf.Rand.Intn(4) == 0 {
+		header, err := genHeader(conf)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate header: %w", err)
+		}
+		permission.Headers = append(permission.Headers, header)
+	}
+	return &permission, nil
+}
+
+func genSource(conf Config, dest Service, svc Service) (*Source, error) {
+	source := Source{Name: svc.Name, Namespace: svc.Namespace}
+	if !IsL7Protocol(dest.Protocol) || !chance(conf.Rand, conf.L7Fraction) {
+		source.Action = action(conf)
+		return &source, nil
+	}
+
+	numPermissions := conf.MinPermissions
+	if conf.MaxPermissions > conf.MinPermissions {
+		numPermissions += conf.Rand.Intn(conf.MaxPermissions - conf.MinPermissions)
+	}
+
+	for i := 0; i < numPermissions; i++ {
+		permission, err := genPermission(conf)
+		if err != nil {
+			return nil, err
+		}
+		source.Permissions = append(source.Permissions, permission)
+	}
+	return &source, nil
+}
+
+// numSources returns how many of the candidates a destination has intentions from.
+// The fractional part of the density's share is used as the chance of one more.
+func numSources(conf Config, candidates int) int {
+	share := conf.Density * float64(candidates)
+	n := int(share)
+	if chance(conf.Rand, share-float64(n)) {
+		n += 1
+	}
+
+	if conf.MaxSourcesPerDestination > 0 && n > conf.MaxSourcesPerDestination {
+		n = conf.MaxSourcesPerDestination
+	}
+	if n > candidates {
+		n = candidates
+	}
+	return n
+}
+
+// pickSources returns the candidates which a destination has intentions from. These are
+// its downstreams when there is a service graph or otherwise picked at random.
+func pickSources(conf Config, dest Service, candidates []Service) []Service {
+	var sources []Service
+	if conf.Downstreams != nil {
+		downstreams := make(map[string]struct{})
+		for _, name := range conf.Downstreams[dest.Name] {
+			downstreams[name] = struct{}{}
+		}
+
+		for _, svc := range candidates {
+			if conf.MaxSourcesPerDestination > 0 && len(sources) >= conf.MaxSourcesPerDestination {
+				break
+			}
+			if _, found := downstreams[svc.Name]; found {
+				sources = append(sources, svc)
+			}
+		}
+		return sources
+	}
+
+	n := numSources(conf, len(candidates))
+	picked := make(map[int]struct{}, n)
+	for len(picked) < n {
+		i := conf.Rand.Intn(len(candidates))
+		if _, found := picked[i]; found {
+			continue
+		}
+		picked[i] = struct{}{}
+		sources = append(sources, candidates[i])
+	}
+	return sources
+}
+
+func genIntentions(conf Config, dest Service, candidates []Service) (*Intentions, error) {
+	intentions := Intentions{
+		Name:      dest.Name,
+		Namespace: dest.Namespace,
+		Partition: dest.Partition,
+	}
+
+	for _, svc := range pickSources(conf, dest, candidates) {
+		source, err := genSource(conf, dest, svc)
+		if err != nil {
+			return nil, err
+		}
+		intentions.Sources = append(intentions.Sources, source)
+	}
+
+	if chance(conf.Rand, conf.WildcardFraction) {
+		intentions.Sources = append(intentions.Sources, &Source{
+			Name:      Wildcard,
+			Namespace: dest.Namespace,
+			Action:    action(conf),
+		})
+	}
+
+	if len(intentions.Sources) == 0 {
+		return nil, nil
+	}
+	return &intentions, nil
+}
+
+// scopedName identifies a service by its partition, namespace and name
+type scopedName struct {
+	partition string
+	namespace string
+	name      string
+}
+
+// protocols are the protocols of services
+type protocols map[scopedName]string
+
+func newProtocols(services []Service) protocols {
+	p := make(protocols, len(services))
+	for _, svc := range services {
+		p[scopedName{partition: svc.Partition, namespace: svc.Namespace, name: svc.Name}] = svc.Protocol
+	}
+	return p
+}
+
+func (p protocols) validate(intentions *Intentions) error {
+	protocol := p[scopedName{partition: intentions.Partition, namespace: intentions.Namespace, name: intentions.Name}]
+	if IsL7Protocol(protocol) {
+		return nil
+	}
+
+	for _, source := range intentions.Sources {
+		if len(source.Permissions) > 0 {
+			return fmt.Errorf("Invalid intention from %s to %s: destination uses protocol %s which doesn't allow L7 permissions", source.Name, intentions.Name, orTCP(protocol))
+		}
+	}
+	return nil
+}
+
+func orTCP(protocol string) string {
+	if protocol == "" {
+		return "tcp"
+	}
+	return protocol
+}
+
+// Validate checks that only the intentions of destinations using an HTTP based protocol
+// have L7 permissions as Consul rejects them otherwise. The protocols of destinations
+// are taken from the services, with those which aren't found using tcp.
+func Validate(intentions []*Intentions, services []Service) error {
+	p := newProtocols(services)
+	for _, i := range intentions {
+		if err := p.validate(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stream will generate the intentions of each service invoking the function with
+// those of each destination as soon as they are generated. Destinations without any
+// intentions are skipped.
+func Stream(conf Config, fn func(*Intentions) error) error {
+	conf.normalize()
+
+	// sources are only picked from the same partition as the destination
+	partitions := make(map[string][]Service)
+	for _, svc := range conf.Services {
+		partitions[svc.Partition] = append(partitions[svc.Partition], svc)
+	}
+
+	protocols := newProtocols(conf.Services)
+	namespaces := make(map[Service]struct{})
+	candidates := make([]Service, 0, len(conf.Services))
+	for _, dest := range conf.Services {
+		namespaces[Service{Namespace: dest.Namespace, Partition: dest.Partition}] = struct{}{}
+
+		candidates = candidates[:0]
+		for _, svc := range partitions[dest.Partition] {
+			if svc != dest {
+				candidates = append(candidates, svc)
+			}
+		}
+
+		intentions, err := genIntentions(conf, dest, candidates)
+		if err != nil {
+			return fmt.Errorf("Failed to generate intentions for %s: %w", dest.Name, err)
+		}
+		if intentions == nil {
+			continue
+		}
+		if err := protocols.validate(intentions); err != nil {
+			return err
+		}
+		if err := fn(intentions); err != nil {
+			return err
+		}
+	}
+
+	if conf.DefaultAction == "" {
+		return nil
+	}
+
+	// the default for each namespace in the order they were first seen
+	for _, dest := range conf.Services {
+		scope := Service{Namespace: dest.Namespace, Partition: dest.Partition}
+		if _, found := namespaces[scope]; !found {
+			continue
+		}
+		delete(namespaces, scope)
+
+		err := fn(&Intentions{
+			Name:      Wildcard,
+			Namespace: dest.Namespace,
+			Partition: dest.Partition,
+			Sources: []*Source{{
+				Name:      Wildcard,
+				Namespace: dest.Namespace,
+				Action:    conf.DefaultAction,
+			}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
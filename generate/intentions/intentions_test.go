@@ -0,0 +1,257 @@
+package intentions
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func services(names ...string) []Service {
+	var svcs []Service
+	for _, name := range names {
+		svcs = append(svcs, Service{Name: name})
+	}
+	return svcs
+}
+
+// generate returns the sources of each destination's intentions by name
+func generate(t *testing.T, conf Config) map[string][]*Source {
+	t.Helper()
+
+	conf.Rand = rand.New(rand.NewSource(1))
+	sources := make(map[string][]*Source)
+	err := Stream(conf, func(intentions *Intentions) error {
+		sources[intentions.Name] = intentions.Sources
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to generate intentions: %v", err)
+	}
+	return sources
+}
+
+func TestStream_Downstreams(t *testing.T) {
+	cases := map[string]struct {
+		downstreams map[string][]string
+		maxSources  int
+		expected    map[string][]string
+	}{
+		"graph": {
+			downstreams: map[string][]string{
+				"db":   {"api", "auth"},
+				"auth": {"api"},
+				"api":  {"web"},
+			},
+			expected: map[string][]string{
+				"db":   {"api", "auth"},
+				"auth": {"api"},
+				"api":  {"web"},
+			},
+		},
+		"no downstreams": {
+			downstreams: map[string][]string{},
+			expected:    map[string][]string{},
+		},
+		"unknown downstream": {
+			downstreams: map[string][]string{"db": {"other"}},
+			expected:    map[string][]string{},
+		},
+		"limited": {
+			downstreams: map[string][]string{"db": {"web", "api", "auth"}},
+			maxSources:  2,
+			expected:    map[string][]string{"db": {"web", "api"}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			sources := generate(t, Config{
+				Density:                  1,
+				MaxSourcesPerDestination: tc.maxSources,
+				Services:                 services("web", "api", "auth", "db"),
+				Downstreams:              tc.downstreams,
+			})
+
+			if len(sources) != len(tc.expected) {
+				t.Fatalf("expected intentions for %d destinations but got %d", len(tc.expected), len(sources))
+			}
+			for dest, names := range tc.expected {
+				if len(sources[dest]) != len(names) {
+					t.Fatalf("expected %d sources for %s but got %d", len(names), dest, len(sources[dest]))
+				}
+				for i, name := range names {
+					if sources[dest][i].Name != name {
+						t.Fatalf("expected source %d of %s to be %s but got %s", i, dest, name, sources[dest][i].Name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestStream_RandomSources(t *testing.T) {
+	cases := map[string]struct {
+		density    float64
+		maxSources int
+		// sources is the number of sources of each destination
+		sources int
+	}{
+		"all":     {density: 1, sources: 3},
+		"limited": {density: 1, maxSources: 2, sources: 2},
+		"none":    {density: 0, sources: 0},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			sources := generate(t, Config{
+				Density:                  tc.density,
+				MaxSourcesPerDestination: tc.maxSources,
+				Services:                 services("web", "api", "auth", "db"),
+			})
+
+			for _, dest := range []string{"web", "api", "auth", "db"} {
+				if len(sources[dest]) != tc.sources {
+					t.Fatalf("expected %d sources for %s but got %d", tc.sources, dest, len(sources[dest]))
+				}
+				for _, source := range sources[dest] {
+					if source.Name == dest {
+						t.Fatalf("%s has an intention from itself", dest)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestStream_L7Protocols(t *testing.T) {
+	cases := map[string]struct {
+		protocol string
+		l7       bool
+	}{
+		"unknown": {protocol: ""},
+		"tcp":     {protocol: "tcp"},
+		"http":    {protocol: "http", l7: true},
+		"http2":   {protocol: "http2", l7: true},
+		"grpc":    {protocol: "grpc", l7: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			svcs := services("web", "api")
+			svcs[1].Protocol = tc.protocol
+
+			sources := generate(t, Config{
+				Density:    1,
+				L7Fraction: 1,
+				Services:   svcs,
+			})
+
+			for _, source := range sources["api"] {
+				if l7 := len(source.Permissions) > 0; l7 != tc.l7 {
+					t.Fatalf("expected the intention from %s to have L7 permissions: %t", source.Name, tc.l7)
+				}
+				if l7 := source.Action == ""; l7 != tc.l7 {
+					t.Fatalf("expected the intention from %s to have no action: %t", source.Name, tc.l7)
+				}
+			}
+			// the source uses tcp so its intentions never have L7 permissions
+			for _, source := range sources["web"] {
+				if len(source.Permissions) > 0 {
+					t.Fatalf("intention to a tcp destination has L7 permissions")
+				}
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	l4 := &Source{Name: "web", Action: ActionAllow}
+	l7 := &Source{Name: "web", Permissions: []*Permission{{Action: ActionAllow, PathPrefix: "/"}}}
+
+	cases := map[string]struct {
+		protocol string
+		sources  []*Source
+		valid    bool
+	}{
+		"l4 tcp":      {protocol: "tcp", sources: []*Source{l4}, valid: true},
+		"l4 http":     {protocol: "http", sources: []*Source{l4}, valid: true},
+		"l7 http":     {protocol: "http", sources: []*Source{l4, l7}, valid: true},
+		"l7 grpc":     {protocol: "grpc", sources: []*Source{l7}, valid: true},
+		"l7 tcp":      {protocol: "tcp", sources: []*Source{l4, l7}},
+		"l7 unknown":  {protocol: "", sources: []*Source{l7}},
+		"no sources":  {protocol: "tcp", valid: true},
+		"l4 wildcard": {protocol: "tcp", sources: []*Source{{Name: Wildcard, Action: ActionDeny}}, valid: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			svcs := []Service{{Name: "api", Namespace: "ns", Protocol: tc.protocol}}
+			intentions := []*Intentions{{Name: "api", Namespace: "ns", Sources: tc.sources}}
+
+			err := Validate(intentions, svcs)
+			if valid := err == nil; valid != tc.valid {
+				t.Fatalf("expected the intentions to be valid: %t, got error: %v", tc.valid, err)
+			}
+		})
+	}
+
+	// the protocol is that of the service in the same namespace
+	svcs := []Service{{Name: "api", Namespace: "ns", Protocol: "http"}}
+	intentions := []*Intentions{{Name: "api", Namespace: "other", Sources: []*Source{l7}}}
+	if err := Validate(intentions, svcs); err == nil {
+		t.Fatalf("expected L7 intentions for a service in another namespace to be invalid")
+	}
+}
+
+func TestStream_Precedence(t *testing.T) {
+	cases := map[string]struct {
+		conf Config
+		// wildcards is the number of destinations with an intention from all services
+		wildcards int
+		// defaults is the number of namespaces with a default intention
+		defaults int
+		action   string
+	}{
+		"exact only":   {conf: Config{Density: 1}, action: ActionAllow},
+		"all denied":   {conf: Config{Density: 1, DenyFraction: 1}, action: ActionDeny},
+		"wildcards":    {conf: Config{Density: 1, WildcardFraction: 1}, wildcards: 3, action: ActionAllow},
+		"default deny": {conf: Config{DefaultAction: ActionDeny}, defaults: 2},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tc.conf.Services = []Service{{Name: "web", Namespace: "a"}, {Name: "api", Namespace: "a"}, {Name: "db", Namespace: "b"}}
+			tc.conf.Rand = rand.New(rand.NewSource(1))
+
+			wildcards, defaults := 0, 0
+			err := Stream(tc.conf, func(intentions *Intentions) error {
+				for _, source := range intentions.Sources {
+					switch {
+					case intentions.Name == Wildcard:
+						if source.Name != Wildcard || source.Action != tc.conf.DefaultAction {
+							t.Fatalf("unexpected default intention: %+v", source)
+						}
+						defaults++
+					case source.Name == Wildcard:
+						// the wildcard is last so that exact sources take precedence
+						if intentions.Sources[len(intentions.Sources)-1] != source {
+							t.Fatalf("wildcard intention of %s isn't the last one", intentions.Name)
+						}
+						wildcards++
+					case source.Action != tc.action:
+						t.Fatalf("expected action %s but got %s", tc.action, source.Action)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to generate intentions: %v", err)
+			}
+			if wildcards != tc.wildcards {
+				t.Fatalf("expected %d wildcard intentions but got %d", tc.wildcards, wildcards)
+			}
+			if defaults != tc.defaults {
+				t.Fatalf("expected %d default intentions but got %d", tc.defaults, defaults)
+			}
+		})
+	}
+}
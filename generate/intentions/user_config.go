@@ -0,0 +1,92 @@
+package intentions
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+type UserConfig struct {
+	Density                  float64
+	MaxSourcesPerDestination int
+	WildcardFraction         float64
+	DenyFraction             float64
+	L7Fraction               float64
+	MinPermissions           int
+	MaxPermissions           int
+	DefaultAction            string
+}
+
+func (c *UserConfig) ToGeneratorConfig(rng *rand.Rand) (Config, error) {
+	c.Normalize()
+
+	switch c.DefaultAction {
+	case "", ActionAllow, ActionDeny:
+	default:
+		return Config{}, fmt.Errorf("Invalid intentions default action: %s", c.DefaultAction)
+	}
+
+	return Config{
+		Density:                  c.Density,
+		MaxSourcesPerDestination: c.MaxSourcesPerDestination,
+		WildcardFraction:         c.WildcardFraction,
+		DenyFraction:             c.DenyFraction,
+		L7Fraction:               c.L7Fraction,
+		MinPermissions:           c.MinPermissions,
+		MaxPermissions:           c.MaxPermissions,
+		DefaultAction:            c.DefaultAction,
+		WordGen:                  DefaultWordGenerator(rng),
+		Rand:                     rng,
+	}, nil
+}
+
+// Enabled returns whether any intentions are to be generated
+func (c *UserConfig) Enabled() bool {
+	return c.Density > 0 || c.DefaultAction != ""
+}
+
+func (c *UserConfig) Normalize() {
+	if c.Density < 0 {
+		c.Density = DefaultDensity
+	}
+
+	if c.MaxSourcesPerDestination <= 0 {
+		c.MaxSourcesPerDestination = DefaultMaxSourcesPerDestination
+	}
+
+	if c.WildcardFraction < 0 {
+		c.WildcardFraction = DefaultWildcardFraction
+	}
+
+	if c.DenyFraction < 0 {
+		c.DenyFraction = DefaultDenyFraction
+	}
+
+	if c.L7Fraction < 0 {
+		c.L7Fraction = DefaultL7Fraction
+	}
+
+	if c.MinPermissions <= 0 {
+		c.MinPermissions = DefaultMinPermissions
+	}
+
+	if c.MaxPermissions <= 0 {
+		c.MaxPermissions = DefaultMaxPermissions
+	}
+
+	if c.MaxPermissions < c.MinPermissions {
+		c.MaxPermissions = c.MinPermissions
+	}
+}
+
+func DefaultUserConfig() UserConfig {
+	return UserConfig{
+		Density:                  DefaultDensity,
+		MaxSourcesPerDestination: DefaultMaxSourcesPerDestination,
+		WildcardFraction:         DefaultWildcardFraction,
+		DenyFraction:             DefaultDenyFraction,
+		L7Fraction:               DefaultL7Fraction,
+		MinPermissions:           DefaultMinPermissions,
+		MaxPermissions:           DefaultMaxPermissions,
+		DefaultAction:            DefaultDefaultAction,
+	}
+}
@@ -2,14 +2,19 @@ package kv
 
 import (
 	"fmt"
+	"math/rand"
+	"time"
 
 	"github.com/mkeeler/consul-data/generate/generators"
 )
 
-var (
-	DefaultKeyGenerator   = generators.PetNameGenerator("", 3, "-")
-	DefaultValueGenerator = generators.RandomB64Generator(64, 1024)
-)
+func DefaultKeyGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, "", 3, "-")
+}
+
+func DefaultValueGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.RandomB64Generator(rng, 64, 1024)
+}
 
 // Value is the value type of the KV mapping
 type Value struct {
@@ -17,7 +22,10 @@ type Value struct {
 	Token      string `json:",omitempty"`
 	Value      string
 	Namespace  string `json:",omitempty"`
+	Partition  string `json:",omitempty"`
 	Flags      uint   `json:",omitempty"`
+	// ExpectDenied is set when the token deliberately lacks permission for the write
+	ExpectDenied bool `json:",omitempty"`
 }
 
 // KV is the output format of the generated KV data before serializing to JSON.
@@ -26,9 +34,11 @@ type Value struct {
 //      "<key 1>": {
 //         "Value": "<data>",
 //         "Namespace": "<optional>",
+//         "Partition": "<optional>",
 //         "Datacenter": "<optional>",
 //         "Token": "<optional>",
 //         "Flags": <optional - uint>,
+//         "ExpectDenied": <optional - bool>,
 //      },
 //      ...
 //   }
@@ -41,60 +51,117 @@ type Config struct {
 	NumEntries int
 	KeyGen     generators.StringGenerator
 	ValueGen   generators.StringGenerator
+	// DatacenterGen picks the datacenter of each entry. When nil entries are not
+	// assigned a datacenter and will be written to the datacenter of the agent.
+	DatacenterGen generators.StringGenerator
+	// PartitionGen and NamespaceGen pick the admin partition and namespace of each
+	// entry. When nil the defaults are used.
+	PartitionGen generators.StringGenerator
+	NamespaceGen generators.StringGenerator
+
+	// Rand is the source of randomness for any default generators. When nil a
+	// new source seeded with the current time is used.
+	Rand *rand.Rand
 }
 
 // DefaultConfig returns a config with all the defaults filled in.
-func DefaultConfig() Config {
+func DefaultConfig(rng *rand.Rand) Config {
 	return Config{
 		NumEntries: 1024,
-		KeyGen:     DefaultKeyGenerator,
-		ValueGen:   DefaultValueGenerator,
+		KeyGen:     DefaultKeyGenerator(rng),
+		ValueGen:   DefaultValueGenerator(rng),
+		Rand:       rng,
 	}
 }
 
-func genNewKey(existing KV, gen generators.StringGenerator) (string, error) {
-	for {
-		key, err := gen()
-		if err != nil {
-			return "", fmt.Errorf("Failed to generate KV Key: %w", err)
-		}
-
-		if _, found := existing[key]; !found {
-			return key, nil
-		}
+// genKey makes the generated key unique by suffixing it with the index of the entry so
+// that the keys generated so far don't need to be kept.
+func genKey(index int, gen generators.StringGenerator) (string, error) {
+	key, err := gen()
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate KV Key: %w", err)
 	}
+	return fmt.Sprintf("%s-%d", key, index), nil
 }
 
 // Generate will generate the desired number of KV entries giving the supplied config
 func Generate(conf Config) (KV, error) {
+	data := make(KV)
+	err := Stream(conf, func(key string, value Value) error {
+		data[key] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Stream will generate the desired number of KV entries giving the supplied config
+// and invoke fn with each entry as soon as it is generated. Entries are not retained in
+// memory once generated.
+func Stream(conf Config, fn func(key string, value Value) error) error {
+	if conf.Rand == nil {
+		conf.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
 	if conf.KeyGen == nil {
-		conf.KeyGen = DefaultKeyGenerator
+		conf.KeyGen = DefaultKeyGenerator(conf.Rand)
 	}
 
 	if conf.ValueGen == nil {
-		conf.ValueGen = DefaultValueGenerator
+		conf.ValueGen = DefaultValueGenerator(conf.Rand)
 	}
 
-	if conf.NumEntries < 1 {
-		return make(KV), nil
+	if conf.DatacenterGen == nil {
+		conf.DatacenterGen = generators.EmptyGenerator()
 	}
 
-	data := make(KV)
+	if conf.PartitionGen == nil {
+		conf.PartitionGen = generators.EmptyGenerator()
+	}
+
+	if conf.NamespaceGen == nil {
+		conf.NamespaceGen = generators.EmptyGenerator()
+	}
 
 	for i := 0; i < conf.NumEntries; i++ {
 
-		key, err := genNewKey(data, conf.KeyGen)
+		key, err := genKey(i, conf.KeyGen)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		value, err := conf.ValueGen()
 		if err != nil {
-			return nil, fmt.Errorf("Failed to generate KV Value: %w", err)
+			return fmt.Errorf("Failed to generate KV Value: %w", err)
+		}
+
+		datacenter, err := conf.DatacenterGen()
+		if err != nil {
+			return fmt.Errorf("Failed to generate KV datacenter: %w", err)
 		}
 
-		data[key] = Value{Value: value}
+		partition, err := conf.PartitionGen()
+		if err != nil {
+			return fmt.Errorf("Failed to generate KV partition: %w", err)
+		}
+
+		namespace, err := conf.NamespaceGen()
+		if err != nil {
+			return fmt.Errorf("Failed to generate KV namespace: %w", err)
+		}
+
+		entry := Value{
+			Datacenter: datacenter,
+			Partition:  partition,
+			Namespace:  namespace,
+			Value:      value,
+		}
+		if err := fn(key, entry); err != nil {
+			return err
+		}
 	}
 
-	return data, nil
+	return nil
 }
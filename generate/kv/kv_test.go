@@ -0,0 +1,35 @@
+package kv
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestStream_UniqueKeys(t *testing.T) {
+	cases := map[string]Config{
+		"default generator": {NumEntries: 100},
+		// keys are unique even when the generator keeps producing the same one
+		"repeating generator": {NumEntries: 100, KeyGen: func() (string, error) { return "key", nil }},
+	}
+
+	for name, conf := range cases {
+		t.Run(name, func(t *testing.T) {
+			conf.Rand = rand.New(rand.NewSource(1))
+
+			keys := make(map[string]struct{})
+			err := Stream(conf, func(key string, value Value) error {
+				if _, found := keys[key]; found {
+					t.Fatalf("key %s was generated more than once", key)
+				}
+				keys[key] = struct{}{}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to generate KV data: %v", err)
+			}
+			if len(keys) != conf.NumEntries {
+				t.Fatalf("expected %d keys but got %d", conf.NumEntries, len(keys))
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package kv
 
 import (
 	"fmt"
+	"math/rand"
 
 	"github.com/mkeeler/consul-data/generate/generators"
 )
@@ -35,23 +36,24 @@ type UserConfig struct {
 	RandomB64 RandomB64UserConfig
 }
 
-func (c *UserConfig) ToGeneratorConfig() (Config, error) {
+func (c *UserConfig) ToGeneratorConfig(rng *rand.Rand) (Config, error) {
 	c.Normalize()
 
 	conf := Config{
 		NumEntries: c.NumEntries,
+		Rand:       rng,
 	}
 
 	switch c.KeyType {
 	case KeyTypePetName:
-		conf.KeyGen = c.PetName.Generator()
+		conf.KeyGen = c.PetName.Generator(rng)
 	default:
 		return Config{}, fmt.Errorf("Invalid KV generator key type: %s", c.KeyType)
 	}
 
 	switch c.ValueType {
 	case ValueTypeRandomB64:
-		conf.ValueGen = c.RandomB64.Generator()
+		conf.ValueGen = c.RandomB64.Generator(rng)
 	default:
 		return Config{}, fmt.Errorf("Invalid KV generator key type: %s", c.KeyType)
 	}
@@ -109,8 +111,8 @@ func (c *PetNameUserConfig) Normalize() {
 	}
 }
 
-func (c *PetNameUserConfig) Generator() generators.StringGenerator {
-	return generators.PetNameGenerator(c.Prefix, c.Segments, c.Separator)
+func (c *PetNameUserConfig) Generator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, c.Prefix, c.Segments, c.Separator)
 }
 
 func DefaultPetNameUserConfig() PetNameUserConfig {
@@ -146,8 +148,8 @@ func (c *RandomB64UserConfig) Normalize() {
 	}
 }
 
-func (c *RandomB64UserConfig) Generator() generators.StringGenerator {
-	return generators.RandomB64Generator(c.MinSize, c.MaxSize)
+func (c *RandomB64UserConfig) Generator(rng *rand.Rand) generators.StringGenerator {
+	return generators.RandomB64Generator(rng, c.MinSize, c.MaxSize)
 }
 
 func DefaultRandomB64UserConfig() RandomB64UserConfig {
@@ -0,0 +1,351 @@
+package generate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/mkeeler/consul-data/generate/acl"
+	"github.com/mkeeler/consul-data/generate/catalog"
+	"github.com/mkeeler/consul-data/generate/configentries"
+	"github.com/mkeeler/consul-data/generate/events"
+	"github.com/mkeeler/consul-data/generate/intentions"
+	"github.com/mkeeler/consul-data/generate/kv"
+	"github.com/mkeeler/consul-data/generate/preparedqueries"
+	"github.com/mkeeler/consul-data/generate/sessions"
+)
+
+const (
+	recordTypeKV   = "kv"
+	recordTypeNode = "node"
+
+	recordTypeGraphService  = "graph-service"
+	recordTypeACLPolicy     = "acl-policy"
+	recordTypeACLRole       = "acl-role"
+	recordTypeACLToken      = "acl-token"
+	recordTypeConfigEntry   = "config-entry"
+	recordTypeIntentions    = "intentions"
+	recordTypePreparedQuery = "prepared-query"
+	recordTypeSession       = "session"
+	recordTypeEvent         = "event"
+)
+
+// recordHeader is decoded first to determine the type of an NDJSON record.
+type recordHeader struct {
+	Type string
+}
+
+// kvRecord is a single KV entry within NDJSON data. It looks like the following:
+//
+//	{"Type":"kv","Key":"<key>","Value":"<data>"}
+type kvRecord struct {
+	Type string
+	Key  string
+	kv.Value
+}
+
+// nodeRecord is a single node along with its services within NDJSON data. It looks
+// like the following:
+//
+//	{"Type":"node","Address":"<address>","ID":"<id>","Name":"<name>","Services":[...]}
+type nodeRecord struct {
+	Type string
+	*catalog.Node
+}
+
+// graphServiceRecord is a single service of the service graph within NDJSON data.
+type graphServiceRecord struct {
+	Type string
+	*catalog.GraphService
+}
+
+// aclPolicyRecord, aclRoleRecord and aclTokenRecord are single ACL resources within
+// NDJSON data.
+type aclPolicyRecord struct {
+	Type string
+	*acl.Policy
+}
+
+type aclRoleRecord struct {
+	Type string
+	*acl.Role
+}
+
+type aclTokenRecord struct {
+	Type string
+	*acl.Token
+}
+
+// configEntryRecord is a single config entry within NDJSON data.
+type configEntryRecord struct {
+	Type string
+	*configentries.Entry
+}
+
+// intentionsRecord is the intentions of a single destination service within NDJSON data.
+type intentionsRecord struct {
+	Type string
+	*intentions.Intentions
+}
+
+// preparedQueryRecord is a single prepared query within NDJSON data.
+type preparedQueryRecord struct {
+	Type string
+	*preparedqueries.Query
+}
+
+// sessionRecord is a single session along with its locks within NDJSON data.
+type sessionRecord struct {
+	Type string
+	*sessions.Session
+}
+
+// eventRecord is a single user event within NDJSON data.
+type eventRecord struct {
+	Type string
+	*events.Event
+}
+
+// NDJSONWriter serializes data as newline delimited JSON where every line is a single
+// record. Unlike the Writer, KV entries and nodes may be written in any order and
+// files produced by it can be concatenated or split at line boundaries.
+type NDJSONWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewNDJSONWriter creates an NDJSONWriter outputting to w.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	buf := bufio.NewWriter(w)
+	return &NDJSONWriter{
+		w:   buf,
+		enc: json.NewEncoder(buf),
+	}
+}
+
+// Handler returns a Handler which writes all the data it receives.
+func (w *NDJSONWriter) Handler() Handler {
+	return Handler{
+		KV:            w.WriteKV,
+		GraphService:  w.WriteGraphService,
+		Node:          w.WriteNode,
+		ACLPolicy:     w.WriteACLPolicy,
+		ACLRole:       w.WriteACLRole,
+		ACLToken:      w.WriteACLToken,
+		ConfigEntry:   w.WriteConfigEntry,
+		Intentions:    w.WriteIntentions,
+		PreparedQuery: w.WritePreparedQuery,
+		Session:       w.WriteSession,
+		Event:         w.WriteEvent,
+	}
+}
+
+// WriteKV writes a single KV entry.
+func (w *NDJSONWriter) WriteKV(key string, value kv.Value) error {
+	if err := w.enc.Encode(kvRecord{Type: recordTypeKV, Key: key, Value: value}); err != nil {
+		return fmt.Errorf("Failed to write KV entry %s: %w", key, err)
+	}
+	return nil
+}
+
+// WriteGraphService writes a single service of the service graph.
+func (w *NDJSONWriter) WriteGraphService(svc *catalog.GraphService) error {
+	if err := w.enc.Encode(graphServiceRecord{Type: recordTypeGraphService, GraphService: svc}); err != nil {
+		return fmt.Errorf("Failed to write graph service %s: %w", svc.Name, err)
+	}
+	return nil
+}
+
+// WriteNode writes a single node along with all of its services.
+func (w *NDJSONWriter) WriteNode(node *catalog.Node) error {
+	if err := w.enc.Encode(nodeRecord{Type: recordTypeNode, Node: node}); err != nil {
+		return fmt.Errorf("Failed to write Node %s: %w", node.Name, err)
+	}
+	return nil
+}
+
+// WriteACLPolicy writes a single ACL policy.
+func (w *NDJSONWriter) WriteACLPolicy(policy *acl.Policy) error {
+	if err := w.enc.Encode(aclPolicyRecord{Type: recordTypeACLPolicy, Policy: policy}); err != nil {
+		return fmt.Errorf("Failed to write ACL policy %s: %w", policy.Name, err)
+	}
+	return nil
+}
+
+// WriteACLRole writes a single ACL role.
+func (w *NDJSONWriter) WriteACLRole(role *acl.Role) error {
+	if err := w.enc.Encode(aclRoleRecord{Type: recordTypeACLRole, Role: role}); err != nil {
+		return fmt.Errorf("Failed to write ACL role %s: %w", role.Name, err)
+	}
+	return nil
+}
+
+// WriteACLToken writes a single ACL token.
+func (w *NDJSONWriter) WriteACLToken(token *acl.Token) error {
+	if err := w.enc.Encode(aclTokenRecord{Type: recordTypeACLToken, Token: token}); err != nil {
+		return fmt.Errorf("Failed to write ACL token %s: %w", token.AccessorID, err)
+	}
+	return nil
+}
+
+// WriteConfigEntry writes a single config entry.
+func (w *NDJSONWriter) WriteConfigEntry(entry *configentries.Entry) error {
+	if err := w.enc.Encode(configEntryRecord{Type: recordTypeConfigEntry, Entry: entry}); err != nil {
+		return fmt.Errorf("Failed to write %s config entry %s: %w", entry.Kind, entry.Name, err)
+	}
+	return nil
+}
+
+// WriteIntentions writes the intentions of a single destination service.
+func (w *NDJSONWriter) WriteIntentions(intentions *intentions.Intentions) error {
+	if err := w.enc.Encode(intentionsRecord{Type: recordTypeIntentions, Intentions: intentions}); err != nil {
+		return fmt.Errorf("Failed to write intentions for %s: %w", intentions.Name, err)
+	}
+	return nil
+}
+
+// WritePreparedQuery writes a single prepared query.
+func (w *NDJSONWriter) WritePreparedQuery(query *preparedqueries.Query) error {
+	if err := w.enc.Encode(preparedQueryRecord{Type: recordTypePreparedQuery, Query: query}); err != nil {
+		return fmt.Errorf("Failed to write prepared query %s: %w", query.Name, err)
+	}
+	return nil
+}
+
+// WriteSession writes a single session.
+func (w *NDJSONWriter) WriteSession(session *sessions.Session) error {
+	if err := w.enc.Encode(sessionRecord{Type: recordTypeSession, Session: session}); err != nil {
+		return fmt.Errorf("Failed to write session %s: %w", session.Name, err)
+	}
+	return nil
+}
+
+// WriteEvent writes a single user event.
+func (w *NDJSONWriter) WriteEvent(event *events.Event) error {
+	if err := w.enc.Encode(eventRecord{Type: recordTypeEvent, Event: event}); err != nil {
+		return fmt.Errorf("Failed to write event %s: %w", event.Name, err)
+	}
+	return nil
+}
+
+// Close flushes any buffered output. It does not close the underlying io.Writer.
+func (w *NDJSONWriter) Close() error {
+	if err := w.w.Flush(); err != nil {
+		return fmt.Errorf("Failed to write data: %w", err)
+	}
+	return nil
+}
+
+// decodeNDJSON reads newline delimited JSON records handing each to the handler
+// in the order they appear.
+func decodeNDJSON(r io.Reader, h Handler) error {
+	dec := json.NewDecoder(r)
+
+	for record := 1; ; record++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Failed to parse record %d: %w", record, err)
+		}
+
+		var header recordHeader
+		if err := json.Unmarshal(raw, &header); err != nil {
+			return fmt.Errorf("Failed to parse record %d: %w", record, err)
+		}
+
+		switch header.Type {
+		case recordTypeKV:
+			var entry kvRecord
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return fmt.Errorf("Failed to parse record %d: %w", record, err)
+			}
+			if err := h.handleKV(entry.Key, entry.Value); err != nil {
+				return err
+			}
+		case recordTypeNode:
+			entry := nodeRecord{Node: &catalog.Node{}}
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return fmt.Errorf("Failed to parse record %d: %w", record, err)
+			}
+			if err := h.handleNode(entry.Node); err != nil {
+				return err
+			}
+		case recordTypeGraphService:
+			entry := graphServiceRecord{GraphService: &catalog.GraphService{}}
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return fmt.Errorf("Failed to parse record %d: %w", record, err)
+			}
+			if err := h.handleGraphService(entry.GraphService); err != nil {
+				return err
+			}
+		case recordTypeACLPolicy:
+			entry := aclPolicyRecord{Policy: &acl.Policy{}}
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return fmt.Errorf("Failed to parse record %d: %w", record, err)
+			}
+			if err := h.handleACLPolicy(entry.Policy); err != nil {
+				return err
+			}
+		case recordTypeACLRole:
+			entry := aclRoleRecord{Role: &acl.Role{}}
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return fmt.Errorf("Failed to parse record %d: %w", record, err)
+			}
+			if err := h.handleACLRole(entry.Role); err != nil {
+				return err
+			}
+		case recordTypeACLToken:
+			entry := aclTokenRecord{Token: &acl.Token{}}
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return fmt.Errorf("Failed to parse record %d: %w", record, err)
+			}
+			if err := h.handleACLToken(entry.Token); err != nil {
+				return err
+			}
+		case recordTypeConfigEntry:
+			entry := configEntryRecord{Entry: &configentries.Entry{}}
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return fmt.Errorf("Failed to parse record %d: %w", record, err)
+			}
+			if err := h.handleConfigEntry(entry.Entry); err != nil {
+				return err
+			}
+		case recordTypeIntentions:
+			entry := intentionsRecord{Intentions: &intentions.Intentions{}}
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return fmt.Errorf("Failed to parse record %d: %w", record, err)
+			}
+			if err := h.handleIntentions(entry.Intentions); err != nil {
+				return err
+			}
+		case recordTypePreparedQuery:
+			entry := preparedQueryRecord{Query: &preparedqueries.Query{}}
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return fmt.Errorf("Failed to parse record %d: %w", record, err)
+			}
+			if err := h.handlePreparedQuery(entry.Query); err != nil {
+				return err
+			}
+		case recordTypeSession:
+			entry := sessionRecord{Session: &sessions.Session{}}
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return fmt.Errorf("Failed to parse record %d: %w", record, err)
+			}
+			if err := h.handleSession(entry.Session); err != nil {
+				return err
+			}
+		case recordTypeEvent:
+			entry := eventRecord{Event: &events.Event{}}
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return fmt.Errorf("Failed to parse record %d: %w", record, err)
+			}
+			if err := h.handleEvent(entry.Event); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("Failed to parse record %d: unknown record type %q", record, header.Type)
+		}
+	}
+}
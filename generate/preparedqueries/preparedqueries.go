@@ -0,0 +1,281 @@
+package preparedqueries
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// TemplateService is the service of templates which query the service named by
+	// the full name the query is executed with
+	TemplateService = "${name.full}"
+	// TemplateRegexpService is the service of templates with a regexp which query the
+	// service named by the whole match
+	TemplateRegexpService = "${match(0)}"
+)
+
+var (
+	// Prepared queries are only generated when requested as they are independent of
+	// the services they refer to.
+	DefaultFraction               = 0.0
+	DefaultNumTemplates           = 0
+	DefaultOnlyPassingFraction    = 0.5
+	DefaultTagFilterFraction      = 0.3
+	DefaultNodeMetaFilterFraction = 0.2
+	DefaultFailoverFraction       = 0.5
+	DefaultMaxFailoverDatacenters = 2
+)
+
+// Service is a service which prepared queries may be generated for. Tags and NodeMeta
+// are those of one of its instances and the node it is registered on.
+type Service struct {
+	Name       string
+	Namespace  string
+	Partition  string
+	Datacenter string
+	Tags       []string
+	NodeMeta   map[string]string
+}
+
+// Query is a single prepared query. Queries with a Template are templates matching any
+// query name starting with the query's name.
+type Query struct {
+	Name        string
+	Datacenter  string `json:",omitempty"`
+	Service     string
+	Namespace   string            `json:",omitempty"`
+	OnlyPassing bool              `json:",omitempty"`
+	Tags        []string          `json:",omitempty"`
+	NodeMeta    map[string]string `json:",omitempty"`
+
+	// NearestN and FailoverDatacenters are where the query fails over to when no
+	// instances are healthy in its own datacenter
+	NearestN            int      `json:",omitempty"`
+	FailoverDatacenters []string `json:",omitempty"`
+
+	Template *Template `json:",omitempty"`
+}
+
+// Template is the name_prefix_match template of a query. When Regexp is set the service
+// queried for is its match of the query name rather than the whole name.
+type Template struct {
+	Regexp string `json:",omitempty"`
+}
+
+// Config is all the configuration necessary for creating prepared queries
+type Config struct {
+	// Fraction is the fraction of services which a query with the same name is
+	// generated for
+	Fraction float64
+	// NumTemplates is how many query templates are generated. Each matches the first
+	// word of a service's name.
+	NumTemplates           int
+	OnlyPassingFraction    float64
+	TagFilterFraction      float64
+	NodeMetaFilterFraction float64
+	FailoverFraction       float64
+	MaxFailoverDatacenters int
+
+	// Datacenters are those which queries may fail over to. When empty queries fail
+	// over to the nearest datacenters instead.
+	Datacenters []string
+
+	// Services are what the queries are generated for. Prepared queries don't support
+	// admin partitions so services outside the default partition are skipped.
+	Services []Service
+
+	// Rand is the source of randomness for generating queries. When nil a new source
+	// seeded with the current time is used.
+	Rand *rand.Rand
+}
+
+// DefaultConfig returns a config with all the defaults filled in.
+func DefaultConfig(rng *rand.Rand) Config {
+	return Config{
+		Fraction:               DefaultFraction,
+		NumTemplates:           DefaultNumTemplates,
+		OnlyPassingFraction:    DefaultOnlyPassingFraction,
+		TagFilterFraction:      DefaultTagFilterFraction,
+		NodeMetaFilterFraction: DefaultNodeMetaFilterFraction,
+		FailoverFraction:       DefaultFailoverFraction,
+		MaxFailoverDatacenters: DefaultMaxFailoverDatacenters,
+		Rand:                   rng,
+	}
+}
+
+func (c *Config) normalize() {
+	if c.Rand == nil {
+		c.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	if c.MaxFailoverDatacenters < 1 {
+		c.MaxFailoverDatacenters = 1
+	}
+}
+
+// chance returns true for the given fraction of calls without consuming any random data
+// when it can't
+func chance(rng *rand.Rand, fraction float64) bool {
+	return fraction > 0 && rng.Float64() < fraction
+}
+
+// queryKey identifies a query as names must be unique within a datacenter
+type queryKey struct {
+	datacenter string
+	name       string
+}
+
+func genTags(conf Config, svc Service) []string {
+	n := 1 + conf.Rand.Intn(2)
+	if n > len(svc.Tags) {
+		n = len(svc.Tags)
+	}
+
+	var tags []string
+	for _, i := range conf.Rand.Perm(len(svc.Tags))[:n] {
+		// some tags are required to be absent instead
+		if chance(conf.Rand, 0.2) {
+			tags = append(tags, "!"+svc.Tags[i])
+		} else {
+			tags = append(tags, svc.Tags[i])
+		}
+	}
+	return tags
+}
+
+func genNodeMeta(conf Config, svc Service) map[string]string {
+	keys := make([]string, 0, len(svc.NodeMeta))
+	for key := range svc.NodeMeta {
+		keys = append(keys, key)
+	}
+	// sorted so that the pick doesn't depend on map iteration order
+	sort.Strings(keys)
+
+	key := keys[conf.Rand.Intn(len(keys))]
+	return map[string]string{key: svc.NodeMeta[key]}
+}
+
+func genFailover(conf Config, query *Query) {
+	var candidates []string
+	for _, dc := range conf.Datacenters {
+		if dc != query.Datacenter {
+			candidates = append(candidates, dc)
+		}
+	}
+
+	n := 1 + conf.Rand.Intn(conf.MaxFailoverDatacenters)
+	if len(candidates) == 0 {
+		query.NearestN = n
+		return
+	}
+
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	for _, i := range conf.Rand.Perm(len(candidates))[:n] {
+		query.FailoverDatacenters = append(query.FailoverDatacenters, candidates[i])
+	}
+}
+
+func genQuery(conf Config, svc Service) *Query {
+	query := Query{
+		Name:        svc.Name,
+		Datacenter:  svc.Datacenter,
+		Service:     svc.Name,
+		Namespace:   svc.Namespace,
+		OnlyPassing: chance(conf.Rand, conf.OnlyPassingFraction),
+	}
+
+	if len(svc.Tags) > 0 && chance(conf.Rand, conf.TagFilterFraction) {
+		query.Tags = genTags(conf, svc)
+	}
+
+	if len(svc.NodeMeta) > 0 && chance(conf.Rand, conf.NodeMetaFilterFraction) {
+		query.NodeMeta = genNodeMeta(conf, svc)
+	}
+
+	if chance(conf.Rand, conf.FailoverFraction) {
+		genFailover(conf, &query)
+	}
+	return &query
+}
+
+func genTemplate(conf Config, svc Service) *Query {
+	prefix := svc.Name
+	if i := strings.Index(prefix, "-"); i >= 0 {
+		prefix = prefix[:i+1]
+	}
+
+	query := Query{
+		Name:        prefix,
+		Datacenter:  svc.Datacenter,
+		Service:     TemplateService,
+		Namespace:   svc.Namespace,
+		OnlyPassing: chance(conf.Rand, conf.OnlyPassingFraction),
+		Template:    &Template{},
+	}
+
+	if conf.Rand.Intn(2) == 0 {
+		query.Service = TemplateRegexpService
+		query.Template.Regexp = "^" + prefix + ".+$"
+	}
+
+	if chance(conf.Rand, conf.FailoverFraction) {
+		genFailover(conf, &query)
+	}
+	return &query
+}
+
+// Stream will generate the prepared queries invoking the function with each as soon as
+// it is generated. Queries for services come first followed by the templates. Services
+// with the same name as an existing query in the same datacenter, such as those in
+// another namespace, are skipped.
+func Stream(conf Config, fn func(*Query) error) error {
+	conf.normalize()
+
+	var services []Service
+	for _, svc := range conf.Services {
+		if svc.Partition == "" || svc.Partition == "default" {
+			services = append(services, svc)
+		}
+	}
+
+	names := make(map[queryKey]struct{})
+	for _, svc := range services {
+		if !chance(conf.Rand, conf.Fraction) {
+			continue
+		}
+
+		query := genQuery(conf, svc)
+		key := queryKey{datacenter: query.Datacenter, name: query.Name}
+		if _, found := names[key]; found {
+			continue
+		}
+		names[key] = struct{}{}
+
+		if err := fn(query); err != nil {
+			return err
+		}
+	}
+
+	if len(services) == 0 {
+		return nil
+	}
+
+	// templates may match the same prefix so there may be fewer than requested
+	for i := 0; i < conf.NumTemplates; i++ {
+		query := genTemplate(conf, services[conf.Rand.Intn(len(services))])
+		key := queryKey{datacenter: query.Datacenter, name: query.Name}
+		if _, found := names[key]; found {
+			continue
+		}
+		names[key] = struct{}{}
+
+		if err := fn(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package preparedqueries
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func testServices() []Service {
+	meta := map[string]string{"rack": "r1", "zone": "z1"}
+	return []Service{
+		{Name: "web-frontend", Datacenter: "dc1", Tags: []string{"v1", "primary"}, NodeMeta: meta},
+		{Name: "web-backend", Datacenter: "dc1", Tags: []string{"v2"}, NodeMeta: meta},
+		{Name: "api", Datacenter: "dc1", NodeMeta: meta},
+		// the same name in another namespace can't have a query of its own
+		{Name: "api", Namespace: "ns", Datacenter: "dc1"},
+		{Name: "api", Datacenter: "dc2", Tags: []string{"v1"}},
+		{Name: "db", Partition: "p1", Datacenter: "dc1"},
+		{Name: "cache", Partition: "default", Datacenter: "dc2"},
+	}
+}
+
+func TestStream(t *testing.T) {
+	cases := map[string]struct {
+		conf        Config
+		services    []Service
+		queries     int
+		templates   int
+		datacenters []string
+	}{
+		"defaults": {
+			conf:     DefaultConfig(nil),
+			services: testServices(),
+		},
+		"no services": {
+			conf: Config{Fraction: 1, NumTemplates: 5},
+		},
+		"only partitioned services": {
+			conf:     Config{Fraction: 1, NumTemplates: 5},
+			services: []Service{{Name: "db", Partition: "p1", Datacenter: "dc1"}},
+		},
+		"all services": {
+			conf:     Config{Fraction: 1, OnlyPassingFraction: 1, TagFilterFraction: 1, NodeMetaFilterFraction: 1},
+			services: testServices(),
+			queries:  5,
+		},
+		"failover to nearest": {
+			conf:     Config{Fraction: 1, FailoverFraction: 1, MaxFailoverDatacenters: 3},
+			services: testServices(),
+			queries:  5,
+		},
+		"failover to datacenters": {
+			conf:        Config{Fraction: 1, FailoverFraction: 1, MaxFailoverDatacenters: 3},
+			services:    testServices(),
+			queries:     5,
+			datacenters: []string{"dc1", "dc2", "dc3"},
+		},
+		"templates": {
+			conf:      Config{NumTemplates: 50, FailoverFraction: 0.5, MaxFailoverDatacenters: 1},
+			services:  testServices(),
+			templates: 4,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			conf := tc.conf
+			conf.Services = tc.services
+			conf.Datacenters = tc.datacenters
+			conf.Rand = rand.New(rand.NewSource(1))
+
+			services := make(map[queryKey]Service)
+			for _, svc := range tc.services {
+				if _, found := services[queryKey{datacenter: svc.Datacenter, name: svc.Name}]; !found {
+					services[queryKey{datacenter: svc.Datacenter, name: svc.Name}] = svc
+				}
+			}
+
+			names := make(map[queryKey]struct{})
+			queries := 0
+			templates := 0
+			err := Stream(conf, func(query *Query) error {
+				key := queryKey{datacenter: query.Datacenter, name: query.Name}
+				if _, found := names[key]; found {
+					t.Fatalf("query %s was generated more than once in %s", query.Name, query.Datacenter)
+				}
+				names[key] = struct{}{}
+
+				checkFailover(t, conf, query)
+
+				if query.Template != nil {
+					templates++
+					checkTemplate(t, conf, query)
+					return nil
+				}
+				queries++
+
+				svc, found := services[key]
+				if !found || svc.Partition == "p1" {
+					t.Fatalf("query %s in %s isn't for a generated service", query.Name, query.Datacenter)
+				}
+				if query.Service != svc.Name || query.Namespace != svc.Namespace {
+					t.Fatalf("query %s is for %s/%s instead of %s/%s", query.Name, query.Namespace, query.Service, svc.Namespace, svc.Name)
+				}
+				if query.OnlyPassing != (conf.OnlyPassingFraction == 1) {
+					t.Fatalf("query %s has OnlyPassing %t", query.Name, query.OnlyPassing)
+				}
+
+				if (len(query.Tags) > 0) != (len(svc.Tags) > 0 && conf.TagFilterFraction == 1) {
+					t.Fatalf("query %s has unexpected tags %v", query.Name, query.Tags)
+				}
+				for _, tag := range query.Tags {
+					if !contains(svc.Tags, strings.TrimPrefix(tag, "!")) {
+						t.Fatalf("query %s filters on tag %s which %s doesn't have", query.Name, tag, svc.Name)
+					}
+				}
+
+				if (len(query.NodeMeta) > 0) != (len(svc.NodeMeta) > 0 && conf.NodeMetaFilterFraction == 1) {
+					t.Fatalf("query %s has unexpected node meta %v", query.Name, query.NodeMeta)
+				}
+				for key, value := range query.NodeMeta {
+					if svc.NodeMeta[key] != value {
+						t.Fatalf("query %s filters on node meta %s=%s which %s's node doesn't have", query.Name, key, value, svc.Name)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to generate prepared queries: %v", err)
+			}
+
+			if queries != tc.queries || templates != tc.templates {
+				t.Fatalf("expected %d queries and %d templates but got %d and %d", tc.queries, tc.templates, queries, templates)
+			}
+		})
+	}
+}
+
+func checkFailover(t *testing.T, conf Config, query *Query) {
+	t.Helper()
+
+	if conf.FailoverFraction == 0 {
+		if query.NearestN != 0 || len(query.FailoverDatacenters) != 0 {
+			t.Fatalf("query %s unexpectedly fails over", query.Name)
+		}
+		return
+	}
+
+	if len(conf.Datacenters) == 0 {
+		if len(query.FailoverDatacenters) != 0 || query.NearestN > conf.MaxFailoverDatacenters {
+			t.Fatalf("query %s fails over to %v and the nearest %d", query.Name, query.FailoverDatacenters, query.NearestN)
+		}
+		if conf.FailoverFraction == 1 && query.NearestN < 1 {
+			t.Fatalf("query %s doesn't fail over", query.Name)
+		}
+		return
+	}
+
+	if query.NearestN != 0 || len(query.FailoverDatacenters) > conf.MaxFailoverDatacenters {
+		t.Fatalf("query %s fails over to %v and the nearest %d", query.Name, query.FailoverDatacenters, query.NearestN)
+	}
+	if conf.FailoverFraction == 1 && len(query.FailoverDatacenters) < 1 {
+		t.Fatalf("query %s doesn't fail over", query.Name)
+	}
+	seen := make(map[string]struct{})
+	for _, dc := range query.FailoverDatacenters {
+		if _, found := seen[dc]; found || dc == query.Datacenter || !contains(conf.Datacenters, dc) {
+			t.Fatalf("query %s in %s fails over to %v", query.Name, query.Datacenter, query.FailoverDatacenters)
+		}
+		seen[dc] = struct{}{}
+	}
+}
+
+func checkTemplate(t *testing.T, conf Config, query *Query) {
+	t.Helper()
+
+	var matched bool
+	for _, svc := range conf.Services {
+		if svc.Datacenter == query.Datacenter && svc.Partition != "p1" && strings.HasPrefix(svc.Name, query.Name) {
+			matched = true
+		}
+	}
+	if !matched {
+		t.Fatalf("template %s in %s doesn't match any service", query.Name, query.Datacenter)
+	}
+
+	switch query.Service {
+	case TemplateService:
+		if query.Template.Regexp != "" {
+			t.Fatalf("template %s has regexp %s without using it", query.Name, query.Template.Regexp)
+		}
+	case TemplateRegexpService:
+		re, err := regexp.Compile(query.Template.Regexp)
+		if err != nil {
+			t.Fatalf("template %s has an invalid regexp: %v", query.Name, err)
+		}
+		if re.MatchString(query.Name) || !re.MatchString(query.Name+"x") {
+			t.Fatalf("regexp %s of template %s doesn't match names with its prefix", query.Template.Regexp, query.Name)
+		}
+	default:
+		t.Fatalf("template %s queries %s", query.Name, query.Service)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
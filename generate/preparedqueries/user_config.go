@@ -0,0 +1,77 @@
+package preparedqueries
+
+import (
+	"math/rand"
+)
+
+type UserConfig struct {
+	Fraction               float64
+	NumTemplates           int
+	OnlyPassingFraction    float64
+	TagFilterFraction      float64
+	NodeMetaFilterFraction float64
+	FailoverFraction       float64
+	MaxFailoverDatacenters int
+}
+
+func (c *UserConfig) ToGeneratorConfig(rng *rand.Rand) (Config, error) {
+	c.Normalize()
+
+	return Config{
+		Fraction:               c.Fraction,
+		NumTemplates:           c.NumTemplates,
+		OnlyPassingFraction:    c.OnlyPassingFraction,
+		TagFilterFraction:      c.TagFilterFraction,
+		NodeMetaFilterFraction: c.NodeMetaFilterFraction,
+		FailoverFraction:       c.FailoverFraction,
+		MaxFailoverDatacenters: c.MaxFailoverDatacenters,
+		Rand:                   rng,
+	}, nil
+}
+
+// Enabled returns whether any prepared queries are to be generated
+func (c *UserConfig) Enabled() bool {
+	return c.Fraction > 0 || c.NumTemplates > 0
+}
+
+func (c *UserConfig) Normalize() {
+	if c.Fraction < 0 {
+		c.Fraction = DefaultFraction
+	}
+
+	if c.NumTemplates < 0 {
+		c.NumTemplates = DefaultNumTemplates
+	}
+
+	if c.OnlyPassingFraction < 0 {
+		c.OnlyPassingFraction = DefaultOnlyPassingFraction
+	}
+
+	if c.TagFilterFraction < 0 {
+		c.TagFilterFraction = DefaultTagFilterFraction
+	}
+
+	if c.NodeMetaFilterFraction < 0 {
+		c.NodeMetaFilterFraction = DefaultNodeMetaFilterFraction
+	}
+
+	if c.FailoverFraction < 0 {
+		c.FailoverFraction = DefaultFailoverFraction
+	}
+
+	if c.MaxFailoverDatacenters <= 0 {
+		c.MaxFailoverDatacenters = DefaultMaxFailoverDatacenters
+	}
+}
+
+func DefaultUserConfig() UserConfig {
+	return UserConfig{
+		Fraction:               DefaultFraction,
+		NumTemplates:           DefaultNumTemplates,
+		OnlyPassingFraction:    DefaultOnlyPassingFraction,
+		TagFilterFraction:      DefaultTagFilterFraction,
+		NodeMetaFilterFraction: DefaultNodeMetaFilterFraction,
+		FailoverFraction:       DefaultFailoverFraction,
+		MaxFailoverDatacenters: DefaultMaxFailoverDatacenters,
+	}
+}
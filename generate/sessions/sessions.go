@@ -0,0 +1,259 @@
+package sessions
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/mkeeler/consul-data/generate/generators"
+)
+
+const (
+	BehaviorRelease = "release"
+	BehaviorDelete  = "delete"
+
+	// Consul only accepts TTLs within these bounds
+	minTTLSeconds = 10
+	maxTTLSeconds = 86400
+)
+
+var (
+	// Sessions are only generated when requested as pushing them acquires locks on KV
+	// entries which aren't otherwise generated.
+	DefaultNumSessions          = 0
+	DefaultMinLocksPerSession   = 1
+	DefaultMaxLocksPerSession   = 4
+	DefaultTTLFraction          = 0.5
+	DefaultMinTTLSeconds        = 10
+	DefaultMaxTTLSeconds        = 60
+	DefaultDeleteFraction       = 0.2
+	DefaultMaxLockDelaySeconds  = 15
+	DefaultNodeCheckFraction    = 0.5
+	DefaultServiceCheckFraction = 0.3
+	DefaultLockPrefix           = "locks/"
+)
+
+// Node is a catalog node which sessions may be attached to. Only passing checks may be
+// bound to sessions so the checks are limited to those.
+type Node struct {
+	Name          string
+	Datacenter    string
+	Partition     string
+	NodeChecks    []string
+	ServiceChecks []ServiceCheck
+}
+
+// ServiceCheck is a check of a service instance registered on a node
+type ServiceCheck struct {
+	ID        string
+	Namespace string `json:",omitempty"`
+}
+
+// Session is a single session attached to a node along with the locks it acquires.
+// The TTL and LockDelay are durations such as "15s".
+type Session struct {
+	Name          string
+	Node          string
+	Datacenter    string         `json:",omitempty"`
+	Partition     string         `json:",omitempty"`
+	Behavior      string         `json:",omitempty"`
+	TTL           string         `json:",omitempty"`
+	LockDelay     string         `json:",omitempty"`
+	NodeChecks    []string       `json:",omitempty"`
+	ServiceChecks []ServiceCheck `json:",omitempty"`
+	Locks         []*Lock        `json:",omitempty"`
+}
+
+// Lock is a KV entry acquired by a session. Locks are in the same partition as their
+// session's node.
+type Lock struct {
+	Key   string
+	Value string `json:",omitempty"`
+}
+
+// Config is all the configuration necessary for creating sessions
+type Config struct {
+	NumSessions        int
+	MinLocksPerSession int
+	MaxLocksPerSession int
+	// TTLFraction is the fraction of sessions with a TTL, which is picked from
+	// the range of [MinTTLSeconds, MaxTTLSeconds)
+	TTLFraction   float64
+	MinTTLSeconds int
+	MaxTTLSeconds int
+	// DeleteFraction is the fraction of sessions which delete their locks when
+	// invalidated instead of releasing them
+	DeleteFraction       float64
+	MaxLockDelaySeconds  int
+	NodeCheckFraction    float64
+	ServiceCheckFraction float64
+	LockPrefix           string
+	NameGen              generators.StringGenerator
+
+	// Nodes are what the sessions are attached to
+	Nodes []Node
+
+	// Rand is the source of randomness for generating sessions and any default
+	// generators. When nil a new source seeded with the current time is used.
+	Rand *rand.Rand
+}
+
+func DefaultNameGenerator(rng *rand.Rand) generators.StringGenerator {
+	return generators.PetNameGenerator(rng, "", 2, "-")
+}
+
+// DefaultConfig returns a config with all the defaults filled in.
+func DefaultConfig(rng *rand.Rand) Config {
+	return Config{
+		NumSessions:          DefaultNumSessions,
+		MinLocksPerSession:   DefaultMinLocksPerSession,
+		MaxLocksPerSession:   DefaultMaxLocksPerSession,
+		TTLFraction:          DefaultTTLFraction,
+		MinTTLSeconds:        DefaultMinTTLSeconds,
+		MaxTTLSeconds:        DefaultMaxTTLSeconds,
+		DeleteFraction:       DefaultDeleteFraction,
+		MaxLockDelaySeconds:  DefaultMaxLockDelaySeconds,
+		NodeCheckFraction:    DefaultNodeCheckFraction,
+		ServiceCheckFraction: DefaultServiceCheckFraction,
+		LockPrefix:           DefaultLockPrefix,
+		NameGen:              DefaultNameGenerator(rng),
+		Rand:                 rng,
+	}
+}
+
+func (c *Config) normalize() {
+	if c.Rand == nil {
+		c.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	if c.NameGen == nil {
+		c.NameGen = DefaultNameGenerator(c.Rand)
+	}
+
+	if c.MinLocksPerSession < 0 {
+		c.MinLocksPerSession = 0
+	}
+
+	if c.MaxLocksPerSession < c.MinLocksPerSession {
+		c.MaxLocksPerSession = c.MinLocksPerSession
+	}
+
+	if c.MinTTLSeconds < minTTLSeconds {
+		c.MinTTLSeconds = minTTLSeconds
+	}
+
+	if c.MaxTTLSeconds > maxTTLSeconds {
+		c.MaxTTLSeconds = maxTTLSeconds
+	}
+
+	if c.MaxTTLSeconds < c.MinTTLSeconds {
+		c.MaxTTLSeconds = c.MinTTLSeconds
+	}
+
+	if c.MaxLockDelaySeconds < 0 {
+		c.MaxLockDelaySeconds = 0
+	}
+}
+
+// chance returns true for the given fraction of calls without consuming any random data
+// when it can't
+func chance(rng *rand.Rand, fraction float64) bool {
+	return fraction > 0 && rng.Float64() < fraction
+}
+
+// count returns a count within the range [min, max)
+func count(rng *rand.Rand, min int, max int) int {
+	if max > min {
+		return rng.Intn(max-min) + min
+	}
+	return min
+}
+
+// genName generates a name which hasn't been used by another session
+func genName(conf Config, names map[string]struct{}) (string, error) {
+	for attempt := 0; attempt < 100; attempt++ {
+		name, err := conf.NameGen()
+		if err != nil {
+			return "", err
+		}
+
+		if _, found := names[name]; !found {
+			names[name] = struct{}{}
+			return name, nil
+		}
+	}
+
+	// fall back to making the name unique with a suffix
+	name, err := conf.NameGen()
+	if err != nil {
+		return "", err
+	}
+	name = fmt.Sprintf("%s-%d", name, len(names))
+	names[name] = struct{}{}
+	return name, nil
+}
+
+func genSession(conf Config, node Node, name string) *Session {
+	session := Session{
+		Name:       name,
+		Node:       node.Name,
+		Datacenter: node.Datacenter,
+		Partition:  node.Partition,
+		Behavior:   BehaviorRelease,
+	}
+
+	if chance(conf.Rand, conf.DeleteFraction) {
+		session.Behavior = BehaviorDelete
+	}
+
+	if chance(conf.Rand, conf.TTLFraction) {
+		session.TTL = fmt.Sprintf("%ds", count(conf.Rand, conf.MinTTLSeconds, conf.MaxTTLSeconds))
+	}
+
+	if conf.MaxLockDelaySeconds > 0 {
+		session.LockDelay = fmt.Sprintf("%ds", conf.Rand.Intn(conf.MaxLockDelaySeconds)+1)
+	}
+
+	if len(node.NodeChecks) > 0 && chance(conf.Rand, conf.NodeCheckFraction) {
+		session.NodeChecks = []string{node.NodeChecks[conf.Rand.Intn(len(node.NodeChecks))]}
+	}
+
+	if len(node.ServiceChecks) > 0 && chance(conf.Rand, conf.ServiceCheckFraction) {
+		session.ServiceChecks = []ServiceCheck{node.ServiceChecks[conf.Rand.Intn(len(node.ServiceChecks))]}
+	}
+
+	// the session's name makes each of its keys unique
+	numLocks := count(conf.Rand, conf.MinLocksPerSession, conf.MaxLocksPerSession)
+	for i := 0; i < numLocks; i++ {
+		session.Locks = append(session.Locks, &Lock{
+			Key:   fmt.Sprintf("%s%s/lock-%d", conf.LockPrefix, name, i+1),
+			Value: node.Name,
+		})
+	}
+	return &session
+}
+
+// Stream will generate the sessions invoking the function with each as soon as it is
+// generated. Sessions are attached to randomly picked nodes.
+func Stream(conf Config, fn func(*Session) error) error {
+	conf.normalize()
+
+	if len(conf.Nodes) == 0 {
+		return nil
+	}
+
+	names := make(map[string]struct{}, conf.NumSessions)
+	for i := 0; i < conf.NumSessions; i++ {
+		node := conf.Nodes[conf.Rand.Intn(len(conf.Nodes))]
+
+		name, err := genName(conf, names)
+		if err != nil {
+			return fmt.Errorf("Failed to generate session name: %w", err)
+		}
+
+		if err := fn(genSession(conf, node, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package sessions
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testNodes() []Node {
+	return []Node{
+		{Name: "node-1", Datacenter: "dc1", NodeChecks: []string{"serfHealth"}, ServiceChecks: []ServiceCheck{{ID: "web-check"}, {ID: "api-check", Namespace: "ns"}}},
+		{Name: "node-2", Datacenter: "dc2", Partition: "p1"},
+	}
+}
+
+func TestStream(t *testing.T) {
+	cases := map[string]struct {
+		conf     Config
+		nodes    []Node
+		sessions int
+	}{
+		"defaults": {
+			conf:  DefaultConfig(nil),
+			nodes: testNodes(),
+		},
+		"no nodes": {
+			conf: Config{NumSessions: 10},
+		},
+		"no options": {
+			conf:     Config{NumSessions: 20},
+			nodes:    testNodes(),
+			sessions: 20,
+		},
+		"all options": {
+			conf: Config{
+				NumSessions:          50,
+				MinLocksPerSession:   1,
+				MaxLocksPerSession:   4,
+				TTLFraction:          1,
+				MinTTLSeconds:        15,
+				MaxTTLSeconds:        30,
+				DeleteFraction:       1,
+				MaxLockDelaySeconds:  5,
+				NodeCheckFraction:    1,
+				ServiceCheckFraction: 1,
+				LockPrefix:           "locks/",
+			},
+			nodes:    testNodes(),
+			sessions: 50,
+		},
+		"out of range TTLs": {
+			conf:     Config{NumSessions: 20, TTLFraction: 1, MinTTLSeconds: 1, MaxTTLSeconds: 1000000},
+			nodes:    testNodes(),
+			sessions: 20,
+		},
+		"constant name": {
+			conf: Config{
+				NumSessions:        20,
+				MinLocksPerSession: 2,
+				MaxLocksPerSession: 2,
+				NameGen:            func() (string, error) { return "session", nil },
+			},
+			nodes:    testNodes(),
+			sessions: 20,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			conf := tc.conf
+			conf.Nodes = tc.nodes
+			conf.Rand = rand.New(rand.NewSource(1))
+			if conf.NameGen == nil {
+				conf.NameGen = DefaultNameGenerator(conf.Rand)
+			}
+
+			nodes := make(map[string]Node)
+			for _, node := range tc.nodes {
+				nodes[node.Name] = node
+			}
+
+			names := make(map[string]struct{})
+			keys := make(map[string]struct{})
+			err := Stream(conf, func(session *Session) error {
+				if _, found := names[session.Name]; found {
+					t.Fatalf("session %s was generated more than once", session.Name)
+				}
+				names[session.Name] = struct{}{}
+
+				node, found := nodes[session.Node]
+				if !found || session.Datacenter != node.Datacenter || session.Partition != node.Partition {
+					t.Fatalf("session %s is attached to unknown node %s", session.Name, session.Node)
+				}
+
+				expectedBehavior := BehaviorRelease
+				if conf.DeleteFraction == 1 {
+					expectedBehavior = BehaviorDelete
+				}
+				if session.Behavior != expectedBehavior {
+					t.Fatalf("session %s has behavior %s instead of %s", session.Name, session.Behavior, expectedBehavior)
+				}
+
+				checkDuration(t, "TTL", session.TTL, conf.TTLFraction == 1, max(conf.MinTTLSeconds, minTTLSeconds), min(conf.MaxTTLSeconds, maxTTLSeconds))
+				checkDuration(t, "lock delay", session.LockDelay, conf.MaxLockDelaySeconds > 0, 1, conf.MaxLockDelaySeconds)
+
+				if len(session.NodeChecks) != len(session.ServiceChecks) || len(session.NodeChecks) > 1 {
+					t.Fatalf("session %s has node checks %v and service checks %v", session.Name, session.NodeChecks, session.ServiceChecks)
+				}
+				if expected := conf.NodeCheckFraction == 1 && len(node.NodeChecks) > 0; (len(session.NodeChecks) > 0) != expected {
+					t.Fatalf("session %s has node checks %v", session.Name, session.NodeChecks)
+				}
+				for _, check := range session.NodeChecks {
+					if check != node.NodeChecks[0] {
+						t.Fatalf("session %s has node check %s which %s doesn't have", session.Name, check, node.Name)
+					}
+				}
+				for _, check := range session.ServiceChecks {
+					var found bool
+					for _, nodeCheck := range node.ServiceChecks {
+						found = found || check == nodeCheck
+					}
+					if !found {
+						t.Fatalf("session %s has service check %+v which %s doesn't have", session.Name, check, node.Name)
+					}
+				}
+
+				maxLocks := conf.MaxLocksPerSession
+				if maxLocks > conf.MinLocksPerSession {
+					maxLocks--
+				}
+				if len(session.Locks) < conf.MinLocksPerSession || len(session.Locks) > maxLocks {
+					t.Fatalf("session %s has %d locks", session.Name, len(session.Locks))
+				}
+				for _, lock := range session.Locks {
+					if _, found := keys[lock.Key]; found {
+						t.Fatalf("lock %s was generated more than once", lock.Key)
+					}
+					keys[lock.Key] = struct{}{}
+
+					if !strings.HasPrefix(lock.Key, conf.LockPrefix+session.Name+"/") || lock.Value != session.Node {
+						t.Fatalf("session %s has lock %+v", session.Name, lock)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to generate sessions: %v", err)
+			}
+
+			if len(names) != tc.sessions {
+				t.Fatalf("expected %d sessions but got %d", tc.sessions, len(names))
+			}
+		})
+	}
+}
+
+// checkDuration checks that the duration is set when expected and within [min, max]
+func checkDuration(t *testing.T, kind string, value string, expected bool, min int, max int) {
+	t.Helper()
+
+	if !expected {
+		if value != "" {
+			t.Fatalf("unexpected %s %s", kind, value)
+		}
+		return
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		t.Fatalf("invalid %s %q: %v", kind, value, err)
+	}
+	if d < time.Duration(min)*time.Second || d > time.Duration(max)*time.Second {
+		t.Fatalf("%s %s isn't within [%ds, %ds]", kind, value, min, max)
+	}
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
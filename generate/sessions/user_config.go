@@ -0,0 +1,110 @@
+package sessions
+
+import (
+	"math/rand"
+)
+
+type UserConfig struct {
+	NumSessions          int
+	MinLocksPerSession   int
+	MaxLocksPerSession   int
+	TTLFraction          float64
+	MinTTLSeconds        int
+	MaxTTLSeconds        int
+	DeleteFraction       float64
+	MaxLockDelaySeconds  int
+	NodeCheckFraction    float64
+	ServiceCheckFraction float64
+	LockPrefix           string
+}
+
+func (c *UserConfig) ToGeneratorConfig(rng *rand.Rand) (Config, error) {
+	c.Normalize()
+
+	return Config{
+		NumSessions:          c.NumSessions,
+		MinLocksPerSession:   c.MinLocksPerSession,
+		MaxLocksPerSession:   c.MaxLocksPerSession,
+		TTLFraction:          c.TTLFraction,
+		MinTTLSeconds:        c.MinTTLSeconds,
+		MaxTTLSeconds:        c.MaxTTLSeconds,
+		DeleteFraction:       c.DeleteFraction,
+		MaxLockDelaySeconds:  c.MaxLockDelaySeconds,
+		NodeCheckFraction:    c.NodeCheckFraction,
+		ServiceCheckFraction: c.ServiceCheckFraction,
+		LockPrefix:           c.LockPrefix,
+		NameGen:              DefaultNameGenerator(rng),
+		Rand:                 rng,
+	}, nil
+}
+
+// Enabled returns whether any sessions are to be generated
+func (c *UserConfig) Enabled() bool {
+	return c.NumSessions > 0
+}
+
+func (c *UserConfig) Normalize() {
+	if c.NumSessions < 0 {
+		c.NumSessions = DefaultNumSessions
+	}
+
+	if c.MinLocksPerSession <= 0 {
+		c.MinLocksPerSession = DefaultMinLocksPerSession
+	}
+
+	if c.MaxLocksPerSession <= 0 {
+		c.MaxLocksPerSession = DefaultMaxLocksPerSession
+	}
+
+	if c.MaxLocksPerSession < c.MinLocksPerSession {
+		c.MaxLocksPerSession = c.MinLocksPerSession
+	}
+
+	if c.TTLFraction < 0 {
+		c.TTLFraction = DefaultTTLFraction
+	}
+
+	if c.MinTTLSeconds <= 0 {
+		c.MinTTLSeconds = DefaultMinTTLSeconds
+	}
+
+	if c.MaxTTLSeconds <= 0 {
+		c.MaxTTLSeconds = DefaultMaxTTLSeconds
+	}
+
+	if c.DeleteFraction < 0 {
+		c.DeleteFraction = DefaultDeleteFraction
+	}
+
+	if c.MaxLockDelaySeconds < 0 {
+		c.MaxLockDelaySeconds = DefaultMaxLockDelaySeconds
+	}
+
+	if c.NodeCheckFraction < 0 {
+		c.NodeCheckFraction = DefaultNodeCheckFraction
+	}
+
+	if c.ServiceCheckFraction < 0 {
+		c.ServiceCheckFraction = DefaultServiceCheckFraction
+	}
+
+	if c.LockPrefix == "" {
+		c.LockPrefix = DefaultLockPrefix
+	}
+}
+
+func DefaultUserConfig() UserConfig {
+	return UserConfig{
+		NumSessions:          DefaultNumSessions,
+		MinLocksPerSession:   DefaultMinLocksPerSession,
+		MaxLocksPerSession:   DefaultMaxLocksPerSession,
+		TTLFraction:          DefaultTTLFraction,
+		MinTTLSeconds:        DefaultMinTTLSeconds,
+		MaxTTLSeconds:        DefaultMaxTTLSeconds,
+		DeleteFraction:       DefaultDeleteFraction,
+		MaxLockDelaySeconds:  DefaultMaxLockDelaySeconds,
+		NodeCheckFraction:    DefaultNodeCheckFraction,
+		ServiceCheckFraction: DefaultServiceCheckFraction,
+		LockPrefix:           DefaultLockPrefix,
+	}
+}
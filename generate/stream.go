@@ -0,0 +1,703 @@
+package generate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/mkeeler/consul-data/generate/acl"
+	"github.com/mkeeler/consul-data/generate/catalog"
+	"github.com/mkeeler/consul-data/generate/configentries"
+	"github.com/mkeeler/consul-data/generate/events"
+	"github.com/mkeeler/consul-data/generate/intentions"
+	"github.com/mkeeler/consul-data/generate/kv"
+	"github.com/mkeeler/consul-data/generate/preparedqueries"
+	"github.com/mkeeler/consul-data/generate/sessions"
+)
+
+// Handler receives data one KV entry, node or other item at a time as it is generated
+// or read. Any callback may be nil in which case that type of data is ignored.
+type Handler struct {
+	KV            func(key string, value kv.Value) error
+	GraphService  func(svc *catalog.GraphService) error
+	Node          func(node *catalog.Node) error
+	ACLPolicy     func(policy *acl.Policy) error
+	ACLRole       func(role *acl.Role) error
+	ACLToken      func(token *acl.Token) error
+	ConfigEntry   func(entry *configentries.Entry) error
+	Intentions    func(intentions *intentions.Intentions) error
+	PreparedQuery func(query *preparedqueries.Query) error
+	Session       func(session *sessions.Session) error
+	Event         func(event *events.Event) error
+}
+
+func (h Handler) handleKV(key string, value kv.Value) error {
+	if h.KV == nil {
+		return nil
+	}
+	return h.KV(key, value)
+}
+
+func (h Handler) handleGraphService(svc *catalog.GraphService) error {
+	if h.GraphService == nil {
+		return nil
+	}
+	return h.GraphService(svc)
+}
+
+func (h Handler) handleNode(node *catalog.Node) error {
+	if h.Node == nil {
+		return nil
+	}
+	return h.Node(node)
+}
+
+func (h Handler) handleACLPolicy(policy *acl.Policy) error {
+	if h.ACLPolicy == nil {
+		return nil
+	}
+	return h.ACLPolicy(policy)
+}
+
+func (h Handler) handleACLRole(role *acl.Role) error {
+	if h.ACLRole == nil {
+		return nil
+	}
+	return h.ACLRole(role)
+}
+
+func (h Handler) handleACLToken(token *acl.Token) error {
+	if h.ACLToken == nil {
+		return nil
+	}
+	return h.ACLToken(token)
+}
+
+func (h Handler) handleConfigEntry(entry *configentries.Entry) error {
+	if h.ConfigEntry == nil {
+		return nil
+	}
+	return h.ConfigEntry(entry)
+}
+
+func (h Handler) handleIntentions(intentions *intentions.Intentions) error {
+	if h.Intentions == nil {
+		return nil
+	}
+	return h.Intentions(intentions)
+}
+
+func (h Handler) handlePreparedQuery(query *preparedqueries.Query) error {
+	if h.PreparedQuery == nil {
+		return nil
+	}
+	return h.PreparedQuery(query)
+}
+
+func (h Handler) handleSession(session *sessions.Session) error {
+	if h.Session == nil {
+		return nil
+	}
+	return h.Session(session)
+}
+
+func (h Handler) handleEvent(event *events.Event) error {
+	if h.Event == nil {
+		return nil
+	}
+	return h.Event(event)
+}
+
+// Tee returns a Handler which hands everything it receives to each of the handlers in
+// turn, stopping at the first error.
+func Tee(handlers ...Handler) Handler {
+	return Handler{
+		KV: func(key string, value kv.Value) error {
+			for _, h := range handlers {
+				if err := h.handleKV(key, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		GraphService: func(svc *catalog.GraphService) error {
+			for _, h := range handlers {
+				if err := h.handleGraphService(svc); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Node: func(node *catalog.Node) error {
+			for _, h := range handlers {
+				if err := h.handleNode(node); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		ACLPolicy: func(policy *acl.Policy) error {
+			for _, h := range handlers {
+				if err := h.handleACLPolicy(policy); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		ACLRole: func(role *acl.Role) error {
+			for _, h := range handlers {
+				if err := h.handleACLRole(role); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		ACLToken: func(token *acl.Token) error {
+			for _, h := range handlers {
+				if err := h.handleACLToken(token); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		ConfigEntry: func(entry *configentries.Entry) error {
+			for _, h := range handlers {
+				if err := h.handleConfigEntry(entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Intentions: func(intentions *intentions.Intentions) error {
+			for _, h := range handlers {
+				if err := h.handleIntentions(intentions); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		PreparedQuery: func(query *preparedqueries.Query) error {
+			for _, h := range handlers {
+				if err := h.handlePreparedQuery(query); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Session: func(session *sessions.Session) error {
+			for _, h := range handlers {
+				if err := h.handleSession(session); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Event: func(event *events.Event) error {
+			for _, h := range handlers {
+				if err := h.handleEvent(event); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// Stream hands all of the data to the handler, the ACL policies, roles and tokens first
+// followed by the KV entries, the service graph, the nodes, the config entries, the
+// intentions, the prepared queries, the sessions and then the events.
+func (d *Data) Stream(h Handler) error {
+	for _, policy := range d.ACLPolicies {
+		if err := h.handleACLPolicy(policy); err != nil {
+			return err
+		}
+	}
+
+	for _, role := range d.ACLRoles {
+		if err := h.handleACLRole(role); err != nil {
+			return err
+		}
+	}
+
+	for _, token := range d.ACLTokens {
+		if err := h.handleACLToken(token); err != nil {
+			return err
+		}
+	}
+
+	for key, value := range d.KV {
+		if err := h.handleKV(key, value); err != nil {
+			return err
+		}
+	}
+
+	for _, svc := range d.ServiceGraph {
+		if err := h.handleGraphService(svc); err != nil {
+			return err
+		}
+	}
+
+	for _, node := range d.Catalog {
+		if err := h.handleNode(node); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range d.ConfigEntries {
+		if err := h.handleConfigEntry(entry); err != nil {
+			return err
+		}
+	}
+
+	for _, intentions := range d.Intentions {
+		if err := h.handleIntentions(intentions); err != nil {
+			return err
+		}
+	}
+
+	for _, query := range d.PreparedQueries {
+		if err := h.handlePreparedQuery(query); err != nil {
+			return err
+		}
+	}
+
+	for _, session := range d.Sessions {
+		if err := h.handleSession(session); err != nil {
+			return err
+		}
+	}
+
+	for _, event := range d.Events {
+		if err := h.handleEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const writerIndent = "   "
+
+// writerSection is a top level field of the JSON data
+type writerSection struct {
+	name  string
+	open  string
+	close string
+	// required sections are written even when empty just like when marshalling a
+	// Data struct. Others are omitted.
+	required bool
+}
+
+// writerSections must be in the same order as the fields of the Data struct
+var writerSections = []writerSection{
+	{name: "ACLPolicies", open: "[", close: "]"},
+	{name: "ACLRoles", open: "[", close: "]"},
+	{name: "ACLTokens", open: "[", close: "]"},
+	{name: "KV", open: "{", close: "}", required: true},
+	{name: "ServiceGraph", open: "[", close: "]"},
+	{name: "Catalog", open: "[", close: "]", required: true},
+	{name: "ConfigEntries", open: "[", close: "]"},
+	{name: "Intentions", open: "[", close: "]"},
+	{name: "PreparedQueries", open: "[", close: "]"},
+	{name: "Sessions", open: "[", close: "]"},
+	{name: "Events", open: "[", close: "]"},
+}
+
+const (
+	sectionACLPolicies = iota
+	sectionACLRoles
+	sectionACLTokens
+	sectionKV
+	sectionServiceGraph
+	sectionCatalog
+	sectionConfigEntries
+	sectionIntentions
+	sectionPreparedQueries
+	sectionSessions
+	sectionEvents
+)
+
+// Writer incrementally serializes data in the same JSON format as marshalling a Data
+// struct so that arbitrarily large data sets can be written with constant memory.
+// Each type of data must be written in the order of the Data struct's fields, e.g. all
+// KV entries must be written before any nodes. Close must be called once all data has
+// been written.
+type Writer struct {
+	w *bufio.Writer
+
+	// the index of the current section within writerSections
+	section int
+	open    bool
+	// the number of sections and elements of the current section written so far
+	sections int
+	count    int
+}
+
+// NewWriter creates a Writer outputting to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:       bufio.NewWriter(w),
+		section: -1,
+	}
+}
+
+// Handler returns a Handler which writes all the data it receives.
+func (w *Writer) Handler() Handler {
+	return Handler{
+		KV:            w.WriteKV,
+		GraphService:  w.WriteGraphService,
+		Node:          w.WriteNode,
+		ACLPolicy:     w.WriteACLPolicy,
+		ACLRole:       w.WriteACLRole,
+		ACLToken:      w.WriteACLToken,
+		ConfigEntry:   w.WriteConfigEntry,
+		Intentions:    w.WriteIntentions,
+		PreparedQuery: w.WritePreparedQuery,
+		Session:       w.WriteSession,
+		Event:         w.WriteEvent,
+	}
+}
+
+// enter closes out the current section, writes any required sections which come before
+// the given one and then opens it.
+func (w *Writer) enter(section int) {
+	if w.section < 0 {
+		w.w.WriteString("{")
+	}
+
+	for w.section < section {
+		if w.open {
+			if w.count > 0 {
+				w.w.WriteString("\n" + writerIndent)
+			}
+			w.w.WriteString(writerSections[w.section].close)
+			w.open = false
+		}
+
+		w.section += 1
+		if w.section >= len(writerSections) {
+			return
+		}
+
+		if w.section == section || writerSections[w.section].required {
+			if w.sections > 0 {
+				w.w.WriteString(",")
+			}
+			w.w.WriteString("\n" + writerIndent + "\"" + writerSections[w.section].name + "\": " + writerSections[w.section].open)
+			w.open = true
+			w.sections += 1
+			w.count = 0
+		}
+	}
+}
+
+// writeElement writes a single element of the given section.
+func (w *Writer) writeElement(section int, prefix string, value interface{}) error {
+	if w.section > section {
+		return fmt.Errorf("%s must be written before %s", writerSections[section].name, writerSections[w.section].name)
+	}
+	w.enter(section)
+
+	raw, err := json.MarshalIndent(value, writerIndent+writerIndent, writerIndent)
+	if err != nil {
+		return err
+	}
+
+	if w.count > 0 {
+		w.w.WriteString(",")
+	}
+	w.count += 1
+	w.w.WriteString("\n" + writerIndent + writerIndent + prefix)
+	_, err = w.w.Write(raw)
+	return err
+}
+
+// WriteKV writes a single KV entry.
+func (w *Writer) WriteKV(key string, value kv.Value) error {
+	rawKey, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("Failed to serialize KV entry %s: %w", key, err)
+	}
+
+	if err := w.writeElement(sectionKV, string(rawKey)+": ", value); err != nil {
+		return fmt.Errorf("Failed to write KV entry %s: %w", key, err)
+	}
+	return nil
+}
+
+// WriteGraphService writes a single service of the service graph.
+func (w *Writer) WriteGraphService(svc *catalog.GraphService) error {
+	if err := w.writeElement(sectionServiceGraph, "", svc); err != nil {
+		return fmt.Errorf("Failed to write graph service %s: %w", svc.Name, err)
+	}
+	return nil
+}
+
+// WriteNode writes a single node along with all of its services.
+func (w *Writer) WriteNode(node *catalog.Node) error {
+	if err := w.writeElement(sectionCatalog, "", node); err != nil {
+		return fmt.Errorf("Failed to write Node %s: %w", node.Name, err)
+	}
+	return nil
+}
+
+// WriteACLPolicy writes a single ACL policy.
+func (w *Writer) WriteACLPolicy(policy *acl.Policy) error {
+	if err := w.writeElement(sectionACLPolicies, "", policy); err != nil {
+		return fmt.Errorf("Failed to write ACL policy %s: %w", policy.Name, err)
+	}
+	return nil
+}
+
+// WriteACLRole writes a single ACL role.
+func (w *Writer) WriteACLRole(role *acl.Role) error {
+	if err := w.writeElement(sectionACLRoles, "", role); err != nil {
+		return fmt.Errorf("Failed to write ACL role %s: %w", role.Name, err)
+	}
+	return nil
+}
+
+// WriteACLToken writes a single ACL token.
+func (w *Writer) WriteACLToken(token *acl.Token) error {
+	if err := w.writeElement(sectionACLTokens, "", token); err != nil {
+		return fmt.Errorf("Failed to write ACL token %s: %w", token.AccessorID, err)
+	}
+	return nil
+}
+
+// WriteConfigEntry writes a single config entry.
+func (w *Writer) WriteConfigEntry(entry *configentries.Entry) error {
+	if err := w.writeElement(sectionConfigEntries, "", entry); err != nil {
+		return fmt.Errorf("Failed to write %s config entry %s: %w", entry.Kind, entry.Name, err)
+	}
+	return nil
+}
+
+// WriteIntentions writes the intentions of a single destination service.
+func (w *Writer) WriteIntentions(intentions *intentions.Intentions) error {
+	if err := w.writeElement(sectionIntentions, "", intentions); err != nil {
+		return fmt.Errorf("Failed to write intentions for %s: %w", intentions.Name, err)
+	}
+	return nil
+}
+
+// WritePreparedQuery writes a single prepared query.
+func (w *Writer) WritePreparedQuery(query *preparedqueries.Query) error {
+	if err := w.writeElement(sectionPreparedQueries, "", query); err != nil {
+		return fmt.Errorf("Failed to write prepared query %s: %w", query.Name, err)
+	}
+	return nil
+}
+
+// WriteSession writes a single session.
+func (w *Writer) WriteSession(session *sessions.Session) error {
+	if err := w.writeElement(sectionSessions, "", session); err != nil {
+		return fmt.Errorf("Failed to write session %s: %w", session.Name, err)
+	}
+	return nil
+}
+
+// WriteEvent writes a single user event.
+func (w *Writer) WriteEvent(event *events.Event) error {
+	if err := w.writeElement(sectionEvents, "", event); err != nil {
+		return fmt.Errorf("Failed to write event %s: %w", event.Name, err)
+	}
+	return nil
+}
+
+// Close finishes writing the data and flushes any buffered output. It does not close
+// the underlying io.Writer.
+func (w *Writer) Close() error {
+	if w.section >= len(writerSections) {
+		return nil
+	}
+	w.enter(len(writerSections))
+	w.w.WriteString("\n}\n")
+
+	if err := w.w.Flush(); err != nil {
+		return fmt.Errorf("Failed to write data: %w", err)
+	}
+	return nil
+}
+
+// decodeJSON reads data in the format produced by the Writer or by marshalling a Data
+// struct and hands each item to the handler as it is read, without
+// retaining the data in memory. Entries are handled in the order they appear.
+func decodeJSON(r io.Reader, h Handler) error {
+	dec := json.NewDecoder(r)
+
+	if open, err := decodeOpen(dec, '{'); !open || err != nil {
+		return err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("Failed to parse JSON data: %w", err)
+		}
+
+		switch tok {
+		case "KV":
+			err = decodeKV(dec, h)
+		case "ServiceGraph":
+			err = decodeArray(dec, func() error {
+				var svc catalog.GraphService
+				if err := dec.Decode(&svc); err != nil {
+					return fmt.Errorf("Failed to parse service graph: %w", err)
+				}
+				return h.handleGraphService(&svc)
+			})
+		case "Catalog":
+			err = decodeArray(dec, func() error {
+				var node catalog.Node
+				if err := dec.Decode(&node); err != nil {
+					return fmt.Errorf("Failed to parse catalog data: %w", err)
+				}
+				return h.handleNode(&node)
+			})
+		case "ACLPolicies":
+			err = decodeArray(dec, func() error {
+				var policy acl.Policy
+				if err := dec.Decode(&policy); err != nil {
+					return fmt.Errorf("Failed to parse ACL policies: %w", err)
+				}
+				return h.handleACLPolicy(&policy)
+			})
+		case "ACLRoles":
+			err = decodeArray(dec, func() error {
+				var role acl.Role
+				if err := dec.Decode(&role); err != nil {
+					return fmt.Errorf("Failed to parse ACL roles: %w", err)
+				}
+				return h.handleACLRole(&role)
+			})
+		case "ACLTokens":
+			err = decodeArray(dec, func() error {
+				var token acl.Token
+				if err := dec.Decode(&token); err != nil {
+					return fmt.Errorf("Failed to parse ACL tokens: %w", err)
+				}
+				return h.handleACLToken(&token)
+			})
+		case "ConfigEntries":
+			err = decodeArray(dec, func() error {
+				var entry configentries.Entry
+				if err := dec.Decode(&entry); err != nil {
+					return fmt.Errorf("Failed to parse config entries: %w", err)
+				}
+				return h.handleConfigEntry(&entry)
+			})
+		case "Intentions":
+			err = decodeArray(dec, func() error {
+				var entry intentions.Intentions
+				if err := dec.Decode(&entry); err != nil {
+					return fmt.Errorf("Failed to parse intentions: %w", err)
+				}
+				return h.handleIntentions(&entry)
+			})
+		case "PreparedQueries":
+			err = decodeArray(dec, func() error {
+				var query preparedqueries.Query
+				if err := dec.Decode(&query); err != nil {
+					return fmt.Errorf("Failed to parse prepared queries: %w", err)
+				}
+				return h.handlePreparedQuery(&query)
+			})
+		case "Sessions":
+			err = decodeArray(dec, func() error {
+				var session sessions.Session
+				if err := dec.Decode(&session); err != nil {
+					return fmt.Errorf("Failed to parse sessions: %w", err)
+				}
+				return h.handleSession(&session)
+			})
+		case "Events":
+			err = decodeArray(dec, func() error {
+				var event events.Event
+				if err := dec.Decode(&event); err != nil {
+					return fmt.Errorf("Failed to parse events: %w", err)
+				}
+				return h.handleEvent(&event)
+			})
+		default:
+			// skip over any unknown fields just as json.Unmarshal would
+			var ignored json.RawMessage
+			err = dec.Decode(&ignored)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("Failed to parse JSON data: %w", err)
+	}
+	if tok != delim {
+		return fmt.Errorf("Failed to parse JSON data: expected %v but found %v", delim, tok)
+	}
+	return nil
+}
+
+// decodeOpen consumes the opening delimiter of an object or array returning false
+// when the value is null instead.
+func decodeOpen(dec *json.Decoder, delim json.Delim) (bool, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return false, fmt.Errorf("Failed to parse JSON data: %w", err)
+	}
+	if tok == nil {
+		return false, nil
+	}
+	if tok != delim {
+		return false, fmt.Errorf("Failed to parse JSON data: expected %v but found %v", delim, tok)
+	}
+	return true, nil
+}
+
+func decodeKV(dec *json.Decoder, h Handler) error {
+	if open, err := decodeOpen(dec, '{'); !open || err != nil {
+		return err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("Failed to parse KV data: %w", err)
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("Failed to parse KV data: unexpected key %v", tok)
+		}
+
+		var value kv.Value
+		if err := dec.Decode(&value); err != nil {
+			return fmt.Errorf("Failed to parse KV entry %s: %w", key, err)
+		}
+
+		if err := h.handleKV(key, value); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+// decodeArray invokes decode for each element of a JSON array.
+func decodeArray(dec *json.Decoder, decode func() error) error {
+	if open, err := decodeOpen(dec, '['); !open || err != nil {
+		return err
+	}
+
+	for dec.More() {
+		if err := decode(); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, ']')
+}
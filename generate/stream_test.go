@@ -0,0 +1,203 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/mkeeler/consul-data/generate/acl"
+	"github.com/mkeeler/consul-data/generate/catalog"
+	"github.com/mkeeler/consul-data/generate/configentries"
+	"github.com/mkeeler/consul-data/generate/events"
+	"github.com/mkeeler/consul-data/generate/intentions"
+	"github.com/mkeeler/consul-data/generate/kv"
+	"github.com/mkeeler/consul-data/generate/preparedqueries"
+	"github.com/mkeeler/consul-data/generate/sessions"
+)
+
+// collect returns a handler which appends everything it is handed to the data
+func collect(data *Data) Handler {
+	data.KV = make(kv.KV)
+	return Handler{
+		KV: func(key string, value kv.Value) error {
+			data.KV[key] = value
+			return nil
+		},
+		GraphService: func(svc *catalog.GraphService) error {
+			data.ServiceGraph = append(data.ServiceGraph, svc)
+			return nil
+		},
+		Node: func(node *catalog.Node) error {
+			data.Catalog = append(data.Catalog, node)
+			return nil
+		},
+		ACLPolicy: func(policy *acl.Policy) error {
+			data.ACLPolicies = append(data.ACLPolicies, policy)
+			return nil
+		},
+		ACLRole: func(role *acl.Role) error {
+			data.ACLRoles = append(data.ACLRoles, role)
+			return nil
+		},
+		ACLToken: func(token *acl.Token) error {
+			data.ACLTokens = append(data.ACLTokens, token)
+			return nil
+		},
+		ConfigEntry: func(entry *configentries.Entry) error {
+			data.ConfigEntries = append(data.ConfigEntries, entry)
+			return nil
+		},
+		Intentions: func(intentions *intentions.Intentions) error {
+			data.Intentions = append(data.Intentions, intentions)
+			return nil
+		},
+		PreparedQuery: func(query *preparedqueries.Query) error {
+			data.PreparedQueries = append(data.PreparedQueries, query)
+			return nil
+		},
+		Session: func(session *sessions.Session) error {
+			data.Sessions = append(data.Sessions, session)
+			return nil
+		},
+		Event: func(event *events.Event) error {
+			data.Events = append(data.Events, event)
+			return nil
+		},
+	}
+}
+
+func testData(t *testing.T) *Data {
+	t.Helper()
+
+	conf := DefaultConfig()
+	conf.KV.NumEntries = 32
+	conf.Catalog.NumNodes = 8
+	conf.ACL.NumPolicies = 2
+	conf.ACL.NumTokens = 2
+	conf.ConfigEntries.ResolverFraction = 1
+	conf.Intentions.Density = 0.5
+	conf.PreparedQueries.Fraction = 0.5
+	conf.Sessions.NumSessions = 2
+	conf.Events.NumEvents = 2
+
+	data, err := GenerateAll(conf, 1)
+	if err != nil {
+		t.Fatalf("Failed to generate data: %v", err)
+	}
+
+	// every kind of data is round tripped
+	if len(data.ACLPolicies) == 0 || len(data.ACLTokens) == 0 || len(data.KV) == 0 ||
+		len(data.Catalog) == 0 || len(data.ConfigEntries) == 0 || len(data.Intentions) == 0 ||
+		len(data.PreparedQueries) == 0 || len(data.Sessions) == 0 || len(data.Events) == 0 {
+		t.Fatalf("generated data is missing some kinds of data")
+	}
+	return data
+}
+
+func writeData(t *testing.T, data *Data) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := data.Stream(w.Handler()); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriter_MatchesMarshal(t *testing.T) {
+	data := testData(t)
+
+	// the streamed document decodes into the same data as encoding/json produces
+	var decoded Data
+	streamed := writeData(t, data)
+	if err := json.Unmarshal(streamed, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal streamed data: %v\n%s", err, streamed)
+	}
+
+	expected, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Failed to marshal data: %v", err)
+	}
+	actual, err := json.Marshal(&decoded)
+	if err != nil {
+		t.Fatalf("Failed to marshal data: %v", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Fatalf("streamed data differs from the marshalled data")
+	}
+}
+
+func TestWriter_Empty(t *testing.T) {
+	streamed := writeData(t, &Data{})
+	if !json.Valid(streamed) {
+		t.Fatalf("streamed data is not valid JSON:\n%s", streamed)
+	}
+}
+
+func TestStreamAll_MatchesGenerateAll(t *testing.T) {
+	conf := DefaultConfig()
+	conf.KV.NumEntries = 32
+	conf.Catalog.NumNodes = 8
+
+	expected, err := GenerateAll(conf, 1)
+	if err != nil {
+		t.Fatalf("Failed to generate data: %v", err)
+	}
+
+	var streamed Data
+	if err := StreamAll(conf, 1, collect(&streamed)); err != nil {
+		t.Fatalf("Failed to stream data: %v", err)
+	}
+
+	expectedJSON, _ := json.Marshal(expected)
+	streamedJSON, _ := json.Marshal(&streamed)
+	if !bytes.Equal(expectedJSON, streamedJSON) {
+		t.Fatalf("streamed data differs from the generated data")
+	}
+}
+
+func TestTee(t *testing.T) {
+	stop := errors.New("stop")
+
+	cases := map[string]struct {
+		errs []error
+		// calls is the number of handlers expected to be called
+		calls int
+		err   error
+	}{
+		"none":        {},
+		"all":         {errs: []error{nil, nil, nil}, calls: 3},
+		"first fails": {errs: []error{stop, nil, nil}, calls: 1, err: stop},
+		"last fails":  {errs: []error{nil, nil, stop}, calls: 3, err: stop},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			var handlers []Handler
+			for _, err := range tc.errs {
+				err := err
+				handlers = append(handlers, Handler{
+					KV: func(string, kv.Value) error {
+						calls++
+						return err
+					},
+				})
+			}
+			// handlers without a function for the kind of data are skipped
+			handlers = append(handlers, Handler{})
+
+			if err := Tee(handlers...).KV("key", kv.Value{}); err != tc.err {
+				t.Fatalf("expected error %v but got %v", tc.err, err)
+			}
+			if calls != tc.calls {
+				t.Fatalf("expected %d calls but got %d", tc.calls, calls)
+			}
+		})
+	}
+}